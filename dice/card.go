@@ -0,0 +1,230 @@
+package dice
+
+import (
+	"fmt"
+	"island/storage"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// attrAliases 属性和技能的别名，键为小写，值为人物卡中保存的名称
+var attrAliases = map[string]string{
+	"str": "力量", "con": "体质", "siz": "体型", "dex": "敏捷", "app": "外貌",
+	"int": "智力", "灵感": "智力", "pow": "意志", "edu": "教育", "知识": "教育",
+	"luck": "幸运", "运气": "幸运",
+	"san": "理智", "san值": "理智", "理智值": "理智",
+	"hp": "生命值", "生命": "生命值", "体力": "生命值", "耐久": "生命值",
+	"mp": "魔法值", "魔法": "魔法值",
+	"mov": "移动力", "db": "伤害加值",
+	"侦察": "侦查", "图书馆使用": "图书馆", "信用评级": "信用", "信誉": "信用",
+	"cm": "克苏鲁神话", "克苏鲁": "克苏鲁神话", "电脑": "计算机使用",
+	"汽车驾驶": "驾驶", "快速交谈": "话术", "格斗": "斗殴", "取悦": "魅惑",
+	"步枪": "步霰", "霰弹枪": "步霰", "步枪/霰弹枪": "步霰", "计算机": "计算机使用",
+}
+
+// coreAttrs 展示人物卡时排在前面的属性
+var coreAttrs = []string{"力量", "体质", "体型", "敏捷", "外貌", "智力", "意志", "教育", "幸运", "理智", "生命值", "魔法值"}
+
+// canonicalAttr 将属性名或别名转换为人物卡中保存的名称
+func canonicalAttr(name string) string {
+	name = strings.TrimSpace(name)
+	if canonical, ok := attrAliases[strings.ToLower(name)]; ok {
+		return canonical
+	}
+	return name
+}
+
+// newCard 为玩家在当前群新建一张空白的 CoC7 人物卡
+func newCard(ctx *CommandContext) *storage.CharacterCard {
+	return &storage.CharacterCard{
+		ID:       storage.NewCardID(ctx.PlayerID),
+		Name:     "未命名角色",
+		System:   "coc7",
+		PlayerID: ctx.PlayerID,
+		GroupID:  ctx.GroupID,
+		Attrs:    make(map[string]interface{}),
+	}
+}
+
+// updateCard 读取、修改并保存玩家在当前群使用的人物卡，没有时新建一张
+// 读取到保存在同一次加锁中完成；校验重放时只修改副本，不保存
+func updateCard(ctx *CommandContext, update func(card *storage.CharacterCard) error) error {
+	if ctx.DryRun {
+		card, ok := ctx.Storage.ActiveCard(ctx.PlayerID, ctx.GroupID)
+		if !ok {
+			card = newCard(ctx)
+		}
+		return update(card)
+	}
+	create := func() *storage.CharacterCard { return newCard(ctx) }
+	return ctx.Storage.UpdateActiveCard(ctx.PlayerID, ctx.GroupID, create, update)
+}
+
+// saveCard 保存人物卡，新卡同时设为当前人物卡；校验重放时不保存
+func saveCard(ctx *CommandContext, card *storage.CharacterCard, isNew bool) error {
+	if ctx.DryRun {
+		return nil
+	}
+	if err := ctx.Storage.SaveCard(card); err != nil {
+		return err
+	}
+	if isNew {
+		return ctx.Storage.SetActiveCard(ctx.PlayerID, ctx.GroupID, card.ID)
+	}
+	return nil
+}
+
+// stPairRegex 匹配一个属性赋值，例如 力量70、hp-3、san+1d6、敏捷:65
+var stPairRegex = regexp.MustCompile(`^([^\s\d+\-:：=]+)\s*[:：=]?\s*([+\-]?)\s*(\d*[dD]?\d+(?:[+\-*]\d*[dD]?\d+)*)`)
+
+// stChange 一次属性修改
+type stChange struct {
+	name  string
+	delta string // "+" 或 "-"，直接赋值时为空
+	expr  string
+}
+
+// parseStPairs 解析 .st 的属性列表
+func parseStPairs(input string) ([]stChange, error) {
+	var changes []stChange
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		m := stPairRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("无法识别: %s", rest)
+		}
+		changes = append(changes, stChange{name: canonicalAttr(m[1]), delta: m[2], expr: m[3]})
+		rest = strings.TrimLeft(rest[len(m[0]):], " \t\n,，")
+	}
+	return changes, nil
+}
+
+// StCommand .st 指令 (记录人物卡属性)
+type StCommand struct {
+	BaseCommand
+}
+
+func NewStCommand() *StCommand {
+	return &StCommand{
+		BaseCommand: BaseCommand{
+			name:  "st",
+			help:  ".st [属性][数值] - 记录人物卡属性，例如 .st 力量70 敏捷65、.st hp-3、.st show",
+			regex: regexp.MustCompile(`^st\s*(.*)$`),
+		},
+	}
+}
+
+func (c *StCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *StCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 || strings.TrimSpace(matches[1]) == "" {
+		return "用法: .st [属性][数值]... 或 .st show [属性]..."
+	}
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法记录人物卡"
+	}
+
+	args := strings.TrimSpace(matches[1])
+	if rest, ok := strings.CutPrefix(args, "show"); ok {
+		return showCard(ctx, strings.Fields(rest))
+	}
+
+	changes, err := parseStPairs(args)
+	if err != nil {
+		return fmt.Sprintf("属性格式有误，%v\n例如: .st 力量70 敏捷65 或 .st hp-3", err)
+	}
+
+	var name, invalid string
+	var results []string
+	err = updateCard(ctx, func(card *storage.CharacterCard) error {
+		name = card.Name
+		for _, change := range changes {
+			value, process, err := ctx.Engine.EvalInt(change.expr)
+			if err != nil {
+				invalid = fmt.Sprintf("%s 的数值有误: %v", change.name, err)
+				return err
+			}
+			rolled := ""
+			if process != "" {
+				rolled = fmt.Sprintf("%s=%d", change.expr, value)
+			}
+
+			old, had := card.Int(change.name)
+			switch change.delta {
+			case "":
+				card.SetInt(change.name, value)
+				switch {
+				case had && old != value:
+					results = append(results, fmt.Sprintf("%s %d→%d", change.name, old, value))
+				case rolled != "":
+					results = append(results, fmt.Sprintf("%s %d (%s)", change.name, value, rolled))
+				default:
+					results = append(results, fmt.Sprintf("%s %d", change.name, value))
+				}
+			default:
+				if change.delta == "-" {
+					value = -value
+				}
+				card.SetInt(change.name, old+value)
+				if rolled == "" {
+					rolled = change.expr
+				}
+				results = append(results, fmt.Sprintf("%s %d→%d (%s%s)", change.name, old, old+value, change.delta, rolled))
+			}
+		}
+		return nil
+	})
+	switch {
+	case invalid != "":
+		return invalid
+	case err != nil:
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+	return fmt.Sprintf("已更新 %s 的属性: %s", name, strings.Join(results, "，"))
+}
+
+// showCard 列出当前人物卡的属性，names 不为空时只列出指定属性
+func showCard(ctx *CommandContext, names []string) string {
+	card, ok := ctx.Storage.ActiveCard(ctx.PlayerID, ctx.GroupID)
+	if !ok {
+		return "你在本群还没有人物卡，请先使用 .st 记录属性"
+	}
+
+	if len(names) == 0 {
+		for _, name := range coreAttrs {
+			if _, ok := card.Attrs[name]; ok {
+				names = append(names, name)
+			}
+		}
+		var others []string
+		for name := range card.Attrs {
+			if !slices.Contains(coreAttrs, name) {
+				others = append(others, name)
+			}
+		}
+		sort.Strings(others)
+		names = append(names, others...)
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%s 还没有记录任何属性", card.Name)
+	}
+
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		name = canonicalAttr(name)
+		value := "未记录"
+		if v, ok := card.Int(name); ok {
+			value = strconv.Itoa(v)
+		} else if v, ok := card.Attrs[name]; ok {
+			value = fmt.Sprint(v)
+		}
+		items = append(items, fmt.Sprintf("%s:%s", name, value))
+	}
+	return fmt.Sprintf("%s 的属性:\n%s", card.Name, strings.Join(items, " "))
+}
@@ -0,0 +1,109 @@
+package dice
+
+import (
+	"fmt"
+	"island/rng"
+	"island/storage"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newCardTestRegistry 创建使用临时数据目录的指令注册表
+func newCardTestRegistry(t *testing.T, dir string) (*CommandRegistry, *storage.Storage) {
+	t.Helper()
+	store, err := storage.NewAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewCommandRegistry()
+	registry.SetStorage(store)
+	return registry, store
+}
+
+// recordSuffix 掷骰记录编号后缀，比较回复时去掉
+var recordSuffix = regexp.MustCompile(`\n\(记录 #\d+\)$`)
+
+// runCommand 以玩家 player 的身份在群 groupID 中执行指令，随机数依次取 draws，返回去掉记录编号的回复
+func runCommand(registry *CommandRegistry, player, groupID int64, cmd string, draws ...int) string {
+	engine := NewWithSource(rng.NewReplayValues(draws...))
+	reply := registry.Process(cmd, &CommandContext{PlayerID: player, GroupID: groupID, Engine: engine})
+	return recordSuffix.ReplaceAllString(reply, "")
+}
+
+// TestStCommand .st 记录、增减和展示人物卡属性，并按群区分当前人物卡
+func TestStCommand(t *testing.T) {
+	dir := t.TempDir()
+	registry, store := newCardTestRegistry(t, dir)
+
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".st 力量 70 敏捷65 HP:12 san=60 侦察50", nil, "已更新 未命名角色 的属性: 力量 70，敏捷 65，生命值 12，理智 60，侦查 50"},
+		{".st hp-3", nil, "已更新 未命名角色 的属性: 生命值 12→9 (-3)"},
+		{".st 理智-1d6 力量75", []int{3}, "已更新 未命名角色 的属性: 理智 60→56 (-1d6=4)，力量 70→75"},
+		{".st show", nil, "未命名角色 的属性:\n力量:75 敏捷:65 理智:56 生命值:9 侦查:50"},
+		{".st show str 图书馆", nil, "未命名角色 的属性:\n力量:75 图书馆:未记录"},
+		{".st 力量", nil, "属性格式有误，无法识别: 力量\n例如: .st 力量70 敏捷65 或 .st hp-3"},
+	}
+	for _, tt := range tests {
+		got := runCommand(registry, 1, 2, tt.cmd, tt.draws...)
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+
+	card, ok := store.ActiveCard(1, 2)
+	if !ok {
+		t.Fatal("active card was not saved")
+	}
+	if hp, _ := card.Int("生命值"); hp != 9 {
+		t.Errorf("saved hp = %d, want 9", hp)
+	}
+	if got := runCommand(registry, 1, 3, ".st show"); !strings.HasPrefix(got, "你在本群还没有人物卡") {
+		t.Errorf("other group .st show = %q", got)
+	}
+
+	// 重新加载后数据仍在
+	reloaded, err := storage.NewAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, _ = reloaded.ActiveCard(1, 2)
+	if card == nil {
+		t.Fatal("active card was not persisted")
+	}
+	if san, _ := card.Int("理智"); san != 56 {
+		t.Errorf("reloaded san = %d, want 56", san)
+	}
+}
+
+// TestStConcurrent 同一玩家同时发送的多条 .st 不会互相覆盖修改
+func TestStConcurrent(t *testing.T) {
+	registry, store := newCardTestRegistry(t, t.TempDir())
+	runCommand(registry, 1, 2, ".st 幸运0")
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runCommand(registry, 1, 2, fmt.Sprintf(".st 技能%c 50 幸运+1", 'a'+i))
+		}()
+	}
+	wg.Wait()
+
+	card, _ := store.ActiveCard(1, 2)
+	for i := 0; i < n; i++ {
+		if _, ok := card.Int(fmt.Sprintf("技能%c", 'a'+i)); !ok {
+			t.Errorf("技能%c was lost", 'a'+i)
+		}
+	}
+	if luck, _ := card.Int("幸运"); luck != n {
+		t.Errorf("幸运 = %d, want %d", luck, n)
+	}
+}
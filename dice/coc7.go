@@ -0,0 +1,439 @@
+package dice
+
+import (
+	"fmt"
+	"island/parser"
+	"island/storage"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CoC7BaseSkills CoC7 调查员技能的基础值，人物卡中没有记录时使用
+var CoC7BaseSkills = map[string]int{
+	"会计": 5, "人类学": 1, "估价": 5, "考古学": 1, "艺术与手艺": 5, "魅惑": 15,
+	"攀爬": 20, "信用": 0, "克苏鲁神话": 0, "乔装": 5, "驾驶": 20,
+	"电气维修": 10, "电子学": 1, "话术": 5, "斗殴": 25, "剑": 20, "鞭": 5,
+	"手枪": 20, "步霰": 25, "冲锋枪": 15, "弓": 15, "急救": 30, "历史": 5,
+	"恐吓": 15, "跳跃": 20, "外语": 1, "法律": 5, "图书馆": 20, "聆听": 20,
+	"锁匠": 1, "机械维修": 10, "医学": 1, "博物学": 10, "导航": 10,
+	"神秘学": 5, "操作重型机械": 1, "说服": 10, "精神分析": 1, "心理学": 10,
+	"骑术": 5, "科学": 1, "妙手": 10, "侦查": 25, "潜行": 20, "生存": 10,
+	"游泳": 20, "投掷": 20, "追踪": 10, "计算机使用": 5,
+}
+
+// coc7DerivedSkills 基础值由属性决定的技能
+var coc7DerivedSkills = map[string]func(card *storage.CharacterCard) (int, bool){
+	"闪避": func(card *storage.CharacterCard) (int, bool) {
+		dex, ok := card.Int("敏捷")
+		return dex / 2, ok
+	},
+	"母语": func(card *storage.CharacterCard) (int, bool) {
+		return card.Int("教育")
+	},
+}
+
+// 检定难度，困难和极难检定需要达到对应的成功等级
+const (
+	DifficultyRegular = iota // 常规
+	DifficultyHard           // 困难，目标值为技能值的一半
+	DifficultyExtreme        // 极难，目标值为技能值的五分之一
+)
+
+// difficultyPrefixes 检定难度的前缀写法
+var difficultyPrefixes = map[string]int{
+	"困难": DifficultyHard, "极难": DifficultyExtreme,
+	"hard": DifficultyHard, "extreme": DifficultyExtreme,
+}
+
+// difficultyTarget 按难度计算目标值
+func difficultyTarget(skill, difficulty int) int {
+	switch difficulty {
+	case DifficultyHard:
+		return skill / 2
+	case DifficultyExtreme:
+		return skill / 5
+	}
+	return skill
+}
+
+// skillCheckArgs 技能检定的参数，例如 困难侦查+10、侦查50、70
+type skillCheckArgs struct {
+	difficulty int
+	name       string
+	value      int  // 指令中直接给出的技能值
+	hasValue   bool // 是否直接给出了技能值
+	modifier   int  // 技能值的临时加减
+}
+
+// parseSkillCheckArgs 解析技能检定参数
+func parseSkillCheckArgs(input string) (*skillCheckArgs, bool) {
+	args := &skillCheckArgs{}
+	rest := strings.TrimSpace(input)
+	for prefix, difficulty := range difficultyPrefixes {
+		if after, ok := strings.CutPrefix(rest, prefix); ok {
+			args.difficulty = difficulty
+			rest = strings.TrimSpace(after)
+			break
+		}
+	}
+
+	end := strings.IndexAny(rest, "0123456789+- ")
+	if end == -1 {
+		end = len(rest)
+	}
+	args.name = canonicalAttr(rest[:end])
+	rest = strings.TrimSpace(rest[end:])
+
+	digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+	if digits > 0 {
+		args.value, _ = strconv.Atoi(rest[:digits])
+		args.hasValue = true
+		rest = strings.TrimSpace(rest[digits:])
+	}
+
+	if rest != "" {
+		modifier, err := strconv.Atoi(strings.ReplaceAll(rest, " ", ""))
+		if err != nil || (rest[0] != '+' && rest[0] != '-') {
+			return nil, false
+		}
+		args.modifier = modifier
+	}
+	return args, args.name != "" || args.hasValue
+}
+
+// parseBonusCheckArgs 解析 .rb/.rp 的参数，count 为紧跟指令的奖惩骰数量，省略时为 1
+// 指令后只有数字时视为技能值，例如 .rb70
+func parseBonusCheckArgs(count, rest string) (int, *skillCheckArgs, bool) {
+	if strings.TrimSpace(rest) == "" {
+		count, rest = "", count
+	}
+	n := 1
+	if count != "" {
+		n, _ = strconv.Atoi(count)
+	}
+	args, ok := parseSkillCheckArgs(rest)
+	return n, args, ok
+}
+
+// resolveSkill 查找技能值：先查当前人物卡，再查 CoC7 技能基础值
+// 返回的 card 为当前人物卡，没有时为 nil；base 表示使用了基础值
+func resolveSkill(ctx *CommandContext, name string) (value int, card *storage.CharacterCard, base bool, ok bool) {
+	card = currentCard(ctx)
+	value, base, ok = cardSkill(card, name)
+	return value, card, base, ok
+}
+
+// cardSkill 在人物卡中查找技能值，没有记录时使用 CoC7 技能基础值，card 可以为 nil
+func cardSkill(card *storage.CharacterCard, name string) (value int, base bool, ok bool) {
+	if card != nil {
+		if v, found := card.Int(name); found {
+			return v, false, true
+		}
+	}
+	if v, found := CoC7BaseSkills[name]; found {
+		return v, true, true
+	}
+	if derive, found := coc7DerivedSkills[name]; found && card != nil {
+		if v, found := derive(card); found {
+			return v, true, true
+		}
+	}
+	return 0, false, false
+}
+
+// currentCard 读取玩家在当前群使用的人物卡，未启用存储或没有人物卡时返回 nil
+func currentCard(ctx *CommandContext) *storage.CharacterCard {
+	if ctx.Storage == nil {
+		return nil
+	}
+	card, _ := ctx.Storage.ActiveCard(ctx.PlayerID, ctx.GroupID)
+	return card
+}
+
+// checkTarget 按参数查找技能值并生成检定名称，找不到技能时 errMsg 不为空
+func checkTarget(ctx *CommandContext, args *skillCheckArgs) (label string, value int, errMsg string) {
+	value = args.value
+	var card *storage.CharacterCard
+	base := false
+	if !args.hasValue {
+		var ok bool
+		value, card, base, ok = resolveSkill(ctx, args.name)
+		if !ok {
+			return "", 0, fmt.Sprintf("未找到技能 %s，请先使用 .st 记录，或直接给出技能值，例如 .ra %s50", args.name, args.name)
+		}
+	} else if args.name != "" {
+		card = currentCard(ctx)
+	}
+
+	label = args.name
+	if label == "" {
+		label = "技能"
+	}
+	switch args.difficulty {
+	case DifficultyHard:
+		label = "困难" + label
+	case DifficultyExtreme:
+		label = "极难" + label
+	}
+	if card != nil {
+		label = card.Name + " 的" + label
+	}
+	if base {
+		label += "(基础值)"
+	}
+	return label, value + args.modifier, ""
+}
+
+// skillCheck 按参数完成技能检定，reply 中带上人物卡名称和技能名
+func skillCheck(ctx *CommandContext, args *skillCheckArgs, rules CoC7Rules) string {
+	label, value, errMsg := checkTarget(ctx, args)
+	if errMsg != "" {
+		return errMsg
+	}
+	result := ctx.Engine.CoC7Roll(value, args.difficulty, rules)
+	rememberCheck(ctx, label, result)
+	return FormatCoC7Result(label, result)
+}
+
+// MAX_BONUS_DICE 一次检定最多使用的奖励骰或惩罚骰数量
+const MAX_BONUS_DICE = parser.MAX_BONUS_DICE
+
+// bonusCheck 带奖励骰（bonus > 0）或惩罚骰（bonus < 0）的技能检定
+func bonusCheck(ctx *CommandContext, args *skillCheckArgs, bonus int) string {
+	if bonus == 0 || bonus > MAX_BONUS_DICE || bonus < -MAX_BONUS_DICE {
+		return fmt.Sprintf("奖励骰和惩罚骰的数量必须在1-%d之间", MAX_BONUS_DICE)
+	}
+	label, value, errMsg := checkTarget(ctx, args)
+	if errMsg != "" {
+		return errMsg
+	}
+	result, err := ctx.Engine.CoC7BonusRoll(value, bonus, args.difficulty, coc7Rules(ctx))
+	if err != nil {
+		return fmt.Sprintf("检定出错: %v", err)
+	}
+	rememberCheck(ctx, label, result)
+	return FormatCoC7Result(label, result)
+}
+
+// SuccessLevel CoC7 检定的成功等级，数值越大结果越好
+type SuccessLevel int
+
+const (
+	LevelFumble   SuccessLevel = iota // 大失败
+	LevelFailure                      // 失败
+	LevelRegular                      // 成功
+	LevelHard                         // 困难成功
+	LevelExtreme                      // 极难成功
+	LevelCritical                     // 大成功
+)
+
+func (l SuccessLevel) String() string {
+	switch l {
+	case LevelFumble:
+		return "大失败"
+	case LevelFailure:
+		return "失败"
+	case LevelRegular:
+		return "成功"
+	case LevelHard:
+		return "困难成功"
+	case LevelExtreme:
+		return "极难成功"
+	case LevelCritical:
+		return "大成功"
+	}
+	return "未知"
+}
+
+// Succeeded 是否至少为普通成功
+func (l SuccessLevel) Succeeded() bool {
+	return l >= LevelRegular
+}
+
+// CoC7Rules 大成功和大失败的判定范围，可以按群设置房规
+type CoC7Rules struct {
+	Critical  int // 掷出不大于此值为大成功
+	Fumble    int // 目标值不小于 50 时，掷出不小于此值为大失败
+	FumbleLow int // 目标值小于 50 时，掷出不小于此值为大失败
+}
+
+// DefaultCoC7Rules 规则书的判定范围：01 大成功，目标值不足 50 时 96-100 大失败，否则 100 大失败
+var DefaultCoC7Rules = CoC7Rules{Critical: 1, Fumble: 100, FumbleLow: 96}
+
+// coc7Rules 返回当前群的 CoC7 规则，没有设置的部分使用规则书的范围
+func coc7Rules(ctx *CommandContext) CoC7Rules {
+	rules := DefaultCoC7Rules
+	if ctx.Storage == nil {
+		return rules
+	}
+	settings := ctx.Storage.GroupSettings(ctx.GroupID)
+	if settings.CoC7Critical > 0 {
+		rules.Critical = settings.CoC7Critical
+	}
+	if settings.CoC7Fumble > 0 {
+		rules.Fumble = settings.CoC7Fumble
+	}
+	if settings.CoC7FumbleLow > 0 {
+		rules.FumbleLow = settings.CoC7FumbleLow
+	}
+	return rules
+}
+
+// Resolve 判定 d100 结果的成功等级
+// 大成功需要检定成功（01 总是大成功），大失败需要未达到难度的目标值（100 总是大失败），
+// 大失败的范围按目标值判断，例如技能值 80 的困难检定目标值为 40，掷出 96-100 即为大失败
+func (r CoC7Rules) Resolve(roll, skill, difficulty int) SuccessLevel {
+	target := difficultyTarget(skill, difficulty)
+	fumble := r.Fumble
+	if target < 50 {
+		fumble = r.FumbleLow
+	}
+	switch {
+	case roll == 1 || (roll <= r.Critical && roll <= skill):
+		return LevelCritical
+	case roll == 100 || (roll >= fumble && roll > target):
+		return LevelFumble
+	case roll <= skill/5:
+		return LevelExtreme
+	case roll <= skill/2:
+		return LevelHard
+	case roll <= skill:
+		return LevelRegular
+	}
+	return LevelFailure
+}
+
+func (r CoC7Rules) String() string {
+	return fmt.Sprintf("大成功 1-%d，大失败 %d-100（目标值不足 50 时 %d-100）", r.Critical, r.Fumble, r.FumbleLow)
+}
+
+// CoC7Result 一次 CoC7 检定的结果
+type CoC7Result struct {
+	Roll       int
+	Skill      int
+	Difficulty int
+	Level      SuccessLevel
+	Bonus      int   // 奖励骰数量，惩罚骰为负数
+	Tens       []int // 使用奖惩骰时掷出的所有十位骰（0-9），第一个为原本的十位骰
+	Units      int   // 使用奖惩骰时的个位骰（0-9）
+}
+
+// Target 按难度计算的目标值
+func (r *CoC7Result) Target() int {
+	return difficultyTarget(r.Skill, r.Difficulty)
+}
+
+// Passed 是否达到难度要求，大成功总是通过，大失败总是不通过
+func (r *CoC7Result) Passed() bool {
+	switch r.Difficulty {
+	case DifficultyHard:
+		return r.Level >= LevelHard
+	case DifficultyExtreme:
+		return r.Level >= LevelExtreme
+	}
+	return r.Level.Succeeded()
+}
+
+// FormatCoC7Result 格式化检定结果，例如 "侦查检定 60 → 25 困难成功"
+func FormatCoC7Result(label string, r *CoC7Result) string {
+	switch {
+	case r.Bonus > 0:
+		label += fmt.Sprintf("(奖励骰×%d)", r.Bonus)
+	case r.Bonus < 0:
+		label += fmt.Sprintf("(惩罚骰×%d)", -r.Bonus)
+	}
+	result := fmt.Sprintf("%s检定 %d → %d %s", label, r.Skill, r.Roll, r.Level)
+	if r.Difficulty != DifficultyRegular {
+		result = fmt.Sprintf("%s检定 %d/%d → %d %s", label, r.Skill, r.Target(), r.Roll, r.Level)
+	}
+
+	switch {
+	case r.Level == LevelCritical || r.Level == LevelFumble:
+		result += "！"
+	case r.Level.Succeeded() && !r.Passed():
+		result += "，未达到难度要求，检定失败"
+	}
+
+	if len(r.Tens) > 0 {
+		tens := make([]string, len(r.Tens))
+		for i, t := range r.Tens {
+			tens[i] = strconv.Itoa(t * 10)
+		}
+		result += fmt.Sprintf(" (十位 %s，个位 %d)", strings.Join(tens, "/"), r.Units)
+	}
+	return result
+}
+
+// setCoCRuleRegex 匹配一条房规设置，例如 大成功5、大失败96
+var setCoCRuleRegex = regexp.MustCompile(`^(低技能大失败|大成功|大失败)\s*(\d+)\s*`)
+
+// SetCoCCommand .setcoc 指令 (设置本群的大成功和大失败范围)
+type SetCoCCommand struct {
+	BaseCommand
+}
+
+func NewSetCoCCommand() *SetCoCCommand {
+	return &SetCoCCommand{
+		BaseCommand: BaseCommand{
+			name:  "setcoc",
+			help:  ".setcoc [大成功N] [大失败N] [低技能大失败N] - 设置本群的大成功和大失败范围，.setcoc 默认 恢复规则书",
+			regex: regexp.MustCompile(`^setcoc\s*(.*)$`),
+		},
+	}
+}
+
+func (c *SetCoCCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *SetCoCCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return "用法: .setcoc [大成功N] [大失败N] [低技能大失败N]"
+	}
+	args := strings.TrimSpace(matches[1])
+	if args == "" {
+		return "本群 CoC7 规则: " + coc7Rules(ctx).String()
+	}
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法保存房规"
+	}
+
+	reset := args == "默认" || args == "default" || args == "0"
+	rules := coc7Rules(ctx)
+	if reset {
+		rules = DefaultCoC7Rules
+	}
+	for rest := args; !reset && rest != ""; {
+		m := setCoCRuleRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return fmt.Sprintf("无法识别: %s\n例如: .setcoc 大成功5 大失败96，或 .setcoc 默认", rest)
+		}
+		value, _ := strconv.Atoi(m[2])
+		if value < 1 || value > 100 {
+			return fmt.Sprintf("%s 的范围必须在1-100之间", m[1])
+		}
+		switch m[1] {
+		case "大成功":
+			rules.Critical = value
+		case "大失败":
+			rules.Fumble, rules.FumbleLow = value, value
+		case "低技能大失败":
+			rules.FumbleLow = value
+		}
+		rest = rest[len(m[0]):]
+	}
+
+	if !ctx.DryRun {
+		err := ctx.Storage.UpdateGroupSettings(ctx.GroupID, func(settings *storage.GroupSettings) {
+			settings.CoC7Critical = rules.Critical
+			settings.CoC7Fumble = rules.Fumble
+			settings.CoC7FumbleLow = rules.FumbleLow
+		})
+		if err != nil {
+			return fmt.Sprintf("保存房规失败: %v", err)
+		}
+	}
+	return "已设置本群 CoC7 规则: " + rules.String()
+}
@@ -0,0 +1,128 @@
+package dice
+
+import "testing"
+
+// TestSkillCheckFromCard .ra 从人物卡读取技能值，没有记录时使用基础值
+func TestSkillCheckFromCard(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".ra 侦查", []int{29}, "侦查(基础值)检定 25 → 30 失败"},
+		{".ra 70", []int{29}, "技能检定 70 → 30 困难成功"},
+		{".st 侦查60 敏捷50", nil, "已更新 未命名角色 的属性: 侦查 60，敏捷 50"},
+		{".ra 侦察", []int{29}, "未命名角色 的侦查检定 60 → 30 困难成功"},
+		{".ra 困难侦查", []int{29}, "未命名角色 的困难侦查检定 60/30 → 30 困难成功"},
+		{".ra 极难侦查", []int{29}, "未命名角色 的极难侦查检定 60/12 → 30 困难成功，未达到难度要求，检定失败"},
+		{".ra 侦查+10", []int{69}, "未命名角色 的侦查检定 70 → 70 成功"},
+		{".ra 侦查 -20", []int{49}, "未命名角色 的侦查检定 40 → 50 失败"},
+		{".ra 侦查50", []int{49}, "未命名角色 的侦查检定 50 → 50 成功"},
+		{".ra 闪避", []int{29}, "未命名角色 的闪避(基础值)检定 25 → 30 失败"},
+		{".ra 飞行", nil, "未找到技能 飞行，请先使用 .st 记录，或直接给出技能值，例如 .ra 飞行50"},
+		{".ra 侦查+x", nil, "用法: .ra [技能名][技能值]，例如 .ra 侦查、.ra 侦查50、.ra 困难侦查、.ra 侦查+10"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+// TestCoC7Resolve 成功等级的边界，以及房规对大成功和大失败范围的影响
+func TestCoC7Resolve(t *testing.T) {
+	house := CoC7Rules{Critical: 5, Fumble: 96, FumbleLow: 96}
+	tests := []struct {
+		rules      CoC7Rules
+		roll       int
+		skill      int
+		difficulty int
+		want       SuccessLevel
+	}{
+		{DefaultCoC7Rules, 1, 10, DifficultyRegular, LevelCritical},
+		{DefaultCoC7Rules, 2, 60, DifficultyRegular, LevelExtreme},
+		{DefaultCoC7Rules, 12, 60, DifficultyRegular, LevelExtreme},
+		{DefaultCoC7Rules, 13, 60, DifficultyRegular, LevelHard},
+		{DefaultCoC7Rules, 30, 60, DifficultyRegular, LevelHard},
+		{DefaultCoC7Rules, 31, 60, DifficultyRegular, LevelRegular},
+		{DefaultCoC7Rules, 60, 60, DifficultyRegular, LevelRegular},
+		{DefaultCoC7Rules, 61, 60, DifficultyRegular, LevelFailure},
+		{DefaultCoC7Rules, 95, 49, DifficultyRegular, LevelFailure},
+		{DefaultCoC7Rules, 96, 49, DifficultyRegular, LevelFumble},
+		{DefaultCoC7Rules, 99, 50, DifficultyRegular, LevelFailure},
+		{DefaultCoC7Rules, 100, 50, DifficultyRegular, LevelFumble},
+		{DefaultCoC7Rules, 100, 120, DifficultyRegular, LevelFumble},
+		{house, 5, 60, DifficultyRegular, LevelCritical},
+		{house, 5, 3, DifficultyRegular, LevelFailure},
+		{house, 96, 60, DifficultyRegular, LevelFumble},
+		{house, 97, 98, DifficultyRegular, LevelRegular},
+		// 大失败的范围按难度的目标值判断
+		{DefaultCoC7Rules, 95, 80, DifficultyHard, LevelFailure},
+		{DefaultCoC7Rules, 96, 80, DifficultyHard, LevelFumble},
+		{DefaultCoC7Rules, 96, 99, DifficultyHard, LevelFumble},
+		{DefaultCoC7Rules, 96, 100, DifficultyHard, LevelRegular},
+		{DefaultCoC7Rules, 99, 100, DifficultyHard, LevelRegular},
+		{DefaultCoC7Rules, 96, 60, DifficultyExtreme, LevelFumble},
+		{DefaultCoC7Rules, 12, 60, DifficultyExtreme, LevelExtreme},
+		{house, 96, 100, DifficultyExtreme, LevelFumble},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.Resolve(tt.roll, tt.skill, tt.difficulty); got != tt.want {
+			t.Errorf("%+v Resolve(%d, %d, %d) = %s, want %s", tt.rules, tt.roll, tt.skill, tt.difficulty, got, tt.want)
+		}
+	}
+}
+
+// TestSetCoC 房规按群保存，.rc 不受房规影响
+func TestSetCoC(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+
+	tests := []struct {
+		group int64
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{2, ".setcoc", nil, "本群 CoC7 规则: 大成功 1-1，大失败 100-100（目标值不足 50 时 96-100）"},
+		{2, ".setcoc 大成功5 大失败96", nil, "已设置本群 CoC7 规则: 大成功 1-5，大失败 96-100（目标值不足 50 时 96-100）"},
+		{2, ".ra 60", []int{4}, "技能检定 60 → 5 大成功！"},
+		{2, ".rc 60", []int{4}, "技能检定 60 → 5 极难成功"},
+		{3, ".ra 60", []int{4}, "技能检定 60 → 5 极难成功"},
+		{2, ".setcoc 大失败", nil, "无法识别: 大失败\n例如: .setcoc 大成功5 大失败96，或 .setcoc 默认"},
+		{2, ".setcoc 默认", nil, "已设置本群 CoC7 规则: 大成功 1-1，大失败 100-100（目标值不足 50 时 96-100）"},
+		{2, ".ra 60", []int{4}, "技能检定 60 → 5 极难成功"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, tt.group, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("group %d %s = %q, want %q", tt.group, tt.cmd, got, tt.want)
+		}
+	}
+}
+
+// TestBonusPenaltyCheck .rb/.rp 使用奖惩骰，显示所有十位骰
+func TestBonusPenaltyCheck(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+
+	// 抽取顺序: 原十位骰、个位骰、各个奖惩骰
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".rb2 70", []int{5, 3, 2, 7}, "技能(奖励骰×2)检定 70 → 23 困难成功 (十位 50/20/70，个位 3)"},
+		{".rb70", []int{5, 3, 8}, "技能(奖励骰×1)检定 70 → 53 成功 (十位 50/80，个位 3)"},
+		{".rp 70", []int{5, 3, 8}, "技能(惩罚骰×1)检定 70 → 83 失败 (十位 50/80，个位 3)"},
+		{".rp2 困难侦查", []int{1, 0, 0, 0}, "困难侦查(基础值)(惩罚骰×2)检定 25/12 → 100 大失败！ (十位 10/0/0，个位 0)"},
+		{".rb 50", []int{0, 0, 3}, "技能(奖励骰×1)检定 50 → 30 成功 (十位 0/30，个位 0)"},
+		{".rp 50", []int{3, 0, 0}, "技能(惩罚骰×1)检定 50 → 100 大失败！ (十位 30/0，个位 0)"},
+		{".rb11 50", nil, "奖励骰和惩罚骰的数量必须在1-10之间"},
+		{".rb", nil, "用法: .rb[奖励骰数] [技能名][技能值]，例如 .rb 侦查、.rb2 70"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,12 @@ package dice
 
 import (
 	"fmt"
+	"island/parser"
+	"island/rng"
+	"island/storage"
+	"log"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -20,6 +25,10 @@ type CommandContext struct {
 	GroupID  int64
 	Args     string
 	Engine   *Engine
+	Trace    *parser.TraceNode // 本次指令的掷骰求值树，供 Web 界面展示
+	RollID   int64             // 本次掷骰在掷骰记录中的编号，未记录时为 0
+	DryRun   bool              // 校验重放时为 true，指令不应修改已保存的数据
+	Storage  *storage.Storage  // 数据存储，未启用时为 nil
 }
 
 // BaseCommand 基础指令结构
@@ -48,8 +57,8 @@ func NewRollCommand() *RollCommand {
 	return &RollCommand{
 		BaseCommand: BaseCommand{
 			name: "r",
-			help: ".r [表达式] - 投掷骰子，例如 .r 3d6+5",
-			regex: regexp.MustCompile(`^r\s*(.+)$`),
+			help: ".r [表达式] [理由] - 投掷骰子，例如 .r 3d6+5",
+			regex: regexp.MustCompile(`^r\s*(.*)$`),
 		},
 	}
 }
@@ -63,7 +72,9 @@ func (c *RollCommand) Process(ctx *CommandContext) string {
 	if len(matches) < 2 {
 		return "用法: .r [骰子表达式]"
 	}
-	return ctx.Engine.Roll(matches[1])
+	reply, trace := ctx.Engine.RollWithTrace(matches[1])
+	ctx.Trace = trace
+	return reply
 }
 
 // RACheckCommand .ra 指令 (技能检定)
@@ -75,8 +86,8 @@ func NewRACheckCommand() *RACheckCommand {
 	return &RACheckCommand{
 		BaseCommand: BaseCommand{
 			name: "ra",
-			help: ".ra [技能值] - 技能检定",
-			regex: regexp.MustCompile(`^ra\s+(\d+)$`),
+			help: ".ra [技能名][技能值] - 技能检定，例如 .ra 70、.ra 侦查、.ra 困难侦查、.ra 侦查+10",
+			regex: regexp.MustCompile(`^ra\s*(.+)$`),
 		},
 	}
 }
@@ -88,14 +99,16 @@ func (c *RACheckCommand) Match(cmd string) bool {
 func (c *RACheckCommand) Process(ctx *CommandContext) string {
 	matches := c.regex.FindStringSubmatch(ctx.Args)
 	if len(matches) < 2 {
-		return "用法: .ra [技能值]"
+		return "用法: .ra [技能名][技能值]"
 	}
-	skillValue := 0
-	fmt.Sscanf(matches[1], "%d", &skillValue)
-	return ctx.Engine.CoC7SkillCheck(skillValue)
+	args, ok := parseSkillCheckArgs(matches[1])
+	if !ok {
+		return "用法: .ra [技能名][技能值]，例如 .ra 侦查、.ra 侦查50、.ra 困难侦查、.ra 侦查+10"
+	}
+	return skillCheck(ctx, args, coc7Rules(ctx))
 }
 
-// RBCheckCommand .rb 指令 (战斗检定)
+// RBCheckCommand .rb 指令 (奖励骰检定)
 type RBCheckCommand struct {
 	BaseCommand
 }
@@ -104,8 +117,8 @@ func NewRBCheckCommand() *RBCheckCommand {
 	return &RBCheckCommand{
 		BaseCommand: BaseCommand{
 			name: "rb",
-			help: ".rb [技能值] - 战斗检定",
-			regex: regexp.MustCompile(`^rb\s+(\d+)$`),
+			help: ".rb[奖励骰数] [技能名][技能值] - 奖励骰检定，例如 .rb 侦查、.rb2 70",
+			regex: regexp.MustCompile(`^rb(\d*)\s*(.*)$`),
 		},
 	}
 }
@@ -116,15 +129,48 @@ func (c *RBCheckCommand) Match(cmd string) bool {
 
 func (c *RBCheckCommand) Process(ctx *CommandContext) string {
 	matches := c.regex.FindStringSubmatch(ctx.Args)
-	if len(matches) < 2 {
-		return "用法: .rb [技能值]"
+	if len(matches) < 3 {
+		return "用法: .rb[奖励骰数] [技能名][技能值]"
+	}
+	count, args, ok := parseBonusCheckArgs(matches[1], matches[2])
+	if !ok {
+		return "用法: .rb[奖励骰数] [技能名][技能值]，例如 .rb 侦查、.rb2 70"
+	}
+	return bonusCheck(ctx, args, count)
+}
+
+// RPCheckCommand .rp 指令 (惩罚骰检定)
+type RPCheckCommand struct {
+	BaseCommand
+}
+
+func NewRPCheckCommand() *RPCheckCommand {
+	return &RPCheckCommand{
+		BaseCommand: BaseCommand{
+			name: "rp",
+			help: ".rp[惩罚骰数] [技能名][技能值] - 惩罚骰检定，例如 .rp 70、.rp2 侦查",
+			regex: regexp.MustCompile(`^rp(\d*)\s*(.*)$`),
+		},
+	}
+}
+
+func (c *RPCheckCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *RPCheckCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 3 {
+		return "用法: .rp[惩罚骰数] [技能名][技能值]"
 	}
-	skillValue := 0
-	fmt.Sscanf(matches[1], "%d", &skillValue)
-	return ctx.Engine.CoC7SkillCheck(skillValue)
+	count, args, ok := parseBonusCheckArgs(matches[1], matches[2])
+	if !ok {
+		return "用法: .rp[惩罚骰数] [技能名][技能值]，例如 .rp 70、.rp2 侦查"
+	}
+	return bonusCheck(ctx, args, -count)
 }
 
-// RCCheckCommand .rc 指令 (驾驶检定)
+// RCCheckCommand .rc 指令 (规则书检定，不使用本群房规)
 type RCCheckCommand struct {
 	BaseCommand
 }
@@ -133,8 +179,8 @@ func NewRCCheckCommand() *RCCheckCommand {
 	return &RCCheckCommand{
 		BaseCommand: BaseCommand{
 			name: "rc",
-			help: ".rc [技能值] - 驾驶检定",
-			regex: regexp.MustCompile(`^rc\s+(\d+)$`),
+			help: ".rc [技能名][技能值] - 按规则书判定大成功和大失败的技能检定",
+			regex: regexp.MustCompile(`^rc\s*(.+)$`),
 		},
 	}
 }
@@ -146,11 +192,13 @@ func (c *RCCheckCommand) Match(cmd string) bool {
 func (c *RCCheckCommand) Process(ctx *CommandContext) string {
 	matches := c.regex.FindStringSubmatch(ctx.Args)
 	if len(matches) < 2 {
-		return "用法: .rc [技能值]"
+		return "用法: .rc [技能名][技能值]"
+	}
+	args, ok := parseSkillCheckArgs(matches[1])
+	if !ok {
+		return "用法: .rc [技能名][技能值]，例如 .rc 侦查、.rc 65"
 	}
-	skillValue := 0
-	fmt.Sscanf(matches[1], "%d", &skillValue)
-	return ctx.Engine.CoC7SkillCheck(skillValue)
+	return skillCheck(ctx, args, DefaultCoC7Rules)
 }
 
 // SCCheckCommand .sc 指令 (理智检定)
@@ -158,12 +206,15 @@ type SCCheckCommand struct {
 	BaseCommand
 }
 
+// scArgsRegex 匹配 .sc 的参数：成功损失/失败损失 [理智值]
+var scArgsRegex = regexp.MustCompile(`^([^/\s]+)/(\S+)(?:\s+(\d+))?$`)
+
 func NewSCCheckCommand() *SCCheckCommand {
 	return &SCCheckCommand{
 		BaseCommand: BaseCommand{
 			name: "sc",
-			help: ".sc [成功值]/[失败值] - 理智检定",
-			regex: regexp.MustCompile(`^sc\s+(\d+)/(\d+)$`),
+			help: ".sc [成功损失]/[失败损失] [理智值] - 理智检定，例如 .sc 1/1d6+1；.sc reset 开始新的场次",
+			regex: regexp.MustCompile(`^sc\s*(.*)$`),
 		},
 	}
 }
@@ -174,14 +225,18 @@ func (c *SCCheckCommand) Match(cmd string) bool {
 
 func (c *SCCheckCommand) Process(ctx *CommandContext) string {
 	matches := c.regex.FindStringSubmatch(ctx.Args)
-	if len(matches) < 3 {
-		return "用法: .sc [成功值]/[失败值]"
+	if len(matches) < 2 {
+		return "用法: .sc [成功损失]/[失败损失] [理智值]"
+	}
+	args := strings.TrimSpace(matches[1])
+	if args == "reset" || args == "新场次" {
+		return resetSanitySession(ctx)
 	}
-	successValue := 0
-	failValue := 0
-	fmt.Sscanf(matches[1], "%d", &successValue)
-	fmt.Sscanf(matches[2], "%d", &failValue)
-	return ctx.Engine.CoC7SanCheck(successValue, failValue)
+	m := scArgsRegex.FindStringSubmatch(args)
+	if m == nil {
+		return "用法: .sc [成功损失]/[失败损失] [理智值]，例如 .sc 1/1d6+1、.sc 0/1d4 60"
+	}
+	return sanCheck(ctx, m[1], m[2], m[3])
 }
 
 // ENCheckCommand .en 指令 (成长检定)
@@ -193,8 +248,8 @@ func NewENCheckCommand() *ENCheckCommand {
 	return &ENCheckCommand{
 		BaseCommand: BaseCommand{
 			name: "en",
-			help: ".en [技能值] - 成长检定",
-			regex: regexp.MustCompile(`^en\s+(\d+)$`),
+			help: ".en [技能名]... - 成长检定，成长后保存到人物卡",
+			regex: regexp.MustCompile(`^en\s*(.+)$`),
 		},
 	}
 }
@@ -206,11 +261,9 @@ func (c *ENCheckCommand) Match(cmd string) bool {
 func (c *ENCheckCommand) Process(ctx *CommandContext) string {
 	matches := c.regex.FindStringSubmatch(ctx.Args)
 	if len(matches) < 2 {
-		return "用法: .en [技能值]"
+		return "用法: .en [技能名]... 或 .en [技能值]"
 	}
-	skillValue := 0
-	fmt.Sscanf(matches[1], "%d", &skillValue)
-	return ctx.Engine.CoC7GrowthCheck(skillValue)
+	return growthCheck(ctx, matches[1])
 }
 
 // COC7Command .coc7 指令
@@ -222,8 +275,8 @@ func NewCOC7Command() *COC7Command {
 	return &COC7Command{
 		BaseCommand: BaseCommand{
 			name: "coc7",
-			help: ".coc7 - 生成COC7版角色",
-			regex: regexp.MustCompile(`^coc7$`),
+			help: ".coc7 [数量] - 生成COC7版调查员属性，.coc7 save [序号] [角色名] [职业] 保存为人物卡",
+			regex: regexp.MustCompile(`^coc7\s*(.*)$`),
 		},
 	}
 }
@@ -233,7 +286,11 @@ func (c *COC7Command) Match(cmd string) bool {
 }
 
 func (c *COC7Command) Process(ctx *CommandContext) string {
-	return ctx.Engine.CoC7RollAttributes()
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return "用法: .coc7 [数量] 或 .coc7 save [序号] [角色名] [职业]"
+	}
+	return coc7Generate(ctx, matches[1])
 }
 
 // TICommand .ti 指令 (临时疯狂)
@@ -245,7 +302,7 @@ func NewTICommand() *TICommand {
 	return &TICommand{
 		BaseCommand: BaseCommand{
 			name: "ti",
-			help: ".ti - 临时疯狂表",
+			help: ".ti - 疯狂发作-即时症状",
 			regex: regexp.MustCompile(`^ti$`),
 		},
 	}
@@ -256,7 +313,7 @@ func (c *TICommand) Match(cmd string) bool {
 }
 
 func (c *TICommand) Process(ctx *CommandContext) string {
-	return ctx.Engine.CoC7TempInsanity()
+	return rollMadness(ctx, MadnessRealtime)
 }
 
 // LICommand .li 指令 (长期疯狂)
@@ -268,7 +325,7 @@ func NewLICommand() *LICommand {
 	return &LICommand{
 		BaseCommand: BaseCommand{
 			name: "li",
-			help: ".li - 长期疯狂表",
+			help: ".li - 疯狂发作-总结症状",
 			regex: regexp.MustCompile(`^li$`),
 		},
 	}
@@ -279,7 +336,7 @@ func (c *LICommand) Match(cmd string) bool {
 }
 
 func (c *LICommand) Process(ctx *CommandContext) string {
-	return ctx.Engine.CoC7LongInsanity()
+	return rollMadness(ctx, MadnessSummary)
 }
 
 // DNDStatCommand .dnd 指令
@@ -319,8 +376,8 @@ func NewDNDInitCommand() *DNDInitCommand {
 	return &DNDInitCommand{
 		BaseCommand: BaseCommand{
 			name: "init",
-			help: ".init [先攻加值] - 先攻检定",
-			regex: regexp.MustCompile(`^init\s+(\d+)$`),
+			help: ".init [先攻加值|list|next|del|clear] - 先攻检定，或查看、推进和结束本群的先攻列表",
+			regex: regexp.MustCompile(`^init\s*(\S*)\s*(.*)$`),
 		},
 	}
 }
@@ -331,12 +388,26 @@ func (c *DNDInitCommand) Match(cmd string) bool {
 
 func (c *DNDInitCommand) Process(ctx *CommandContext) string {
 	matches := c.regex.FindStringSubmatch(ctx.Args)
-	if len(matches) < 2 {
-		return "用法: .init [先攻加值]"
+	if len(matches) < 3 {
+		return initUsage
+	}
+	sub, args := matches[1], strings.TrimSpace(matches[2])
+	switch {
+	case sub == "" && args == "":
+		return dndInitiative(ctx)
+	case sub == "list" && args == "":
+		return listInitiative(ctx)
+	case sub == "next" && args == "":
+		return nextInitiative(ctx)
+	case sub == "clear" && args == "":
+		return clearInitiative(ctx)
+	case sub == "del" && args != "":
+		return removeCombatant(ctx, args)
+	case attackBonusRegex.MatchString(sub) && args == "":
+		mod, _ := strconv.Atoi(sub)
+		return ctx.Engine.DnD5EInitiative(mod)
 	}
-	mod := 0
-	fmt.Sscanf(matches[1], "%d", &mod)
-	return ctx.Engine.DnD5EInitiative(mod)
+	return initUsage
 }
 
 // DNDAttackCommand .attack 指令
@@ -344,12 +415,15 @@ type DNDAttackCommand struct {
 	BaseCommand
 }
 
+// attackBonusRegex 直接给出的攻击加值
+var attackBonusRegex = regexp.MustCompile(`^[+\-]?\d+$`)
+
 func NewDNDAttackCommand() *DNDAttackCommand {
 	return &DNDAttackCommand{
 		BaseCommand: BaseCommand{
 			name: "attack",
-			help: ".attack [攻击加值] - 攻击检定",
-			regex: regexp.MustCompile(`^attack\s+(\d+)$`),
+			help: ".attack [武器或攻击加值] - 攻击检定，给出武器名时按人物卡计算加值",
+			regex: regexp.MustCompile(`^attack\s*(.+)$`),
 		},
 	}
 }
@@ -361,16 +435,21 @@ func (c *DNDAttackCommand) Match(cmd string) bool {
 func (c *DNDAttackCommand) Process(ctx *CommandContext) string {
 	matches := c.regex.FindStringSubmatch(ctx.Args)
 	if len(matches) < 2 {
-		return "用法: .attack [攻击加值]"
+		return "用法: .attack [武器或攻击加值] [adv/dis]"
+	}
+	input, advantage, cancelled := parseAdvantage(matches[1])
+	if !attackBonusRegex.MatchString(input) {
+		return withCancelNote(dndAttack(ctx, input, advantage), cancelled)
 	}
-	bonus := 0
-	fmt.Sscanf(matches[1], "%d", &bonus)
-	return ctx.Engine.DnD5EAttack(bonus)
+	bonus, _ := strconv.Atoi(input)
+	r := ctx.Engine.RollD20Advantage(bonus, advantage)
+	return withCancelNote(FormatAttack("攻击检定", r)+critDamagePrompt(r, "[伤害表达式]"), cancelled)
 }
 
 // CommandRegistry 指令注册表
 type CommandRegistry struct {
 	commands []CommandHandler
+	storage  *storage.Storage // 为空时不记录掷骰
 }
 
 // NewCommandRegistry 创建指令注册表
@@ -379,10 +458,11 @@ func NewCommandRegistry() *CommandRegistry {
 		commands: make([]CommandHandler, 0),
 	}
 	
-	// 注册所有内置指令
-	r.commands = append(r.commands, NewRollCommand())
+	// 注册所有内置指令，.rav 需要在 .ra 之前
+	r.commands = append(r.commands, NewRAVCommand())
 	r.commands = append(r.commands, NewRACheckCommand())
 	r.commands = append(r.commands, NewRBCheckCommand())
+	r.commands = append(r.commands, NewRPCheckCommand())
 	r.commands = append(r.commands, NewRCCheckCommand())
 	r.commands = append(r.commands, NewSCCheckCommand())
 	r.commands = append(r.commands, NewENCheckCommand())
@@ -391,7 +471,27 @@ func NewCommandRegistry() *CommandRegistry {
 	r.commands = append(r.commands, NewLICommand())
 	r.commands = append(r.commands, NewDNDStatCommand())
 	r.commands = append(r.commands, NewDNDInitCommand())
+	r.commands = append(r.commands, NewRICommand())
+	r.commands = append(r.commands, NewConditionCommand())
 	r.commands = append(r.commands, NewDNDAttackCommand())
+	r.commands = append(r.commands, NewDNDCheckCommand())
+	r.commands = append(r.commands, NewDNDSaveCommand())
+	r.commands = append(r.commands, NewDNDAdvantageCommand())
+	r.commands = append(r.commands, NewDNDDisadvantageCommand())
+	r.commands = append(r.commands, NewDamageCommand())
+	r.commands = append(r.commands, NewHPCommand())
+	r.commands = append(r.commands, NewDeathSaveCommand())
+	r.commands = append(r.commands, NewPcCommand())
+	r.commands = append(r.commands, NewVerifyCommand(r))
+	r.commands = append(r.commands, NewDistCommand())
+	r.commands = append(r.commands, NewStCommand())
+	r.commands = append(r.commands, NewSetCoCCommand())
+	r.commands = append(r.commands, NewContestCommand())
+	r.commands = append(r.commands, NewPushCommand())
+	r.commands = append(r.commands, NewLuckCommand())
+
+	// .r 会匹配所有以 r 开头的输入，必须最后注册
+	r.commands = append(r.commands, NewRollCommand())
 	
 	return r
 }
@@ -402,11 +502,14 @@ func (r *CommandRegistry) Process(cmd string, ctx *CommandContext) string {
 	cmd = strings.TrimPrefix(cmd, ".")
 	cmd = strings.TrimSpace(cmd)
 	ctx.Args = cmd
+	if ctx.Storage == nil {
+		ctx.Storage = r.storage
+	}
 	
 	// 匹配指令
 	for _, c := range r.commands {
 		if c.Match(cmd) {
-			return c.Process(ctx)
+			return r.processAndRecord(c, ctx)
 		}
 	}
 	
@@ -414,28 +517,96 @@ func (r *CommandRegistry) Process(cmd string, ctx *CommandContext) string {
 	return "未知指令，请输入 .help 查看帮助"
 }
 
+// SetStorage 设置数据存储，设置后每次掷骰都会写入掷骰记录
+func (r *CommandRegistry) SetStorage(s *storage.Storage) {
+	r.storage = s
+}
+
+// Storage 返回数据存储，未设置时为 nil
+func (r *CommandRegistry) Storage() *storage.Storage {
+	return r.storage
+}
+
+// groupFiles 指令可能读取的群数据文件，掷骰时随记录保存，校验时在其上重放
+var groupFiles = []string{OCCUPATION_FILE, CONDITION_FILE, MADNESS_FILE}
+
+// processAndRecord 执行指令并记录其间的随机数抽取，有抽取的指令写入掷骰记录
+func (r *CommandRegistry) processAndRecord(c CommandHandler, ctx *CommandContext) string {
+	if r.storage == nil || ctx.DryRun || ctx.Engine == nil {
+		return c.Process(ctx)
+	}
+
+	state := r.storage.Snapshot(ctx.PlayerID, ctx.GroupID, mentions(ctx.Args), groupFiles)
+	engine := ctx.Engine
+	recorder := rng.NewRecorder(engine.Source())
+	ctx.Engine = engine.WithSource(recorder)
+	output := c.Process(ctx)
+	ctx.Engine = engine
+
+	draws := recorder.Draws()
+	if len(draws) == 0 {
+		return output
+	}
+
+	entry := &storage.RollHistory{
+		PlayerID:   ctx.PlayerID,
+		GroupID:    ctx.GroupID,
+		Expression: ctx.Args,
+		Result:     output,
+		Draws:      draws,
+		State:      state,
+	}
+	if err := r.storage.AppendRoll(entry); err != nil {
+		log.Printf("写入掷骰记录失败: %v", err)
+		return output
+	}
+	ctx.RollID = entry.ID
+	return fmt.Sprintf("%s\n(记录 #%d)", output, entry.ID)
+}
+
 // GetHelp 获取所有指令的帮助
 func (r *CommandRegistry) GetHelp() string {
 	var lines []string
 	lines = append(lines, "可用指令：")
 	lines = append(lines, "")
 	lines = append(lines, "基础骰子：")
-	lines = append(lines, "  .r [表达式] - 投掷骰子")
+	lines = append(lines, "  .r [表达式] [理由] - 投掷骰子，支持 kh/kl、df、p/b、a、c 等")
+	lines = append(lines, "    修饰符: 3d6! 爆炸、!! 累加、!p 穿透、2d6r<3 重骰、ro1 重骰一次、5d10>=8f1 成功计数")
+	lines = append(lines, "    重复: 6#3d6 独立投掷六次，.r 3#1d20+5 攻击三次")
+	lines = append(lines, "  .verify [编号] - 重放并校验掷骰记录")
+	lines = append(lines, "  .dist [表达式] - 计算精确分布（期望、标准差、概率）")
 	lines = append(lines, "")
 	lines = append(lines, "COC7相关：")
-	lines = append(lines, "  .coc7 - 生成COC7版角色")
-	lines = append(lines, "  .ra [技能值] - 技能检定")
-	lines = append(lines, "  .rb [技能值] - 战斗检定")
-	lines = append(lines, "  .rc [技能值] - 驾驶检定")
-	lines = append(lines, "  .sc [成功]/[失败] - 理智检定")
-	lines = append(lines, "  .en [技能值] - 成长检定")
-	lines = append(lines, "  .ti - 临时疯狂表")
-	lines = append(lines, "  .li - 长期疯狂表")
+	lines = append(lines, "  .coc7 [数量] - 生成COC7版调查员属性，.coc7 save [序号] [角色名] [职业] 保存为人物卡")
+	lines = append(lines, "  .st [属性][数值] - 记录人物卡属性，支持 hp-3 增减，.st show 查看")
+	lines = append(lines, "  .ra [技能名][技能值] - 技能检定，可从人物卡读取，支持 困难/极难 前缀和 +/- 调整")
+	lines = append(lines, "  .rb[N] [技能名][技能值] - 奖励骰检定，例如 .rb2 侦查")
+	lines = append(lines, "  .rp[N] [技能名][技能值] - 惩罚骰检定，例如 .rp 70")
+	lines = append(lines, "  .rc [技能名][技能值] - 规则书检定，不使用本群房规")
+	lines = append(lines, "  .rav [技能] [对方技能] @对方 - 对抗检定，成功等级高者胜，相同时技能值高者胜，NPC 写作 .rav 斗殴 邪教徒50")
+	lines = append(lines, "  .push - 孤注一掷，重新进行上一次失败的检定")
+	lines = append(lines, "  .luck [点数] - 消耗幸运使上一次失败的检定成功")
+	lines = append(lines, "  .setcoc [大成功N] [大失败N] [低技能大失败N] - 设置本群大成功/大失败房规，.setcoc 默认 恢复规则书")
+	lines = append(lines, "  .sc [成功损失]/[失败损失] [理智值] - 理智检定并扣除人物卡理智，.sc reset 开始新的场次")
+	lines = append(lines, "  .en [技能名]... - 成长检定，成长后保存到人物卡")
+	lines = append(lines, "  .ti - 疯狂发作-即时症状（持续1d10轮）")
+	lines = append(lines, "  .li - 疯狂发作-总结症状（持续1d10小时）")
 	lines = append(lines, "")
 	lines = append(lines, "DND5E相关：")
 	lines = append(lines, "  .dnd [属性] - 生成DND属性")
-	lines = append(lines, "  .init [加值] - 先攻检定")
-	lines = append(lines, "  .attack [加值] - 攻击检定")
+	lines = append(lines, "  .pc new [角色名] dnd5e - 新建人物卡，.pc set/prof/expert/weapon 设置属性、熟练项和武器")
+	lines = append(lines, "  .check [技能或属性] [adv/dis] - 技能检定，例如 .check stealth、.check 察觉 adv")
+	lines = append(lines, "  .save [属性] [adv/dis] - 豁免检定，例如 .save wis")
+	lines = append(lines, "  .adv/.dis [技能或属性] - 优势/劣势检定，同时有优势和劣势时相互抵消")
+	lines = append(lines, "  .init [加值] - 先攻检定，省略加值时读取人物卡")
+	lines = append(lines, "  .ri [名称][±加值] - 加入本群的先攻列表，同名的 NPC 自动编号，例如 .ri、.ri 哥布林+2、.ri 哥布林2=15")
+	lines = append(lines, "  .init list/next/del/clear - 查看先攻列表、轮到下一位、移出参与者、结束战斗")
+	lines = append(lines, "  .condition [名称] [状态] [持续时间] - 记录状态，随先攻推进减少，.condition info 目盲 查看说明")
+	lines = append(lines, "  .attack [武器或加值] [adv/dis] - 攻击检定，例如 .attack 长剑 adv")
+	lines = append(lines, "  .damage [伤害表达式或武器] [伤害类型] [crit] [@目标] - 伤害骰，例如 .damage 2d6+3 slashing、.damage 长剑 crit")
+	lines = append(lines, "  .hp [当前值/上限|±伤害|temp 临时生命值] - 生命值管理，例如 .hp 25/45、.hp -7、.hp +2d4+2")
+	lines = append(lines, "  .ds - 生命值为 0 时进行死亡豁免（CoC7 濒死时进行体质检定）")
+	lines = append(lines, "  .contest [技能][加值] [对方技能] @对方 - 对抗检定，NPC 写作 .contest 运动+5 食人魔+6")
 	
 	return strings.Join(lines, "\n")
 }
@@ -0,0 +1,265 @@
+package dice
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"island/storage"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CONDITION_FILE 群自定义状态说明的文件名，放在数据目录或 groups/<群号>/ 下
+const CONDITION_FILE = "conditions.json"
+
+// ROUNDS_PER_MINUTE 一分钟的轮数
+const ROUNDS_PER_MINUTE = 10
+
+//go:embed tables/conditions.json
+var defaultConditionData []byte
+
+// ConditionInfo 状态的说明和别名
+type ConditionInfo struct {
+	Aliases []string `json:"aliases,omitempty"`
+	Text    string   `json:"text"`
+}
+
+// durationRegex 匹配状态的持续时间，例如 3、3轮、1分钟、10r、1min
+var durationRegex = regexp.MustCompile(`^(\d+)\s*(轮|回合|r|rounds?|分钟|分|m|min|minutes?)?$`)
+
+const conditionUsage = "用法:\n" +
+	".condition [名称] [状态] [持续时间] - 为先攻列表中的参与者添加状态，省略名称时为自己添加，例如 .condition 哥布林 中毒 3、.condition 目盲 1分钟\n" +
+	".condition [名称] -[状态] - 移除状态\n" +
+	".condition info [状态] - 查看状态说明"
+
+// parseConditions 解析状态说明表
+func parseConditions(data []byte) (map[string]ConditionInfo, error) {
+	var conditions map[string]ConditionInfo
+	if err := json.Unmarshal(data, &conditions); err != nil {
+		return nil, err
+	}
+	for name, info := range conditions {
+		if info.Text == "" {
+			return nil, fmt.Errorf("状态 %s 没有说明", name)
+		}
+	}
+	return conditions, nil
+}
+
+// conditions 返回当前群使用的状态说明表，群自定义的状态按名称覆盖内置的状态
+func conditions(ctx *CommandContext) (map[string]ConditionInfo, error) {
+	result, err := parseConditions(defaultConditionData)
+	if err != nil {
+		return nil, fmt.Errorf("内置状态表有误: %w", err)
+	}
+	if ctx.Storage == nil {
+		return result, nil
+	}
+	data, err := ctx.Storage.ReadGroupFile(ctx.GroupID, CONDITION_FILE)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	custom, err := parseConditions(data)
+	if err != nil {
+		return nil, fmt.Errorf("本群的状态表文件 %s 有误: %w", CONDITION_FILE, err)
+	}
+	for name, info := range custom {
+		result[name] = info
+	}
+	return result, nil
+}
+
+// conditionName 将状态名或别名转换为状态表中的名称，不在表中的状态原样返回
+func conditionName(table map[string]ConditionInfo, name string) (string, bool) {
+	if _, ok := table[name]; ok {
+		return name, true
+	}
+	lower := strings.ToLower(name)
+	for canonical, info := range table {
+		if slices.Contains(info.Aliases, lower) {
+			return canonical, true
+		}
+	}
+	return name, false
+}
+
+// parseDuration 将持续时间转换为轮数，一分钟为 10 轮
+func parseDuration(text string) (int, bool) {
+	m := durationRegex.FindStringSubmatch(strings.ToLower(text))
+	if m == nil {
+		return 0, false
+	}
+	rounds, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "分钟", "分", "m", "min", "minute", "minutes":
+		rounds *= ROUNDS_PER_MINUTE
+	}
+	return rounds, rounds > 0
+}
+
+// formatConditions 列出参与者的状态，例如 "中毒 剩余2轮，倒地"
+func formatConditions(list []storage.Condition) string {
+	items := make([]string, len(list))
+	for i, c := range list {
+		items[i] = c.Name
+		if c.Rounds > 0 {
+			items[i] += fmt.Sprintf(" 剩余%d轮", c.Rounds)
+		}
+	}
+	return strings.Join(items, "，")
+}
+
+// tickConditions 参与者的回合开始时减少状态的剩余轮数，返回已经结束的状态
+func tickConditions(c *storage.Combatant) []string {
+	var ended []string
+	kept := c.Conditions[:0]
+	for _, condition := range c.Conditions {
+		if condition.Rounds > 0 {
+			condition.Rounds--
+			if condition.Rounds == 0 {
+				ended = append(ended, condition.Name)
+				continue
+			}
+		}
+		kept = append(kept, condition)
+	}
+	c.Conditions = kept
+	return ended
+}
+
+// conditionInfo 完成 .condition info：查看状态说明
+func conditionInfo(ctx *CommandContext, name string) string {
+	table, err := conditions(ctx)
+	if err != nil {
+		return err.Error()
+	}
+	if name == "" {
+		names := make([]string, 0, len(table))
+		for name := range table {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return "可查看的状态: " + strings.Join(names, "、")
+	}
+	canonical, ok := conditionName(table, name)
+	if !ok {
+		return fmt.Sprintf("没有状态 %s 的说明，使用 .condition info 查看所有状态", name)
+	}
+	return fmt.Sprintf("%s: %s", canonical, table[canonical].Text)
+}
+
+// setCondition 完成 .condition：为先攻列表中的参与者添加或移除状态
+func setCondition(ctx *CommandContext, input string) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用先攻列表"
+	}
+	table, err := conditions(ctx)
+	if err != nil {
+		return err.Error()
+	}
+	initiative, ok := ctx.Storage.Initiative(ctx.GroupID)
+	if !ok || len(initiative.Combatants) == 0 {
+		return "先攻列表为空，请先使用 .ri 加入先攻"
+	}
+
+	// 目标依次为 @ 的玩家、先攻列表中的名称和发送者自己
+	target, rest, mentioned := extractMention(input)
+	fields := strings.Fields(rest)
+	index := -1
+	switch {
+	case mentioned:
+		index = findCombatant(initiative, "", target)
+	case len(fields) > 1:
+		index = slices.IndexFunc(initiative.Combatants, func(c storage.Combatant) bool { return c.Name == fields[0] })
+		if index >= 0 {
+			fields = fields[1:]
+		}
+	}
+	if index < 0 && !mentioned && len(fields) > 0 {
+		index = findCombatant(initiative, "", ctx.PlayerID)
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return conditionUsage
+	}
+	if index < 0 {
+		return "目标不在先攻列表中，请先使用 .ri 加入先攻，或写出先攻列表中的名称"
+	}
+
+	combatant := &initiative.Combatants[index]
+	name, remove := strings.CutPrefix(fields[0], "-")
+	name, _ = conditionName(table, name)
+	existing := slices.IndexFunc(combatant.Conditions, func(c storage.Condition) bool { return c.Name == name })
+	var reply string
+	switch {
+	case remove && existing < 0:
+		return fmt.Sprintf("%s 没有 %s 状态", combatant.Name, name)
+	case remove:
+		combatant.Conditions = slices.Delete(combatant.Conditions, existing, existing+1)
+		reply = fmt.Sprintf("已移除 %s 的 %s 状态", combatant.Name, name)
+	default:
+		condition := storage.Condition{Name: name}
+		if len(fields) == 2 {
+			rounds, ok := parseDuration(fields[1])
+			if !ok {
+				return fmt.Sprintf("无法识别持续时间: %s，例如 3、3轮、1分钟", fields[1])
+			}
+			condition.Rounds = rounds
+		}
+		if existing >= 0 {
+			combatant.Conditions[existing] = condition
+		} else {
+			combatant.Conditions = append(combatant.Conditions, condition)
+		}
+		reply = fmt.Sprintf("%s 陷入 %s 状态，持续到移除", combatant.Name, name)
+		if condition.Rounds > 0 {
+			reply = fmt.Sprintf("%s 陷入 %s 状态，持续 %d 轮", combatant.Name, name, condition.Rounds)
+		}
+	}
+	if err := saveInitiative(ctx, initiative); err != nil {
+		return fmt.Sprintf("保存先攻列表失败: %v", err)
+	}
+	return reply
+}
+
+// ConditionCommand .condition 指令 (状态)
+type ConditionCommand struct {
+	BaseCommand
+}
+
+func NewConditionCommand() *ConditionCommand {
+	return &ConditionCommand{
+		BaseCommand: BaseCommand{
+			name:  "condition",
+			help:  ".condition [名称] [状态] [持续时间] - 记录先攻列表中参与者的状态，.condition info [状态] 查看说明",
+			regex: regexp.MustCompile(`^condition\s*(.*)$`),
+		},
+	}
+}
+
+func (c *ConditionCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *ConditionCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return conditionUsage
+	}
+	args := strings.TrimSpace(matches[1])
+	if args == "info" {
+		return conditionInfo(ctx, "")
+	}
+	if name, ok := strings.CutPrefix(args, "info "); ok {
+		return conditionInfo(ctx, strings.TrimSpace(name))
+	}
+	if args == "" {
+		return conditionUsage
+	}
+	return setCondition(ctx, args)
+}
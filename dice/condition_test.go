@@ -0,0 +1,52 @@
+package dice
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestConditions 状态按参与者记录，在其回合开始时减少剩余轮数并在 .init list 中列出
+func TestConditions(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+	runCommand(registry, 1, 2, ".condition 中毒")
+	runCommand(registry, 1, 2, ".pc new 艾琳 dnd5e")
+	runCommand(registry, 1, 2, ".ri=15")
+	runCommand(registry, 1, 2, ".ri 哥布林=12")
+
+	tests := []struct {
+		player int64
+		cmd    string
+		want   string
+	}{
+		{1, ".condition 哥布林 poisoned 2", "哥布林 陷入 中毒 状态，持续 2 轮"},
+		{1, ".condition 哥布林 倒地", "哥布林 陷入 倒地 状态，持续到移除"},
+		{1, ".condition 祝福 1分钟", "艾琳 陷入 祝福 状态，持续 10 轮"},
+		{1, ".condition @1 blinded 1", "艾琳 陷入 目盲 状态，持续 1 轮"},
+		{2, ".condition 目盲", "目标不在先攻列表中，请先使用 .ri 加入先攻，或写出先攻列表中的名称"},
+		{1, ".condition 哥布林 中毒 很久", "无法识别持续时间: 很久，例如 3、3轮、1分钟"},
+		{1, ".init list", "先攻列表（尚未开始，使用 .init next 开始第 1 轮）:\n" +
+			"1. 艾琳 15 [祝福 剩余10轮，目盲 剩余1轮]\n2. 哥布林 12 [中毒 剩余2轮，倒地]"},
+		{1, ".init next", "第 1 轮，轮到 艾琳 行动 [CQ:at,qq=1]\n艾琳 的 目盲 状态已结束\n当前状态: 祝福 剩余9轮"},
+		{1, ".init next", "第 1 轮，轮到 哥布林 行动\n当前状态: 中毒 剩余1轮，倒地"},
+		{1, ".init next", "第 2 轮，轮到 艾琳 行动 [CQ:at,qq=1]\n当前状态: 祝福 剩余8轮"},
+		{1, ".init next", "第 2 轮，轮到 哥布林 行动\n哥布林 的 中毒 状态已结束\n当前状态: 倒地"},
+		{1, ".condition 哥布林 -倒地", "已移除 哥布林 的 倒地 状态"},
+		{1, ".condition 哥布林 -倒地", "哥布林 没有 倒地 状态"},
+		{1, ".init list", "先攻列表（第 2 轮）:\n1. 艾琳 15 [祝福 剩余8轮]\n2. 哥布林 12 ← 当前行动"},
+		{1, ".condition 哥布林 中毒 3", "哥布林 陷入 中毒 状态，持续 3 轮"},
+		{1, ".ri 哥布林=18", "哥布林 的先攻设为 18\n已更新先攻列表"},
+		{1, ".ri=16", "艾琳 的先攻设为 16\n已更新先攻列表"},
+		{1, ".init list", "先攻列表（第 2 轮）:\n1. 哥布林 18 [中毒 剩余3轮] ← 当前行动\n2. 艾琳 16 [祝福 剩余8轮]"},
+		{1, ".condition info 目盲", "目盲: 目盲的生物无法视物，并自动失败于任何需要视觉的属性检定。对该生物的攻击检定具有优势，该生物的攻击检定具有劣势。"},
+		{1, ".condition info prone", "倒地: 倒地的生物只能爬行移动，除非站起从而结束此状态。该生物的攻击检定具有劣势。攻击者位于其 5 尺内时对其攻击检定具有优势，否则具有劣势。"},
+		{1, ".condition info 祝福", "没有状态 祝福 的说明，使用 .condition info 查看所有状态"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, tt.player, 2, tt.cmd); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+	if got := runCommand(registry, 1, 2, ".condition info"); !strings.HasPrefix(got, "可查看的状态: ") || strings.Count(got, "、") != 14 {
+		t.Errorf(".condition info = %q, want all 15 conditions", got)
+	}
+}
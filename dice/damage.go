@@ -0,0 +1,272 @@
+package dice
+
+import (
+	"fmt"
+	"island/parser"
+	"island/storage"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// DnD5EDamageTypes 伤害类型，人物卡中保存中文名称
+var DnD5EDamageTypes = []string{"钝击", "穿刺", "挥砍", "强酸", "寒冷", "火焰", "力场", "闪电", "黯蚀", "毒素", "心灵", "光耀", "雷鸣"}
+
+// damageTypeAliases 伤害类型的英文名和常见译名，键为小写
+var damageTypeAliases = map[string]string{
+	"bludgeoning": "钝击", "piercing": "穿刺", "slashing": "挥砍", "acid": "强酸", "cold": "寒冷",
+	"fire": "火焰", "force": "力场", "lightning": "闪电", "necrotic": "黯蚀", "poison": "毒素",
+	"psychic": "心灵", "radiant": "光耀", "thunder": "雷鸣",
+	"斩击": "挥砍", "酸蚀": "强酸", "冷冻": "寒冷", "死灵": "黯蚀", "毒": "毒素", "精神": "心灵", "光辉": "光耀",
+}
+
+// damageType 将伤害类型或别名转换为中文名称
+func damageType(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := damageTypeAliases[name]; ok {
+		name = alias
+	}
+	return name, slices.Contains(DnD5EDamageTypes, name)
+}
+
+// damageFlags .damage 的选项
+var damageFlags = map[string]string{
+	"crit": "crit", "重击": "crit",
+	"resist": "resist", "抗性": "resist",
+	"vuln": "vuln", "易伤": "vuln",
+	"immune": "immune", "免疫": "immune",
+}
+
+// DamagePart 一段伤害，例如 1d8+3 挥砍
+type DamagePart struct {
+	Expr    string
+	Type    string // 伤害类型，可以为空
+	Roll    int    // 掷出的伤害
+	Process string // 投掷过程
+	Dealt   int    // 计算抗性、易伤和免疫后的伤害
+	Note    string // 抗性、易伤和免疫的说明
+}
+
+// RollDamage 计算伤害表达式，crit 为 true 时伤害骰个数翻倍而加值不变
+func (e *Engine) RollDamage(expression string, crit bool) (int, string, error) {
+	ctx := e.newContext()
+	if crit {
+		ctx.DiceScale = 2
+	}
+	res, err := ctx.Eval(expression)
+	if err != nil {
+		return 0, "", err
+	}
+	value, ok := res.Value.(int)
+	if !ok {
+		return 0, "", fmt.Errorf("%w: %s", parser.ErrNotInteger, parser.FormatValue(res.Value))
+	}
+	return max(value, 0), res.Process, nil
+}
+
+// applyDamageDefenses 按抗性、易伤和免疫调整伤害：免疫为 0，抗性减半向下取整，易伤加倍
+func applyDamageDefenses(part *DamagePart, resist, vuln, immune bool) {
+	part.Dealt = part.Roll
+	var notes []string
+	switch {
+	case immune:
+		part.Dealt = 0
+		notes = append(notes, "免疫")
+	default:
+		if resist {
+			part.Dealt /= 2
+			notes = append(notes, "抗性减半")
+		}
+		if vuln {
+			part.Dealt *= 2
+			notes = append(notes, "易伤加倍")
+		}
+	}
+	part.Note = strings.Join(notes, "、")
+}
+
+// damageArgs .damage 的参数
+type damageArgs struct {
+	parts     []*DamagePart
+	flags     map[string]bool
+	target    int64
+	hasTarget bool
+}
+
+// parseDamageArgs 拆分伤害表达式、伤害类型、选项和 @ 的目标
+// 伤害类型结束它前面的表达式，例如 "1d8+3 挥砍 2d6 fire crit"
+func parseDamageArgs(input string) (*damageArgs, string) {
+	args := &damageArgs{flags: make(map[string]bool)}
+	args.target, input, args.hasTarget = extractMention(input)
+
+	var expr []string
+	flush := func(typ string) string {
+		if len(expr) == 0 {
+			if n := len(args.parts); typ != "" && n > 0 && args.parts[n-1].Type == "" {
+				args.parts[n-1].Type = typ
+				return ""
+			}
+			return fmt.Sprintf("伤害类型 %s 前缺少伤害表达式", typ)
+		}
+		args.parts = append(args.parts, &DamagePart{Expr: strings.Join(expr, ""), Type: typ})
+		expr = nil
+		return ""
+	}
+	for _, field := range strings.Fields(input) {
+		if flag, ok := damageFlags[strings.ToLower(field)]; ok {
+			args.flags[flag] = true
+			continue
+		}
+		if typ, ok := damageType(field); ok {
+			if errMsg := flush(typ); errMsg != "" {
+				return nil, errMsg
+			}
+			continue
+		}
+		// 伤害类型可以紧跟在表达式后，例如 2d6火焰
+		if i := strings.IndexFunc(field, func(r rune) bool { return r > unicode.MaxASCII }); i > 0 {
+			if typ, ok := damageType(field[i:]); ok {
+				expr = append(expr, field[:i])
+				flush(typ)
+				continue
+			}
+		}
+		expr = append(expr, field)
+	}
+	if len(expr) > 0 {
+		flush("")
+	}
+	if len(args.parts) == 0 {
+		return nil, damageUsage
+	}
+	return args, ""
+}
+
+const damageUsage = "用法: .damage [伤害表达式或武器] [伤害类型] [crit] [@目标]\n" +
+	"例如 .damage 2d6+3 slashing、.damage 长剑 crit、.damage 1d8+3 挥砍 2d6 火焰 @目标"
+
+// damageDefenses 目标对某种伤害类型的抗性、易伤和免疫，包括指令中给出的选项
+func damageDefenses(target *storage.CharacterCard, flags map[string]bool, typ string) (resist, vuln, immune bool) {
+	resist, vuln, immune = flags["resist"], flags["vuln"], flags["immune"]
+	if target == nil || target.DnD == nil || typ == "" {
+		return
+	}
+	d := target.DnD
+	return resist || slices.Contains(d.Resistances, typ),
+		vuln || slices.Contains(d.Vulnerable, typ),
+		immune || slices.Contains(d.Immunities, typ)
+}
+
+// formatDamagePart 格式化一段伤害，例如 "1d8+3 挥砍 = 7 (详情: 1d8 = 4)"
+func formatDamagePart(part *DamagePart) string {
+	text := part.Expr
+	if part.Type != "" {
+		text += " " + part.Type
+	}
+	text += fmt.Sprintf(" = %d", part.Roll)
+	if part.Process != "" {
+		text += fmt.Sprintf(" (详情: %s)", part.Process)
+	}
+	if part.Note != "" {
+		text += fmt.Sprintf("，%s → %d", part.Note, part.Dealt)
+	}
+	return text
+}
+
+// rollDamage 完成 .damage：武器名读取人物卡的伤害，按目标的抗性、易伤和免疫计算伤害
+func rollDamage(ctx *CommandContext, input string) string {
+	args, errMsg := parseDamageArgs(input)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	label := "伤害"
+	card := currentCard(ctx)
+	if card != nil {
+		label = card.Name + " 的伤害"
+	}
+	for _, part := range args.parts {
+		if card == nil || card.DnD == nil {
+			break
+		}
+		if weapon, ok := card.DnD.Weapons[part.Expr]; ok {
+			if len(args.parts) == 1 {
+				label = card.Name + " 的" + part.Expr + "伤害"
+			}
+			part.Expr = weaponDamage(card.DnD, weapon)
+			if part.Type == "" {
+				part.Type = weapon.Type
+			}
+		}
+	}
+	if args.flags["crit"] {
+		label += "(重击，伤害骰翻倍)"
+	}
+
+	var target *storage.CharacterCard
+	if args.hasTarget {
+		target = playerCard(ctx, args.target)
+	}
+	total := 0
+	lines := []string{label + ":"}
+	for _, part := range args.parts {
+		if _, err := parser.ParseProgram(part.Expr); err != nil {
+			return fmt.Sprintf("伤害表达式有误: %s\n%v", part.Expr, err)
+		}
+		roll, process, err := ctx.Engine.RollDamage(part.Expr, args.flags["crit"])
+		if err != nil {
+			return fmt.Sprintf("掷骰出错: %s\n%v", part.Expr, err)
+		}
+		part.Roll, part.Process = roll, process
+		resist, vuln, immune := damageDefenses(target, args.flags, part.Type)
+		applyDamageDefenses(part, resist, vuln, immune)
+		total += part.Dealt
+		lines = append(lines, formatDamagePart(part))
+	}
+
+	if len(args.parts) == 1 && !args.hasTarget && args.parts[0].Note == "" {
+		return label + ": " + formatDamagePart(args.parts[0])
+	}
+	if args.hasTarget {
+		lines = append(lines, fmt.Sprintf("对 %s 造成 %d 点伤害", participantName(target, args.target), total))
+	} else {
+		lines = append(lines, fmt.Sprintf("共 %d 点伤害", total))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// critDamagePrompt 攻击掷出 20 时提示投掷重击伤害
+func critDamagePrompt(r *D20Result, damage string) string {
+	if r.Natural != 20 {
+		return ""
+	}
+	return fmt.Sprintf("\n使用 .damage %s crit 投掷重击伤害，伤害骰翻倍", damage)
+}
+
+// DamageCommand .damage 指令 (伤害骰)
+type DamageCommand struct {
+	BaseCommand
+}
+
+func NewDamageCommand() *DamageCommand {
+	return &DamageCommand{
+		BaseCommand: BaseCommand{
+			name:  "damage",
+			help:  ".damage [伤害表达式或武器] [伤害类型] [crit] [@目标] - 伤害骰，重击时伤害骰翻倍",
+			regex: regexp.MustCompile(`^damage\s*(.*)$`),
+		},
+	}
+}
+
+func (c *DamageCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *DamageCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return damageUsage
+	}
+	return rollDamage(ctx, matches[1])
+}
@@ -0,0 +1,46 @@
+package dice
+
+import "testing"
+
+// TestDamage 伤害骰：重击只翻倍骰子，按目标人物卡计算抗性、易伤和免疫
+func TestDamage(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+	for _, cmd := range []string{".pc new 艾琳 dnd5e", ".pc set str16", ".pc weapon 长剑 1d8 str slashing"} {
+		runCommand(registry, 1, 2, cmd)
+	}
+	for _, cmd := range []string{".pc new 食尸鬼 dnd5e", ".pc resist 挥砍", ".pc vuln fire radiant", ".pc immune 毒素"} {
+		runCommand(registry, 3, 2, cmd)
+	}
+
+	tests := []struct {
+		player int64
+		cmd    string
+		draws  []int
+		want   string
+	}{
+		{3, ".pc", nil, "食尸鬼 (DnD5E 1级，熟练加值 +2)\n" +
+			"力量:10(+0) 敏捷:10(+0) 体质:10(+0) 智力:10(+0) 感知:10(+0) 魅力:10(+0)\n" +
+			"抗性: 挥砍\n易伤: 火焰、光耀\n免疫: 毒素"},
+		{1, ".pc weapon 短弓 1d6 dex 穿刺 +1", nil, "已更新 艾琳: 武器 短弓(命中+3 伤害1d6+1 穿刺)"},
+		{2, ".damage 2d6+3 slashing", []int{1, 4}, "伤害: 2d6+3 挥砍 = 10 (详情: 2d6 = [2 5] = 7)"},
+		{2, ".damage 2d6 + 3 crit", []int{1, 4, 0, 5}, "伤害(重击，伤害骰翻倍): 2d6+3 = 17 (详情: 4d6 = [2 5 1 6] = 14)"},
+		{1, ".damage 长剑 crit", []int{3, 6}, "艾琳 的长剑伤害(重击，伤害骰翻倍): 1d8+3 挥砍 = 14 (详情: 2d8 = [4 7] = 11)"},
+		{1, ".damage 长剑 @3", []int{6}, "艾琳 的长剑伤害:\n1d8+3 挥砍 = 10 (详情: 1d8 = [7] = 7)，抗性减半 → 5\n对 食尸鬼 造成 5 点伤害"},
+		{1, ".damage 1d8+3 挥砍 2d6火焰 1d4 poison [CQ:at,qq=3]", []int{6, 0, 2, 3}, "艾琳 的伤害:\n" +
+			"1d8+3 挥砍 = 10 (详情: 1d8 = [7] = 7)，抗性减半 → 5\n" +
+			"2d6 火焰 = 4 (详情: 2d6 = [1 3] = 4)，易伤加倍 → 8\n" +
+			"1d4 毒素 = 4 (详情: 1d4 = [4] = 4)，免疫 → 0\n" +
+			"对 食尸鬼 造成 13 点伤害"},
+		{2, ".damage 3d4 resist", []int{0, 1, 2}, "伤害:\n3d4 = 6 (详情: 3d4 = [1 2 3] = 6)，抗性减半 → 3\n共 3 点伤害"},
+		{2, ".damage 2d6 @4", []int{0, 1}, "伤害:\n2d6 = 3 (详情: 2d6 = [1 2] = 3)\n对 [CQ:at,qq=4] 造成 3 点伤害"},
+		{2, ".damage fire", nil, "伤害类型 火焰 前缺少伤害表达式"},
+		{2, ".damage 2d", nil, "伤害表达式有误: 2d\n第 3 个字符: 语法错误"},
+		{2, ".damage", nil, damageUsage},
+		{2, ".attack 5", []int{19}, "攻击检定: 1D20(20) + 5 = 25 重击！\n使用 .damage [伤害表达式] crit 投掷重击伤害，伤害骰翻倍"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, tt.player, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package dice
+
+import (
+	"fmt"
+	"island/parser"
+	"regexp"
+	"strings"
+)
+
+// MAX_DIST_LINES 分布回复中最多显示的行数，取值更多时合并为区间
+const MAX_DIST_LINES = 20
+
+// Distribution 计算表达式的精确分布并格式化为回复文本
+func (e *Engine) Distribution(expression string) string {
+	expr := strings.TrimSpace(expression)
+	if expr == "" {
+		expr = e.defaultDice()
+	}
+	dist, err := parser.AnalyzeDistribution(expr)
+	if err != nil {
+		return fmt.Sprintf("无法计算分布: %s\n%v", expr, err)
+	}
+	return FormatDistribution(expr, dist)
+}
+
+// FormatDistribution 输出期望、标准差以及每个取值（或区间）的概率和累积概率
+func FormatDistribution(expr string, dist *parser.Distribution) string {
+	lines := []string{
+		fmt.Sprintf("%s 的分布: 期望 %.2f，标准差 %.2f，范围 %d~%d", expr, dist.Mean(), dist.StdDev(), dist.Min, dist.Max()),
+	}
+
+	points := dist.Points()
+	width := (len(points) + MAX_DIST_LINES - 1) / MAX_DIST_LINES
+	type bucket struct {
+		lo, hi int
+		p, cdf float64
+	}
+	var buckets []bucket
+	maxP := 0.0
+	for i := 0; i < len(points); i += width {
+		group := points[i:min(i+width, len(points))]
+		b := bucket{lo: group[0].Value, hi: group[len(group)-1].Value, cdf: group[len(group)-1].CDF}
+		for _, point := range group {
+			b.p += point.P
+		}
+		maxP = max(maxP, b.p)
+		buckets = append(buckets, b)
+	}
+
+	for _, b := range buckets {
+		label := fmt.Sprint(b.lo)
+		if b.hi != b.lo {
+			label = fmt.Sprintf("%d~%d", b.lo, b.hi)
+		}
+		bar := strings.Repeat("█", int(b.p/maxP*10+0.5))
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("%s: %.2f%% (累计 %.2f%%) %s", label, b.p*100, b.cdf*100, bar)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DistCommand .dist 指令 (计算掷骰结果的分布)
+type DistCommand struct {
+	BaseCommand
+}
+
+func NewDistCommand() *DistCommand {
+	return &DistCommand{
+		BaseCommand: BaseCommand{
+			name:  "dist",
+			help:  ".dist [表达式] - 计算掷骰结果的精确分布，例如 .dist 4d6kh3",
+			regex: regexp.MustCompile(`^dist\s*(.*)$`),
+		},
+	}
+}
+
+func (c *DistCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *DistCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return "用法: .dist [表达式]"
+	}
+	return ctx.Engine.Distribution(matches[1])
+}
@@ -0,0 +1,411 @@
+package dice
+
+import (
+	"fmt"
+	"island/storage"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DnD5EAbilities 六项属性的键，按人物卡展示的顺序排列
+var DnD5EAbilities = []string{"str", "dex", "con", "int", "wis", "cha"}
+
+// dndAbilityNames 属性键对应的中文名称
+var dndAbilityNames = map[string]string{
+	"str": "力量", "dex": "敏捷", "con": "体质", "int": "智力", "wis": "感知", "cha": "魅力",
+}
+
+// dndAbilityAliases 属性的写法，键为小写
+var dndAbilityAliases = map[string]string{
+	"strength": "str", "dexterity": "dex", "constitution": "con",
+	"intelligence": "int", "wisdom": "wis", "charisma": "cha",
+	"力量": "str", "敏捷": "dex", "体质": "con", "智力": "int", "感知": "wis", "魅力": "cha",
+}
+
+// DnD5ESkills 技能及其关联的属性
+var DnD5ESkills = map[string]string{
+	"运动": "str",
+	"特技": "dex", "巧手": "dex", "隐匿": "dex",
+	"奥秘": "int", "历史": "int", "调查": "int", "自然": "int", "宗教": "int",
+	"驯兽": "wis", "洞悉": "wis", "医药": "wis", "察觉": "wis", "求生": "wis",
+	"欺瞒": "cha", "威吓": "cha", "表演": "cha", "游说": "cha",
+}
+
+// dndSkillAliases 技能的英文名和常见译名，键为小写
+var dndSkillAliases = map[string]string{
+	"athletics": "运动", "acrobatics": "特技", "sleight": "巧手", "sleight_of_hand": "巧手", "stealth": "隐匿",
+	"arcana": "奥秘", "history": "历史", "investigation": "调查", "nature": "自然", "religion": "宗教",
+	"animal": "驯兽", "animal_handling": "驯兽", "insight": "洞悉", "medicine": "医药",
+	"perception": "察觉", "survival": "求生", "deception": "欺瞒", "intimidation": "威吓",
+	"performance": "表演", "persuasion": "游说",
+	"驯养动物": "驯兽", "洞察": "洞悉", "医疗": "医药", "侦察": "察觉", "生存": "求生",
+	"欺骗": "欺瞒", "说服": "游说", "潜行": "隐匿",
+}
+
+// dndAbility 将属性名或别名转换为属性键
+func dndAbility(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := dndAbilityNames[name]; ok {
+		return name, true
+	}
+	key, ok := dndAbilityAliases[name]
+	return key, ok
+}
+
+// dndSkill 将技能名或别名转换为人物卡中保存的技能名
+func dndSkill(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := dndSkillAliases[name]; ok {
+		name = alias
+	}
+	_, ok := DnD5ESkills[name]
+	return name, ok
+}
+
+// AbilityModifier 属性调整值
+func AbilityModifier(score int) int {
+	if score < 0 {
+		score = 0
+	}
+	return score/2 - 5
+}
+
+// ProficiencyBonus 熟练加值，人物卡没有记录时按等级计算
+func ProficiencyBonus(d *storage.DnD5EStats) int {
+	if d.Proficiency > 0 {
+		return d.Proficiency
+	}
+	return 2 + (max(d.Level, 1)-1)/4
+}
+
+// dndSkillModifier 技能检定加值：属性调整值，熟练时加熟练加值，专精时加双倍
+func dndSkillModifier(d *storage.DnD5EStats, skill string) int {
+	mod := AbilityModifier(d.Abilities[DnD5ESkills[skill]])
+	switch {
+	case slices.Contains(d.Expertise, skill):
+		mod += 2 * ProficiencyBonus(d)
+	case slices.Contains(d.Skills, skill):
+		mod += ProficiencyBonus(d)
+	}
+	return mod
+}
+
+// dndSaveModifier 豁免加值：属性调整值，熟练时加熟练加值
+func dndSaveModifier(d *storage.DnD5EStats, ability string) int {
+	mod := AbilityModifier(d.Abilities[ability])
+	if slices.Contains(d.Saves, ability) {
+		mod += ProficiencyBonus(d)
+	}
+	return mod
+}
+
+// dndWeaponModifier 武器的命中加值：属性调整值、熟练加值和武器加值
+func dndWeaponModifier(d *storage.DnD5EStats, w storage.Weapon) int {
+	return dndWeaponAbilityModifier(d, w) + ProficiencyBonus(d) + w.Bonus
+}
+
+// dndWeaponAbilityModifier 武器使用的属性调整值，灵巧武器取力量和敏捷中较高者
+func dndWeaponAbilityModifier(d *storage.DnD5EStats, w storage.Weapon) int {
+	if w.Ability == "finesse" {
+		return max(AbilityModifier(d.Abilities["str"]), AbilityModifier(d.Abilities["dex"]))
+	}
+	return AbilityModifier(d.Abilities[w.Ability])
+}
+
+// D20Result 一次 d20 检定
+type D20Result struct {
+	Natural   int   // 采用的 d20 点数
+	Rolls     []int // 优势或劣势时掷出的两颗 d20
+	Advantage int   // 1 为优势，-1 为劣势
+	Modifier  int
+}
+
+// Total 检定总值
+func (r *D20Result) Total() int {
+	return r.Natural + r.Modifier
+}
+
+// RollD20 掷 1d20 并加上调整值
+func (e *Engine) RollD20(modifier int) *D20Result {
+	return e.RollD20Advantage(modifier, 0)
+}
+
+// RollD20Advantage 优势（advantage > 0）时掷两颗 d20 取高，劣势（advantage < 0）时取低
+func (e *Engine) RollD20Advantage(modifier, advantage int) *D20Result {
+	r := &D20Result{Natural: e.intn(20) + 1, Modifier: modifier}
+	if advantage == 0 {
+		return r
+	}
+	second := e.intn(20) + 1
+	r.Rolls = []int{r.Natural, second}
+	if advantage > 0 {
+		r.Advantage, r.Natural = 1, max(r.Natural, second)
+	} else {
+		r.Advantage, r.Natural = -1, min(r.Natural, second)
+	}
+	return r
+}
+
+// formatModifier 格式化调整值，例如 " + 5"、" - 1"
+func formatModifier(mod int) string {
+	if mod < 0 {
+		return fmt.Sprintf(" - %d", -mod)
+	}
+	return fmt.Sprintf(" + %d", mod)
+}
+
+// FormatD20 格式化 d20 检定，例如 "隐匿检定: 1D20(14) + 5 = 19"、"隐匿检定: 2D20取高(14, 7) + 5 = 19"
+func FormatD20(label string, r *D20Result) string {
+	dice := fmt.Sprintf("1D20(%d)", r.Natural)
+	switch {
+	case r.Advantage > 0:
+		dice = fmt.Sprintf("2D20取高(%d, %d)", r.Rolls[0], r.Rolls[1])
+	case r.Advantage < 0:
+		dice = fmt.Sprintf("2D20取低(%d, %d)", r.Rolls[0], r.Rolls[1])
+	}
+	return fmt.Sprintf("%s: %s%s = %d", label, dice, formatModifier(r.Modifier), r.Total())
+}
+
+// advantageWords 表示优势和劣势的参数
+var advantageWords = map[string]int{
+	"adv": 1, "advantage": 1, "优势": 1,
+	"dis": -1, "disadvantage": -1, "劣势": -1,
+}
+
+// parseAdvantage 从参数中取出 adv/dis 标记，同时有优势和劣势时相互抵消
+func parseAdvantage(input string) (rest string, advantage int, cancelled bool) {
+	var fields []string
+	hasAdv, hasDis := false, false
+	for _, field := range strings.Fields(input) {
+		switch advantageWords[strings.ToLower(field)] {
+		case 1:
+			hasAdv = true
+		case -1:
+			hasDis = true
+		default:
+			fields = append(fields, field)
+		}
+	}
+	switch {
+	case hasAdv && hasDis:
+		cancelled = true
+	case hasAdv:
+		advantage = 1
+	case hasDis:
+		advantage = -1
+	}
+	return strings.Join(fields, " "), advantage, cancelled
+}
+
+// withCancelNote 优势和劣势相互抵消时在结果后加以说明
+func withCancelNote(result string, cancelled bool) string {
+	if cancelled {
+		result += "\n优势和劣势相互抵消，按普通检定进行"
+	}
+	return result
+}
+
+// FormatAttack 格式化攻击检定，掷出 20 为重击，掷出 1 为失手
+func FormatAttack(label string, r *D20Result) string {
+	result := FormatD20(label, r)
+	switch r.Natural {
+	case 20:
+		result += " 重击！"
+	case 1:
+		result += " 失手！"
+	}
+	return result
+}
+
+// dndCard 读取玩家在当前群使用的 DnD5E 人物卡，没有时 errMsg 不为空
+func dndCard(ctx *CommandContext) (card *storage.CharacterCard, errMsg string) {
+	card = currentCard(ctx)
+	if card == nil || card.DnD == nil {
+		return nil, "你在本群没有 DnD5E 人物卡，请先使用 .pc new [角色名] dnd5e 创建"
+	}
+	return card, ""
+}
+
+// dndArgRegex 匹配 名称[±加值]，例如 隐匿、stealth+2、wis - 1
+var dndArgRegex = regexp.MustCompile(`^(.*?)\s*([+\-]\s*\d+)?$`)
+
+// parseDnDArg 拆分名称和额外的加值
+func parseDnDArg(input string) (name string, extra int) {
+	m := dndArgRegex.FindStringSubmatch(strings.TrimSpace(input))
+	if m[2] != "" {
+		extra, _ = strconv.Atoi(strings.ReplaceAll(m[2], " ", ""))
+	}
+	return m[1], extra
+}
+
+// DNDCheckCommand .check 指令 (技能或属性检定)
+type DNDCheckCommand struct {
+	BaseCommand
+}
+
+func NewDNDCheckCommand() *DNDCheckCommand {
+	return &DNDCheckCommand{
+		BaseCommand: BaseCommand{
+			name:  "check",
+			help:  ".check [技能或属性][±加值] - 技能检定，按人物卡计算加值",
+			regex: regexp.MustCompile(`^check\s*(.+)$`),
+		},
+	}
+}
+
+func (c *DNDCheckCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *DNDCheckCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return "用法: .check [技能或属性] [adv/dis]，例如 .check stealth、.check 察觉 adv、.check dex"
+	}
+	input, advantage, cancelled := parseAdvantage(matches[1])
+	return withCancelNote(dndCheck(ctx, input, advantage), cancelled)
+}
+
+// dndCheck 按人物卡进行技能或属性检定
+func dndCheck(ctx *CommandContext, input string, advantage int) string {
+	card, errMsg := dndCard(ctx)
+	if errMsg != "" {
+		return errMsg
+	}
+	name, extra := parseDnDArg(input)
+	if skill, ok := dndSkill(name); ok {
+		r := ctx.Engine.RollD20Advantage(dndSkillModifier(card.DnD, skill)+extra, advantage)
+		return FormatD20(card.Name+" 的"+skill+"检定", r)
+	}
+	if ability, ok := dndAbility(name); ok {
+		r := ctx.Engine.RollD20Advantage(AbilityModifier(card.DnD.Abilities[ability])+extra, advantage)
+		return FormatD20(card.Name+" 的"+dndAbilityNames[ability]+"检定", r)
+	}
+	return fmt.Sprintf("未知的技能或属性: %s", name)
+}
+
+// DNDAdvantageCommand .adv/.dis 指令 (优势或劣势检定)
+type DNDAdvantageCommand struct {
+	BaseCommand
+	advantage int
+}
+
+func NewDNDAdvantageCommand() *DNDAdvantageCommand {
+	return &DNDAdvantageCommand{
+		BaseCommand: BaseCommand{
+			name:  "adv",
+			help:  ".adv [技能或属性] - 优势检定，掷两次 d20 取高",
+			regex: regexp.MustCompile(`^adv([\s+\-].*)?$`),
+		},
+		advantage: 1,
+	}
+}
+
+func NewDNDDisadvantageCommand() *DNDAdvantageCommand {
+	return &DNDAdvantageCommand{
+		BaseCommand: BaseCommand{
+			name:  "dis",
+			help:  ".dis [技能或属性] - 劣势检定，掷两次 d20 取低",
+			regex: regexp.MustCompile(`^dis([\s+\-].*)?$`),
+		},
+		advantage: -1,
+	}
+}
+
+func (c *DNDAdvantageCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *DNDAdvantageCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 || strings.TrimSpace(matches[1]) == "" {
+		return fmt.Sprintf("用法: .%s [技能或属性]，例如 .%s dex、.%s 察觉", c.name, c.name, c.name)
+	}
+	// 指令本身带有优势或劣势，参数中出现相反的一方（包括已相互抵消的 adv dis）时抵消为普通检定
+	input, advantage, cancelled := parseAdvantage(strings.TrimSpace(matches[1]))
+	if cancelled || advantage == -c.advantage {
+		advantage, cancelled = 0, true
+	} else {
+		advantage = c.advantage
+	}
+	name, extra := parseDnDArg(input)
+	if name == "" {
+		// 没有技能名时直接使用给出的加值，例如 .adv +3
+		label := map[int]string{1: "优势检定", -1: "劣势检定", 0: "检定"}[advantage]
+		return withCancelNote(FormatD20(label, ctx.Engine.RollD20Advantage(extra, advantage)), cancelled)
+	}
+	return withCancelNote(dndCheck(ctx, input, advantage), cancelled)
+}
+
+// DNDSaveCommand .save 指令 (豁免检定)
+type DNDSaveCommand struct {
+	BaseCommand
+}
+
+func NewDNDSaveCommand() *DNDSaveCommand {
+	return &DNDSaveCommand{
+		BaseCommand: BaseCommand{
+			name:  "save",
+			help:  ".save [属性][±加值] - 豁免检定，按人物卡计算加值",
+			regex: regexp.MustCompile(`^save\s*(.+)$`),
+		},
+	}
+}
+
+func (c *DNDSaveCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *DNDSaveCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return "用法: .save [属性] [adv/dis]，例如 .save wis、.save 体质 adv"
+	}
+	card, errMsg := dndCard(ctx)
+	if errMsg != "" {
+		return errMsg
+	}
+	input, advantage, cancelled := parseAdvantage(matches[1])
+	name, extra := parseDnDArg(input)
+	ability, ok := dndAbility(name)
+	if !ok {
+		return fmt.Sprintf("未知的属性: %s", name)
+	}
+	r := ctx.Engine.RollD20Advantage(dndSaveModifier(card.DnD, ability)+extra, advantage)
+	return withCancelNote(FormatD20(card.Name+" 的"+dndAbilityNames[ability]+"豁免", r), cancelled)
+}
+
+// dndInitiative 按人物卡的敏捷调整值进行先攻检定
+func dndInitiative(ctx *CommandContext) string {
+	card, errMsg := dndCard(ctx)
+	if errMsg != "" {
+		return errMsg + "，或直接给出先攻加值，例如 .init 3"
+	}
+	r := ctx.Engine.RollD20(AbilityModifier(card.DnD.Abilities["dex"]))
+	return FormatD20(card.Name+" 的先攻", r)
+}
+
+// dndAttack 使用人物卡中的武器进行攻击检定
+func dndAttack(ctx *CommandContext, input string, advantage int) string {
+	card, errMsg := dndCard(ctx)
+	if errMsg != "" {
+		return errMsg + "，或直接给出攻击加值，例如 .attack 5"
+	}
+	name, extra := parseDnDArg(input)
+	weapon, ok := card.DnD.Weapons[name]
+	if !ok {
+		names := make([]string, 0, len(card.DnD.Weapons))
+		for name := range card.DnD.Weapons {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		if len(names) == 0 {
+			return fmt.Sprintf("%s 没有记录武器，请先使用 .pc weapon [名称] [伤害] [属性] 添加", card.Name)
+		}
+		return fmt.Sprintf("%s 没有武器 %s，已记录的武器: %s", card.Name, name, strings.Join(names, "、"))
+	}
+	r := ctx.Engine.RollD20Advantage(dndWeaponModifier(card.DnD, weapon)+extra, advantage)
+	return FormatAttack(card.Name+" 的"+name+"攻击", r) + critDamagePrompt(r, name)
+}
@@ -0,0 +1,102 @@
+package dice
+
+import "testing"
+
+// TestDnD5ECard .pc 记录 DnD5E 人物卡，.check/.save/.init/.attack 按人物卡计算加值
+func TestDnD5ECard(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".check stealth", nil, "你在本群没有 DnD5E 人物卡，请先使用 .pc new [角色名] dnd5e 创建"},
+		{".pc new 艾琳 dnd5e", nil, "已新建 dnd5e 人物卡 艾琳，并设为当前人物卡"},
+		{".pc set str16 dex14 con12 int10 wis13 cha8 lv5", nil,
+			"已更新 艾琳: 力量 16，敏捷 14，体质 12，智力 10，感知 13，魅力 8，等级 5"},
+		{".pc prof 隐匿 perception str 体质", nil, "已更新 艾琳: 熟练 隐匿，熟练 察觉，熟练豁免 力量，熟练豁免 体质"},
+		{".pc expert stealth", nil, "已更新 艾琳: 专精 隐匿"},
+		{".pc weapon 长剑 1d8 str", nil, "已更新 艾琳: 武器 长剑(命中+6 伤害1d8+3)"},
+		{".pc weapon 短剑 1d6 finesse +1", nil, "已更新 艾琳: 武器 短剑(命中+7 伤害1d6+4)"},
+		{".check stealth", []int{13}, "艾琳 的隐匿检定: 1D20(14) + 8 = 22"},
+		{".check 察觉+2", []int{9}, "艾琳 的察觉检定: 1D20(10) + 6 = 16"},
+		{".check cha", []int{0}, "艾琳 的魅力检定: 1D20(1) - 1 = 0"},
+		{".check 飞行", nil, "未知的技能或属性: 飞行"},
+		{".save wis", []int{4}, "艾琳 的感知豁免: 1D20(5) + 1 = 6"},
+		{".save con", []int{4}, "艾琳 的体质豁免: 1D20(5) + 4 = 9"},
+		{".init", []int{9}, "艾琳 的先攻: 1D20(10) + 2 = 12"},
+		{".init -1", []int{9}, "先攻检定: 1D20(10) - 1 = 9"},
+		{".attack 长剑", []int{19}, "艾琳 的长剑攻击: 1D20(20) + 6 = 26 重击！\n使用 .damage 长剑 crit 投掷重击伤害，伤害骰翻倍"},
+		{".attack 弓", nil, "艾琳 没有武器 弓，已记录的武器: 短剑、长剑"},
+		{".attack -2", []int{0}, "攻击检定: 1D20(1) - 2 = -1 失手！"},
+		{".pc", nil, "艾琳 (DnD5E 5级，熟练加值 +3)\n" +
+			"力量:16(+3) 敏捷:14(+2) 体质:12(+1) 智力:10(+0) 感知:13(+1) 魅力:8(-1)\n" +
+			"熟练豁免: 力量、体质\n熟练技能: 隐匿、察觉\n专精技能: 隐匿\n" +
+			"武器: 短剑(命中+7 伤害1d6+4)、长剑(命中+6 伤害1d8+3)"},
+		{".pc prof -察觉", nil, "已更新 艾琳: 移除熟练 察觉"},
+		{".pc weapon -短剑", nil, "已更新 艾琳: 移除武器 短剑"},
+		{".pc weapon 弓 1d", nil, "伤害表达式有误: 1d\n第 3 个字符: 语法错误"},
+		{".contest 运动 隐匿 @2", []int{9, 9}, "对抗检定:\n" +
+			"艾琳 的运动: 1D20(10) + 3 = 13\n" +
+			"[CQ:at,qq=2] 的隐匿: 1D20(10) + 0 = 10\n" +
+			"艾琳 胜出"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+// TestDnD5EAdvantage 优势取高、劣势取低，同时存在时相互抵消
+func TestDnD5EAdvantage(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+	for _, cmd := range []string{".pc new 艾琳 dnd5e", ".pc set dex14 wis13 lv5", ".pc prof 察觉 wis", ".pc weapon 长剑 1d8 str"} {
+		runCommand(registry, 1, 2, cmd)
+	}
+
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".adv dex", []int{6, 13}, "艾琳 的敏捷检定: 2D20取高(7, 14) + 2 = 16"},
+		{".dis 察觉", []int{6, 13}, "艾琳 的察觉检定: 2D20取低(7, 14) + 4 = 11"},
+		{".adv +3", []int{19, 0}, "优势检定: 2D20取高(20, 1) + 3 = 23"},
+		{".check stealth adv", []int{2, 3}, "艾琳 的隐匿检定: 2D20取高(3, 4) + 2 = 6"},
+		{".save wis dis", []int{17, 9}, "艾琳 的感知豁免: 2D20取低(18, 10) + 4 = 14"},
+		{".attack 长剑 adv", []int{0, 19}, "艾琳 的长剑攻击: 2D20取高(1, 20) + 3 = 23 重击！\n使用 .damage 长剑 crit 投掷重击伤害，伤害骰翻倍"},
+		{".attack 5 dis", []int{0, 19}, "攻击检定: 2D20取低(1, 20) + 5 = 6 失手！"},
+		{".check dex adv dis", []int{9}, "艾琳 的敏捷检定: 1D20(10) + 2 = 12\n优势和劣势相互抵消，按普通检定进行"},
+		{".dis 察觉 优势", []int{9}, "艾琳 的察觉检定: 1D20(10) + 4 = 14\n优势和劣势相互抵消，按普通检定进行"},
+		{".adv dex adv dis", []int{9}, "艾琳 的敏捷检定: 1D20(10) + 2 = 12\n优势和劣势相互抵消，按普通检定进行"},
+		{".dis dex adv dis", []int{9}, "艾琳 的敏捷检定: 1D20(10) + 2 = 12\n优势和劣势相互抵消，按普通检定进行"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+// TestDnD5EAdvantageRouting 通过指令注册表分发时 .adv 和 .dis 不会抢走 .dist 等以相同字母开头的指令
+func TestDnD5EAdvantageRouting(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".dist 1d2", nil, "1d2 的分布: 期望 1.50，标准差 0.50，范围 1~2\n1: 50.00% (累计 50.00%) ██████████\n2: 50.00% (累计 100.00%) ██████████"},
+		{".dis", nil, "用法: .dis [技能或属性]，例如 .dis dex、.dis 察觉"},
+		{".adv", nil, "用法: .adv [技能或属性]，例如 .adv dex、.adv 察觉"},
+		{".adv+3", []int{19, 0}, "优势检定: 2D20取高(20, 1) + 3 = 23"},
+		{".dis -1", []int{19, 0}, "劣势检定: 2D20取低(20, 1) - 1 = 0"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -2,29 +2,81 @@ package dice
 
 import (
 	"fmt"
-	"math"
-	"math/rand"
-	"strconv"
+	"island/parser"
+	"island/rng"
 	"strings"
 	"sync"
+	"unicode"
 )
 
-// CoC7 属性列表
-var CoC7Attributes = [...]string{"STR", "CON", "SIZ", "DEX", "APP", "INT", "POW", "EDU", "LUK"}
+// CoC7 属性列表，名称与人物卡中保存的一致
+var CoC7Attributes = [...]string{"力量", "体质", "体型", "敏捷", "外貌", "智力", "意志", "教育", "幸运"}
 
 // Engine 骰子引擎
 type Engine struct {
-	mu              sync.RWMutex
+	mu               sync.RWMutex
 	defaultDiceSides int
+	source           rng.Source
 }
 
-// New 创建新的骰子引擎
+// New 创建使用密码学安全随机数的骰子引擎
 func New() *Engine {
+	return NewWithSource(rng.NewCrypto())
+}
+
+// NewWithSource 创建使用指定随机数来源的骰子引擎，测试时可传入固定种子或回放来源
+func NewWithSource(source rng.Source) *Engine {
 	return &Engine{
 		defaultDiceSides: 100,
+		source:           source,
 	}
 }
 
+// SetSource 更换随机数来源
+func (e *Engine) SetSource(source rng.Source) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.source = source
+}
+
+// Source 返回当前的随机数来源
+func (e *Engine) Source() rng.Source {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.source
+}
+
+// WithSource 返回使用指定随机数来源、其余设置相同的引擎副本
+func (e *Engine) WithSource(source rng.Source) *Engine {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return &Engine{
+		defaultDiceSides: e.defaultDiceSides,
+		source:           source,
+	}
+}
+
+// intn 从引擎的随机数来源抽取 [0, n) 范围内的整数
+func (e *Engine) intn(n int) int {
+	return e.Source().Intn(n)
+}
+
+// 聊天指令中单个骰子表达式的骰子个数、面数和 N# 重复次数上限，避免一条消息占满消息循环
+const (
+	MAX_CHAT_ROLLS      = 1000
+	MAX_CHAT_DICE_SIDES = 10000
+	MAX_CHAT_REPEAT     = 20
+)
+
+// newContext 创建指令使用的求值上下文，骰子个数、面数和重复次数使用聊天指令的上限
+func (e *Engine) newContext() *parser.Context {
+	ctx := parser.NewContextWithSource(e.Source())
+	ctx.MaxRolls = MAX_CHAT_ROLLS
+	ctx.MaxSides = MAX_CHAT_DICE_SIDES
+	ctx.MaxRepeat = MAX_CHAT_REPEAT
+	return ctx
+}
+
 // SetDefaultSides 设置默认骰子面数
 func (e *Engine) SetDefaultSides(sides int) {
 	e.mu.Lock()
@@ -32,231 +84,194 @@ func (e *Engine) SetDefaultSides(sides int) {
 	e.defaultDiceSides = sides
 }
 
-// Roll 执行基础掷骰
+// Roll 执行基础掷骰，表达式交给 parser 解析
+// 表达式后可以跟随掷骰理由，例如 "3d6 力量"；省略表达式时投掷默认骰子
 func (e *Engine) Roll(expression string) string {
-	// 这里会调用 parser 模块进行解析
-	// 目前简化处理
-	result := e.simpleRoll(expression)
-	return result
+	reply, _ := e.RollWithTrace(expression)
+	return reply
 }
 
-// simpleRoll 简单掷骰实现
-func (e *Engine) simpleRoll(expr string) string {
-	expr = strings.TrimSpace(expr)
-	
-	// 解析简单的 XdY 格式
-	var count, sides int
-	parts := strings.Split(expr, "d")
-	
-	if len(parts) != 2 {
-		return fmt.Sprintf("无效的骰子表达式: %s", expr)
-	}
-	
-	// 解析数量
-	if parts[0] == "" {
-		count = 1
-	} else {
-		c, err := strconv.Atoi(parts[0])
-		if err != nil {
-			return fmt.Sprintf("无效的骰子数量: %s", parts[0])
+// RollWithTrace 执行基础掷骰，同时返回求值树供 Web 界面展示
+func (e *Engine) RollWithTrace(expression string) (string, *parser.TraceNode) {
+	expr, reason := e.splitReason(expression, func(r rune) bool {
+		return r > unicode.MaxASCII
+	})
+
+	program, err := parser.ParseProgram(expr)
+	if err != nil && strings.IndexFunc(expr, unicode.IsSpace) != -1 {
+		// 英文理由以空白分隔，例如 .r 3d6 test
+		spaceExpr, spaceReason := e.splitReason(expr, unicode.IsSpace)
+		if spaceProgram, spaceErr := parser.ParseProgram(spaceExpr); spaceErr == nil {
+			expr, program, err = spaceExpr, spaceProgram, nil
+			reason = strings.TrimSpace(spaceReason + " " + reason)
 		}
-		count = c
 	}
-	
-	// 解析面数
-	sidePart := strings.Split(parts[1], "+")[0]
-	sidePart = strings.Split(sidePart, "-")[0]
-	s, err := strconv.Atoi(sidePart)
 	if err != nil {
-		return fmt.Sprintf("无效的骰子面数: %s", sidePart)
+		return fmt.Sprintf("表达式有误: %s\n%v", expr, err), nil
 	}
-	sides = s
-	
-	// 执行掷骰
-	if count > 100 {
-		return fmt.Sprintf("骰子数量过多: %d", count)
+
+	res, err := program.Evaluate(e.newContext())
+	if err != nil {
+		return fmt.Sprintf("掷骰出错: %s\n%v", expr, err), nil
 	}
-	if sides > 1000 {
-		return fmt.Sprintf("骰子面数过多: %d", sides)
+	var result string
+	if len(res.Repeats) > 0 {
+		result = formatRepeats(expr, res.Repeats)
+	} else {
+		result = fmt.Sprintf("掷骰结果: %s=%s", expr, parser.FormatValue(res.Value))
+		if res.Process != "" {
+			result += fmt.Sprintf(" (详情: %s)", res.Process)
+		}
 	}
-	
-	var total int
-	var rolls []int
-	for i := 0; i < count; i++ {
-		r := rand.Intn(sides) + 1
-		rolls = append(rolls, r)
-		total += r
+	if reason != "" {
+		result = fmt.Sprintf("因为 %s，%s", reason, result)
 	}
-	
-	if count == 1 {
-		return fmt.Sprintf("掷骰结果: 1D%d=%d", sides, total)
+	if len(res.Warnings) > 0 {
+		result += "\n注意: " + strings.Join(res.Warnings, "；")
 	}
-	return fmt.Sprintf("掷骰结果: %dD%d=%d (详情: %v)", count, sides, total, rolls)
+	return result, res.Trace
 }
 
-// RollWithModifier 执行带修正值的掷骰
-func (e *Engine) RollWithModifier(expression string) string {
-	// 解析修正值
-	var modifier int
-	var dicePart string
-	
-	if idx := strings.IndexAny(expression, "+-"); idx != -1 {
-		op := expression[idx]
-		dicePart = expression[:idx]
-		modStr := expression[idx+1:]
-		if m, err := strconv.Atoi(modStr); err == nil {
-			if op == '-' {
-				modifier = -m
-			} else {
-				modifier = m
-			}
+// EvalInt 计算结果为整数的表达式，返回结果和投掷过程，例如属性增减 .st hp-1d6
+func (e *Engine) EvalInt(expression string) (int, string, error) {
+	res, err := e.newContext().Eval(expression)
+	if err != nil {
+		return 0, "", err
+	}
+	switch v := res.Value.(type) {
+	case int:
+		return v, res.Process, nil
+	case bool:
+		if v {
+			return 1, res.Process, nil
 		}
-	} else {
-		dicePart = expression
+		return 0, res.Process, nil
 	}
-	
-	// 执行掷骰
-	result := e.simpleRoll(dicePart)
-	
-	// 添加修正值
-	if modifier != 0 {
-		// 从结果中提取数字
-		var total int
-		fmt.Sscanf(result, "掷骰结果: %*[^=]=%d", &total)
-		total += modifier
-		
-		if modifier > 0 {
-			return fmt.Sprintf("%s+%d=%d", dicePart, modifier, total)
-		} else {
-			return fmt.Sprintf("%s%d=%d", dicePart, modifier, total)
+	return 0, "", fmt.Errorf("%w: %s", parser.ErrNotInteger, parser.FormatValue(res.Value))
+}
+
+// formatRepeats 将重复掷骰的每一次结果各占一行
+func formatRepeats(expr string, repeats []*parser.Result) string {
+	lines := []string{fmt.Sprintf("掷骰结果: %s", expr)}
+	for i, r := range repeats {
+		line := fmt.Sprintf("#%d %s=%s", i+1, r.Trace.Expr, parser.FormatValue(r.Value))
+		if r.Process != "" {
+			line += fmt.Sprintf(" (详情: %s)", r.Process)
 		}
+		lines = append(lines, line)
 	}
-	
-	return result
+	return strings.Join(lines, "\n")
 }
 
-// CoC7RollAttributes 生成 CoC7 属性
-func (e *Engine) CoC7RollAttributes() string {
-	var attrs []string
-	for _, attr := range CoC7Attributes {
-		roll := rand.Intn(6) + rand.Intn(6) + rand.Intn(6) + 3
-		value := roll * 5
-		attrs = append(attrs, fmt.Sprintf("%s: %d", attr, value))
+// splitReason 在第一个满足 isReason 的字符处将输入拆分为骰子表达式和掷骰理由
+func (e *Engine) splitReason(input string, isReason func(rune) bool) (string, string) {
+	input = strings.TrimSpace(input)
+	expr, reason := input, ""
+	if end := strings.IndexFunc(input, isReason); end != -1 {
+		expr = strings.TrimSpace(input[:end])
+		reason = strings.TrimSpace(input[end:])
+	}
+	if expr == "" {
+		expr = e.defaultDice()
 	}
-	return "COC7版角色属性：\n" + strings.Join(attrs, "\n")
+	return expr, reason
+}
+
+// defaultDice 返回默认骰子表达式，例如 1d100
+func (e *Engine) defaultDice() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return fmt.Sprintf("1d%d", e.defaultDiceSides)
 }
 
-// CoC7SkillCheck 技能检定
+// CoC7SkillCheck 技能检定，使用规则书的大成功和大失败范围
 func (e *Engine) CoC7SkillCheck(skillValue int) string {
 	if skillValue < 1 || skillValue > 100 {
 		return "技能值必须在1-100之间"
 	}
-	
-	roll := rand.Intn(100) + 1
-	result := fmt.Sprintf("技能检定 %d → %d", skillValue, roll)
-	
-	if roll <= skillValue {
-		if roll <= 5 {
-			result += " 大成功！"
-		} else if roll == 1 {
-			result += " 成功"
-		} else {
-			result += " 成功"
-		}
-	} else {
-		if roll >= 96 {
-			result += " 大失败！"
-		} else {
-			result += " 失败"
-		}
+	return e.CoC7Check("技能", skillValue, DifficultyRegular, DefaultCoC7Rules)
+}
+
+// CoC7Roll 掷 1d100 并按规则判定成功等级
+func (e *Engine) CoC7Roll(skillValue, difficulty int, rules CoC7Rules) *CoC7Result {
+	roll := e.intn(100) + 1
+	return &CoC7Result{
+		Roll:       roll,
+		Skill:      skillValue,
+		Difficulty: difficulty,
+		Level:      rules.Resolve(roll, skillValue, difficulty),
 	}
-	
-	return result
 }
 
-// CoC7SanCheck 理智检定
-func (e *Engine) CoC7SanCheck(successValue, failValue int) string {
-	if successValue < 1 || successValue > 100 || failValue < 1 || failValue > 100 {
-		return "理智值必须在1-100之间"
+// CoC7BonusRoll 使用奖励骰（bonus > 0）或惩罚骰（bonus < 0）的 d100 检定
+// 掷骰由解析器的奖惩骰表达式完成，结果中保留所有十位骰
+func (e *Engine) CoC7BonusRoll(skillValue, bonus, difficulty int, rules CoC7Rules) (*CoC7Result, error) {
+	expr := fmt.Sprintf("1b%d", bonus)
+	if bonus < 0 {
+		expr = fmt.Sprintf("1p%d", -bonus)
 	}
-	
-	roll := rand.Intn(100) + 1
-	result := fmt.Sprintf("理智检定 sc %d/%d → %d", successValue, failValue, roll)
-	
-	if roll <= successValue {
-		result += " 成功"
-	} else if roll >= failValue {
-		result += " 失败"
-	} else {
-		result += " 普通"
+	res, err := e.newContext().Eval(expr)
+	if err != nil {
+		return nil, err
 	}
-	
-	return result
+	roll, ok := res.Value.(int)
+	node := findTrace(res.Trace, "bonus", "penalty")
+	if !ok || node == nil || len(node.Dice) < 2 {
+		return nil, fmt.Errorf("无法读取奖惩骰结果: %s", expr)
+	}
+
+	result := &CoC7Result{
+		Roll:       roll,
+		Skill:      skillValue,
+		Difficulty: difficulty,
+		Level:      rules.Resolve(roll, skillValue, difficulty),
+		Bonus:      bonus,
+		Units:      node.Dice[0].Value,
+	}
+	for _, die := range node.Dice[1:] {
+		result.Tens = append(result.Tens, die.Value)
+	}
+	return result, nil
 }
 
-// CoC7GrowthCheck 成长检定
-func (e *Engine) CoC7GrowthCheck(skillValue int) string {
-	if skillValue < 1 || skillValue > 100 {
-		return "技能值必须在1-100之间"
+// findTrace 在求值树中查找第一个指定类型的节点
+func findTrace(node *parser.TraceNode, kinds ...string) *parser.TraceNode {
+	if node == nil {
+		return nil
 	}
-	
-	roll := rand.Intn(100) + 1
-	if roll > skillValue {
-		increase := rand.Intn(10) + 1
-		newSkill := skillValue + increase
-		if newSkill > 100 {
-			newSkill = 100
+	for _, kind := range kinds {
+		if node.Kind == kind {
+			return node
+		}
+	}
+	for _, child := range node.Children {
+		if found := findTrace(child, kinds...); found != nil {
+			return found
 		}
-		return fmt.Sprintf("成长检定 en %d → %d (失败)，技能提升到 %d", skillValue, roll, newSkill)
 	}
-	return fmt.Sprintf("成长检定 en %d → %d (成功)，技能未提升", skillValue, roll)
+	return nil
 }
 
-// CoC7TempInsanity 临时疯狂
-func (e *Engine) CoC7TempInsanity() string {
-	effects := []string{
-		"1. 失忆 - 你忘记了之前发生的事情",
-		"2. 被收容 - 你被送往精神病院",
-		"3. 偏执 - 你认为有人要伤害你",
-		"4. 狂躁 - 你变得极度兴奋和活跃",
-		"5. 恐惧 - 你感到极度的恐惧",
-		"6. 幻觉 - 你看到了不存在的东西",
-		"7. 失语 - 你无法说话",
-		"8. 失明 - 你暂时失明",
-		"9. 失聪 - 你暂时失聪",
-		"10. 疯狂 - 你陷入疯狂状态",
-	}
-	
-	roll := rand.Intn(10) + 1
-	return fmt.Sprintf("临时疯狂 ti → %d\n%s", roll, effects[roll-1])
+// CoC7Check 技能检定并格式化结果，label 例如 "张三 的侦查"
+func (e *Engine) CoC7Check(label string, skillValue, difficulty int, rules CoC7Rules) string {
+	return FormatCoC7Result(label, e.CoC7Roll(skillValue, difficulty, rules))
 }
 
-// CoC7LongInsanity 长期疯狂
-func (e *Engine) CoC7LongInsanity() string {
-	effects := []string{
-		"1. 失忆 - 你失去了所有记忆",
-		"2. 假性失忆 - 你编造了一段虚假记忆",
-		"3. 偏执 - 持续的被迫害妄想",
-		"4. 人格分裂 - 出现了第二人格",
-		"5. 恐惧 - 对某种事物的恐惧",
-		"6. 狂热 - 对某种理念的狂热",
-		"7. 社交恐惧 - 害怕与人交往",
-		"8. 抑郁 - 深深的绝望感",
-		"9. 躁狂 - 过度活跃和冲动",
-		"10. 麻木 - 情感完全丧失",
+// CoC7GrowthCheck 成长检定
+func (e *Engine) CoC7GrowthCheck(skillValue int) string {
+	if skillValue < 1 || skillValue > 100 {
+		return "技能值必须在1-100之间"
 	}
-	
-	roll := rand.Intn(10) + 1
-	return fmt.Sprintf("长期疯狂 li → %d\n%s", roll, effects[roll-1])
+	return FormatGrowthResult("成长检定", e.CoC7Growth(skillValue))
 }
 
 // DnD5ERollAttribute 生成 DnD 属性
 func (e *Engine) DnD5ERollAttribute(stat string) string {
 	rolls := []int{
-		rand.Intn(6) + 1,
-		rand.Intn(6) + 1,
-		rand.Intn(6) + 1,
-		rand.Intn(6) + 1,
+		e.intn(6) + 1,
+		e.intn(6) + 1,
+		e.intn(6) + 1,
+		e.intn(6) + 1,
 	}
 	
 	// 去掉最小的
@@ -273,97 +288,16 @@ func (e *Engine) DnD5ERollAttribute(stat string) string {
 		total += r
 	}
 	
-	mod := (total - 10) / 2
-	modStr := ""
-	if mod >= 0 {
-		modStr = fmt.Sprintf("+%d", mod)
-	} else {
-		modStr = fmt.Sprintf("%d", mod)
-	}
-	
-	return fmt.Sprintf("DND %s: %d (修正值 %s)", strings.ToUpper(stat), total, modStr)
+	return fmt.Sprintf("DND %s: %d (修正值 %+d)", strings.ToUpper(stat), total, AbilityModifier(total))
 }
 
-// DnD5EAttack 攻击检定
+// DnD5EAttack 攻击检定，掷出 20 时提示投掷重击伤害
 func (e *Engine) DnD5EAttack(attackBonus int) string {
-	roll := rand.Intn(20) + 1
-	total := roll + attackBonus
-	result := fmt.Sprintf("攻击检定: 1D20(%d) + %d = %d", roll, attackBonus, total)
-	
-	if roll == 20 {
-		result += " 重击！"
-	} else if roll == 1 {
-		result += " 失手！"
-	}
-	
-	return result
+	r := e.RollD20(attackBonus)
+	return FormatAttack("攻击检定", r) + critDamagePrompt(r, "[伤害表达式]")
 }
 
 // DnD5EInitiative 先攻检定
 func (e *Engine) DnD5EInitiative(dexMod int) string {
-	roll := rand.Intn(20) + 1
-	total := roll + dexMod
-	return fmt.Sprintf("先攻检定: 1D20(%d) + %d = %d", roll, dexMod, total)
-}
-
-// DnD5ESave 豁免检定
-func (e *Engine) DnD5ESave(saveDC int) string {
-	roll := rand.Intn(20) + 1
-	total := roll + saveDC
-	result := fmt.Sprintf("豁免检定: 1D20(%d) + %d = %d", roll, saveDC, total)
-	
-	if roll == 20 {
-		result += " 成功！"
-	} else if roll == 1 {
-		result += " 失败！"
-	}
-	
-	return result
-}
-
-// DnD5ECheck 技能检定
-func (e *Engine) DnD5ECheck(skillName string, profBonus int) string {
-	roll := rand.Intn(20) + 1
-	total := roll + profBonus
-	result := fmt.Sprintf("%s技能检定: 1D20(%d) + %d = %d", skillName, roll, profBonus, total)
-	
-	if roll == 20 {
-		result += " 大成功！"
-	} else if roll == 1 {
-		result += " 大失败！"
-	}
-	
-	return result
-}
-
-// AdvantageRoll 优势掷骰
-func (e *Engine) AdvantageRoll() (int, int) {
-	r1 := rand.Intn(20) + 1
-	r2 := rand.Intn(20) + 1
-	return r1, r2
-}
-
-// DisadvantageRoll 劣势掷骰
-func (e *Engine) DisadvantageRoll() (int, int) {
-	r1 := rand.Intn(20) + 1
-	r2 := rand.Intn(20) + 1
-	return r1, r2
-}
-
-// GetAdvantageResult 获取优势掷骰结果
-func (e *Engine) GetAdvantageResult(skillName string, modifier int) string {
-	r1, r2 := e.AdvantageRoll()
-	best := int(math.Max(float64(r1), float64(r2)))
-	total := best + modifier
-	return fmt.Sprintf("%s优势检定: 1D20(%d) 1D20(%d) = %d + %d = %d", 
-		skillName, r1, r2, best, modifier, total)
-}
-
-// GetDisadvantageResult 获取劣势掷骰结果
-func (e *Engine) GetDisadvantageResult(skillName string, modifier int) string {
-	r1, r2 := e.DisadvantageRoll()
-	worst := int(math.Min(float64(r1), float64(r2)))
-	total := worst + modifier
-	return fmt.Sprintf("%s劣势检定: 1D20(%d) 1D20(%d) = %d + %d = %d", 
-		skillName, r1, r2, worst, modifier, total)
+	return FormatD20("先攻检定", e.RollD20(dexMod))
 }
@@ -0,0 +1,92 @@
+package dice
+
+import (
+	"island/rng"
+	"strings"
+	"testing"
+)
+
+// TestRollGolden 使用回放来源固定骰子点数，检查完整的回复文本
+func TestRollGolden(t *testing.T) {
+	tests := []struct {
+		input string
+		draws []int
+		want  string
+	}{
+		{"3d6", []int{0, 1, 2}, "掷骰结果: 3d6=6 (详情: 3d6 = [1 2 3] = 6)"},
+		{"4d6kh3 力量", []int{2, 5, 0, 3}, "因为 力量，掷骰结果: 4d6kh3=13 (详情: 4d6kh3 = [6 4 3] = 13)"},
+		{"", []int{41}, "掷骰结果: 1d100=42 (详情: 1d100 = [42] = 42)"},
+		{"1d20+5 attack", []int{19}, "因为 attack，掷骰结果: 1d20+5=25 (详情: 1d20 = [20] = 20)"},
+		{"3#1d20+5 攻击", []int{19, 0, 9}, "因为 攻击，掷骰结果: 3#1d20+5\n" +
+			"#1 1d20+5=25 (详情: 1d20 = [20] = 20)\n" +
+			"#2 1d20+5=6 (详情: 1d20 = [1] = 1)\n" +
+			"#3 1d20+5=15 (详情: 1d20 = [10] = 10)"},
+		{"1000000000d6", nil, "掷骰出错: 1000000000d6\n第 11 个字符: 骰子数量过多: 上限为 1000"},
+		{"1d1000000", nil, "掷骰出错: 1d1000000\n第 2 个字符: 骰子面数过多: 上限为 10000"},
+		{"8192#1000d6", nil, "掷骰出错: 8192#1000d6\n第 5 个字符: 迭代次数超过上限: 20"},
+	}
+
+	for _, tt := range tests {
+		replay := rng.NewReplayValues(tt.draws...)
+		got := NewWithSource(replay).Roll(tt.input)
+		if got != tt.want {
+			t.Errorf("Roll(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		if err := replay.Err(); err != nil {
+			t.Errorf("Roll(%q): %v", tt.input, err)
+		}
+		if n := replay.Remaining(); n != 0 {
+			t.Errorf("Roll(%q) left %d draws unused", tt.input, n)
+		}
+	}
+}
+
+// TestChecksGolden 检定类命令同样使用引擎的随机数来源
+func TestChecksGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		draws []int
+		roll  func(e *Engine) string
+		want  string
+	}{
+		{"coc7 critical", []int{0}, func(e *Engine) string { return e.CoC7SkillCheck(50) }, "技能检定 50 → 1 大成功！"},
+		{"coc7 extreme", []int{4}, func(e *Engine) string { return e.CoC7SkillCheck(50) }, "技能检定 50 → 5 极难成功"},
+		{"coc7 low skill fumble", []int{97}, func(e *Engine) string { return e.CoC7SkillCheck(40) }, "技能检定 40 → 98 大失败！"},
+		{"coc7 failure", []int{97}, func(e *Engine) string { return e.CoC7SkillCheck(50) }, "技能检定 50 → 98 失败"},
+		{"coc7 fumble", []int{99}, func(e *Engine) string { return e.CoC7SkillCheck(50) }, "技能检定 50 → 100 大失败！"},
+		{"dnd attribute", []int{0, 2, 2, 2}, func(e *Engine) string { return e.DnD5ERollAttribute("str") }, "DND STR: 9 (修正值 -1)"},
+		{"dnd attribute positive", []int{5, 5, 0, 4}, func(e *Engine) string { return e.DnD5ERollAttribute("dex") }, "DND DEX: 17 (修正值 +3)"},
+		{"dnd attack", []int{19}, func(e *Engine) string { return e.DnD5EAttack(5) }, "攻击检定: 1D20(20) + 5 = 25 重击！\n使用 .damage [伤害表达式] crit 投掷重击伤害，伤害骰翻倍"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.roll(NewWithSource(rng.NewReplayValues(tt.draws...))); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestDistribution 分布回复使用精确概率，取值较多时合并为区间
+func TestDistribution(t *testing.T) {
+	e := New()
+	want := "2d4 的分布: 期望 5.00，标准差 1.58，范围 2~8\n" +
+		"2: 6.25% (累计 6.25%) ███\n" +
+		"3: 12.50% (累计 18.75%) █████\n" +
+		"4: 18.75% (累计 37.50%) ████████\n" +
+		"5: 25.00% (累计 62.50%) ██████████\n" +
+		"6: 18.75% (累计 81.25%) ████████\n" +
+		"7: 12.50% (累计 93.75%) █████\n" +
+		"8: 6.25% (累计 100.00%) ███"
+	if got := e.Distribution("2d4"); got != want {
+		t.Errorf("Distribution(2d4) = %q, want %q", got, want)
+	}
+
+	lines := strings.Split(e.Distribution("1d100"), "\n")
+	if len(lines) != MAX_DIST_LINES+1 || !strings.HasPrefix(lines[1], "1~5: 5.00%") {
+		t.Errorf("Distribution(1d100) lines = %q", lines)
+	}
+
+	if got := e.Distribution("1d6!"); !strings.HasPrefix(got, "无法计算分布: 1d6!\n") {
+		t.Errorf("Distribution(1d6!) = %q", got)
+	}
+}
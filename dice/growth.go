@@ -0,0 +1,97 @@
+package dice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GROWTH_ALWAYS 成长检定掷出大于此值时总能成长
+const GROWTH_ALWAYS = 95
+
+// GrowthResult 一次成长检定的结果
+type GrowthResult struct {
+	Skill    int // 检定前的技能值
+	Roll     int
+	Improved bool
+	Gain     int // 成长的点数 (1d10)
+}
+
+// NewSkill 成长后的技能值
+func (r *GrowthResult) NewSkill() int {
+	return r.Skill + r.Gain
+}
+
+// CoC7Growth 成长检定：d100 大于技能值或大于 95 时，技能增加 1d10
+func (e *Engine) CoC7Growth(skill int) *GrowthResult {
+	result := &GrowthResult{Skill: skill, Roll: e.intn(100) + 1}
+	if result.Roll > skill || result.Roll > GROWTH_ALWAYS {
+		result.Improved = true
+		result.Gain = e.intn(10) + 1
+	}
+	return result
+}
+
+// FormatGrowthResult 格式化成长检定结果，例如 "侦查 60 → 75 成长 +4，60→64"
+func FormatGrowthResult(label string, r *GrowthResult) string {
+	if !r.Improved {
+		return fmt.Sprintf("%s %d → %d 未成长", label, r.Skill, r.Roll)
+	}
+	return fmt.Sprintf("%s %d → %d 成长 +%d，%d→%d", label, r.Skill, r.Roll, r.Gain, r.Skill, r.NewSkill())
+}
+
+// growthCheck 完成 .en：对每个技能进行成长检定，人物卡中的技能成长后保存
+// 参数可以是技能名、技能名加技能值或单独的技能值，例如 .en 侦查 图书馆 聆听、.en 侦查60、.en 50
+func growthCheck(ctx *CommandContext, input string) string {
+	fields := strings.Fields(input)
+	if len(fields) == 1 {
+		if value, err := strconv.Atoi(fields[0]); err == nil {
+			return ctx.Engine.CoC7GrowthCheck(value)
+		}
+	}
+
+	card := currentCard(ctx)
+	var lines []string
+	improved, changed := 0, false
+	for _, field := range fields {
+		args, ok := parseSkillCheckArgs(field)
+		if !ok || args.difficulty != DifficultyRegular || args.modifier != 0 || args.name == "" {
+			return fmt.Sprintf("无法识别: %s\n用法: .en [技能名]... 例如 .en 侦查 图书馆 聆听", field)
+		}
+		value := args.value
+		if !args.hasValue {
+			// 与 .ra 相同，人物卡中没有记录时使用技能基础值
+			var found bool
+			value, _, found = cardSkill(card, args.name)
+			switch {
+			case !found && card == nil:
+				return "你在本群还没有人物卡，请先使用 .st 记录技能，或直接给出技能值，例如 .en 侦查60"
+			case !found:
+				return fmt.Sprintf("未找到技能 %s，请先使用 .st 记录，或直接给出技能值，例如 .en %s60", args.name, args.name)
+			}
+		}
+
+		result := ctx.Engine.CoC7Growth(value)
+		lines = append(lines, FormatGrowthResult(args.name, result))
+		if result.Improved {
+			improved++
+			if card != nil && !args.hasValue {
+				card.SetInt(args.name, result.NewSkill())
+				changed = true
+			}
+		}
+	}
+
+	header := "成长检定"
+	if card != nil {
+		header = card.Name + " 的成长检定"
+	}
+	lines = append([]string{header + ":"}, lines...)
+	lines = append(lines, fmt.Sprintf("共 %d 项，成长 %d 项", len(fields), improved))
+	if changed {
+		if err := saveCard(ctx, card, false); err != nil {
+			return fmt.Sprintf("保存人物卡失败: %v", err)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
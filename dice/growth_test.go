@@ -0,0 +1,43 @@
+package dice
+
+import "testing"
+
+// TestGrowthCheck .en 对多个技能进行成长检定并保存到人物卡
+func TestGrowthCheck(t *testing.T) {
+	registry, store := newCardTestRegistry(t, t.TempDir())
+
+	tests := []struct {
+		group int64
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{2, ".st 侦查60 图书馆96", nil, "已更新 未命名角色 的属性: 侦查 60，图书馆 96"},
+		{2, ".en 侦查 图书馆 聆听", []int{74, 3, 96, 9, 10}, "未命名角色 的成长检定:\n" +
+			"侦查 60 → 75 成长 +4，60→64\n" +
+			"图书馆 96 → 97 成长 +10，96→106\n" +
+			"聆听 20 → 11 未成长\n" +
+			"共 3 项，成长 2 项"},
+		{2, ".en 侦查", []int{9}, "未命名角色 的成长检定:\n侦查 64 → 10 未成长\n共 1 项，成长 0 项"},
+		{2, ".en 50", []int{79, 0}, "成长检定 50 → 80 成长 +1，50→51"},
+		{2, ".en 炼金", nil, "未找到技能 炼金，请先使用 .st 记录，或直接给出技能值，例如 .en 炼金60"},
+		{3, ".en 侦查", []int{79, 2}, "成长检定:\n侦查 25 → 80 成长 +3，25→28\n共 1 项，成长 1 项"},
+		{3, ".en 炼金", nil, "你在本群还没有人物卡，请先使用 .st 记录技能，或直接给出技能值，例如 .en 侦查60"},
+		{3, ".en 侦查40", []int{20}, "成长检定:\n侦查 40 → 21 未成长\n共 1 项，成长 0 项"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, tt.group, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+
+	card, _ := store.ActiveCard(1, 2)
+	for name, want := range map[string]int{"侦查": 64, "图书馆": 106} {
+		if got, _ := card.Int(name); got != want {
+			t.Errorf("saved %s = %d, want %d", name, got, want)
+		}
+	}
+	if _, ok := card.Int("聆听"); ok {
+		t.Error("聆听 should not be saved when it did not grow")
+	}
+}
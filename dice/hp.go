@@ -0,0 +1,450 @@
+package dice
+
+import (
+	"fmt"
+	"island/storage"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HP_BAR_WIDTH 生命值条的格数
+const HP_BAR_WIDTH = 10
+
+// DEATH_SAVES 死亡豁免成功或失败达到此次数时稳定或死亡
+const DEATH_SAVES = 3
+
+// hpSetRegex 匹配 当前值[/上限]，例如 25/45
+var hpSetRegex = regexp.MustCompile(`^(\d+)\s*(?:/\s*(\d+))?$`)
+
+// hpChangeRegex 匹配生命值增减，例如 -7、+2d4+2、-2d6 crit
+var hpChangeRegex = regexp.MustCompile(`^([+\-])\s*(.+?)(?:\s+(crit|重击))?$`)
+
+const hpUsage = "用法:\n" +
+	".hp - 查看生命值\n" +
+	".hp 25/45 - 设置当前生命值和上限，.hp max 45 只设置上限\n" +
+	".hp -7、.hp -2d6 crit - 受到伤害，生命值为 0 时受到重击记两次死亡豁免失败\n" +
+	".hp +2d4+2 - 恢复生命值\n" +
+	".hp temp 5 - 获得临时生命值\n" +
+	".hp clear - 清除重伤、濒死和死亡豁免状态"
+
+// hpState 读取人物卡的当前生命值和上限，没有上限时视为当前值
+func hpState(card *storage.CharacterCard) (current, maxHP int, ok bool) {
+	current, ok = card.Int("生命值")
+	if maxHP = recordedMaxHP(card); maxHP == 0 {
+		maxHP = current
+	}
+	return current, maxHP, ok
+}
+
+// recordedMaxHP 人物卡记录的生命值上限，未记录时 CoC7 人物卡按 (体质+体型)/10 计算，都没有时返回 0
+func recordedMaxHP(card *storage.CharacterCard) int {
+	if card.HP != nil && card.HP.Max > 0 {
+		return card.HP.Max
+	}
+	if card.DnD == nil {
+		con, hasCon := card.Int("体质")
+		siz, hasSiz := card.Int("体型")
+		if hasCon && hasSiz {
+			return (con + siz) / 10
+		}
+	}
+	return 0
+}
+
+// hpStatus 生命值归零后的状态，例如 重伤、濒死、死亡豁免 成功1/3 失败2/3
+func hpStatus(card *storage.CharacterCard, current int) []string {
+	hp := card.HP
+	if hp == nil {
+		hp = &storage.HitPoints{}
+	}
+	var status []string
+	if hp.MajorWound && !hp.Dead {
+		status = append(status, "重伤")
+	}
+	switch {
+	case hp.Dead:
+		status = append(status, "死亡")
+	case hp.Dying:
+		status = append(status, "濒死")
+	case current > 0:
+	case hp.Stable:
+		status = append(status, "昏迷，情况稳定")
+	default:
+		status = append(status, "昏迷")
+		if card.DnD != nil {
+			status = append(status, fmt.Sprintf("死亡豁免 成功%d/%d 失败%d/%d", hp.Successes, DEATH_SAVES, hp.Failures, DEATH_SAVES))
+		}
+	}
+	return status
+}
+
+// hpBar 生命值条，例如 "[██████░░░░] 12/20 临时+5"
+func hpBar(card *storage.CharacterCard) string {
+	current, maxHP, _ := hpState(card)
+	filled := 0
+	if maxHP > 0 && current > 0 {
+		filled = min((current*HP_BAR_WIDTH+maxHP-1)/maxHP, HP_BAR_WIDTH)
+	}
+	text := fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("█", filled), strings.Repeat("░", HP_BAR_WIDTH-filled), current, maxHP)
+	if card.HP != nil && card.HP.Temp > 0 {
+		text += fmt.Sprintf(" 临时+%d", card.HP.Temp)
+	}
+	if status := hpStatus(card, current); len(status) > 0 {
+		text += "（" + strings.Join(status, "，") + "）"
+	}
+	return text
+}
+
+// clearDownState 生命值恢复到 0 以上时清除死亡豁免和濒死状态
+func clearDownState(hp *storage.HitPoints) {
+	hp.Successes, hp.Failures = 0, 0
+	hp.Stable, hp.Dying = false, false
+}
+
+// hpCommand 完成 .hp：查看或修改当前人物卡的生命值
+func hpCommand(ctx *CommandContext, args string) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用人物卡"
+	}
+	card := currentCard(ctx)
+	if card == nil {
+		return "你在本群还没有人物卡，请先使用 .pc new [角色名] 或 .st 创建"
+	}
+	if card.HP == nil {
+		card.HP = &storage.HitPoints{}
+	}
+	current, maxHP, ok := hpState(card)
+
+	fields := strings.Fields(args)
+	var lines []string
+	switch {
+	case len(fields) == 0:
+		if !ok {
+			return fmt.Sprintf("%s 没有记录生命值，请使用 .hp 当前/上限 设置，例如 .hp 25/45", card.Name)
+		}
+		return fmt.Sprintf("%s 的生命值 %s", card.Name, hpBar(card))
+	case len(fields) == 2 && (fields[0] == "temp" || fields[0] == "临时"):
+		temp, process, err := ctx.Engine.EvalInt(fields[1])
+		if err != nil {
+			return fmt.Sprintf("临时生命值表达式有误: %s\n%v", fields[1], err)
+		}
+		lines = append(lines, setTempHP(card, fields[1], temp, process))
+	case len(fields) == 2 && (fields[0] == "max" || fields[0] == "上限"):
+		value, err := strconv.Atoi(fields[1])
+		if err != nil || value < 1 {
+			return "生命值上限必须是正整数"
+		}
+		card.HP.Max = value
+		lines = append(lines, fmt.Sprintf("%s 的生命值上限设为 %d", card.Name, value))
+		if current > value {
+			card.SetInt("生命值", value)
+		}
+	case len(fields) == 1 && (fields[0] == "clear" || fields[0] == "清除"):
+		clearDownState(card.HP)
+		card.HP.MajorWound, card.HP.Dead = false, false
+		lines = append(lines, fmt.Sprintf("已清除 %s 的重伤、濒死和死亡豁免状态", card.Name))
+	case hpSetRegex.MatchString(args):
+		m := hpSetRegex.FindStringSubmatch(args)
+		value, _ := strconv.Atoi(m[1])
+		if m[2] != "" {
+			card.HP.Max, _ = strconv.Atoi(m[2])
+		} else if recordedMaxHP(card) == 0 {
+			// 没有上限时以设置的值作为上限，之后受伤和恢复都按这个上限计算
+			card.HP.Max = value
+		}
+		card.SetInt("生命值", value)
+		if value > 0 {
+			clearDownState(card.HP)
+			card.HP.Dead = false
+		}
+		lines = append(lines, fmt.Sprintf("%s 的生命值设为 %d", card.Name, value))
+	case hpChangeRegex.MatchString(args):
+		if !ok {
+			return fmt.Sprintf("%s 没有记录生命值，请使用 .hp 当前/上限 设置，例如 .hp 25/45", card.Name)
+		}
+		if recordedMaxHP(card) == 0 {
+			// 生命值由 .st 记录、没有上限时，以当前值作为上限
+			card.HP.Max = maxHP
+		}
+		m := hpChangeRegex.FindStringSubmatch(args)
+		amount, process, err := ctx.Engine.EvalInt(m[2])
+		if err != nil {
+			return fmt.Sprintf("表达式有误: %s\n%v", m[2], err)
+		}
+		amount = max(amount, 0)
+		amountText := strconv.Itoa(amount)
+		if process != "" {
+			amountText = fmt.Sprintf("%s=%d", m[2], amount)
+		}
+		if m[1] == "+" {
+			lines = healHP(card, current, maxHP, amountText, amount)
+		} else {
+			lines = damageHP(ctx, card, current, maxHP, amountText, amount, m[3] != "")
+		}
+	default:
+		return hpUsage
+	}
+
+	if err := saveCard(ctx, card, false); err != nil {
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+	return strings.Join(append(lines, hpBar(card)), "\n")
+}
+
+// setTempHP 获得临时生命值，临时生命值不叠加，保留较高的一方
+func setTempHP(card *storage.CharacterCard, expr string, temp int, process string) string {
+	text := strconv.Itoa(temp)
+	if process != "" {
+		text = fmt.Sprintf("%s=%d", expr, temp)
+	}
+	old := card.HP.Temp
+	if temp > 0 && temp <= old {
+		return fmt.Sprintf("%s 获得临时生命值 %s，临时生命值不叠加，保留原有的 %d", card.Name, text, old)
+	}
+	card.HP.Temp = max(temp, 0)
+	return fmt.Sprintf("%s 获得临时生命值 %s，临时生命值 %d → %d", card.Name, text, old, card.HP.Temp)
+}
+
+// healHP 恢复生命值，不超过上限，从 0 恢复时清除死亡豁免和濒死状态
+func healHP(card *storage.CharacterCard, current, maxHP int, amountText string, amount int) []string {
+	if card.HP.Dead {
+		return []string{fmt.Sprintf("%s 已经死亡，无法恢复生命值，使用 .hp clear 清除状态", card.Name)}
+	}
+	healed := min(current+amount, max(maxHP, current))
+	card.SetInt("生命值", healed)
+	lines := []string{fmt.Sprintf("%s 恢复 %s 点生命值，生命值 %d → %d", card.Name, amountText, current, healed)}
+	if current == 0 && healed > 0 {
+		if card.HP.Dying {
+			lines = append(lines, "脱离濒死状态")
+		} else {
+			lines = append(lines, "恢复意识")
+		}
+		clearDownState(card.HP)
+	}
+	return lines
+}
+
+// damageHP 受到伤害，临时生命值先抵消伤害，并按规则处理生命值归零
+func damageHP(ctx *CommandContext, card *storage.CharacterCard, current, maxHP int, amountText string, amount int, crit bool) []string {
+	hp := card.HP
+	if hp.Dead {
+		return []string{fmt.Sprintf("%s 已经死亡", card.Name)}
+	}
+	damage := amount
+	tempText := ""
+	if hp.Temp > 0 && damage > 0 {
+		absorbed := min(hp.Temp, damage)
+		tempText = fmt.Sprintf("，临时生命值 %d → %d", hp.Temp, hp.Temp-absorbed)
+		hp.Temp -= absorbed
+		damage -= absorbed
+	}
+	remaining := max(current-damage, 0)
+	card.SetInt("生命值", remaining)
+	lines := []string{fmt.Sprintf("%s 受到 %s 点伤害%s，生命值 %d → %d", card.Name, amountText, tempText, current, remaining)}
+	if damage == 0 {
+		return lines
+	}
+	if card.DnD != nil {
+		return append(lines, dndDamageState(hp, current, remaining, maxHP, damage, crit)...)
+	}
+	return append(lines, coc7DamageState(ctx, card, remaining, maxHP, damage)...)
+}
+
+// dndDamageState DnD5E 生命值归零：溢出伤害达到上限时当场死亡，否则昏迷并进行死亡豁免
+func dndDamageState(hp *storage.HitPoints, current, remaining, maxHP, damage int, crit bool) []string {
+	switch {
+	case current == 0 && damage >= maxHP:
+		hp.Dead = true
+		return []string{"生命值为 0 时受到的伤害达到生命值上限，角色当场死亡"}
+	case current == 0:
+		failures := 1
+		if crit {
+			failures = 2
+		}
+		hp.Failures += failures
+		hp.Stable = false
+		if hp.Failures >= DEATH_SAVES {
+			hp.Dead = true
+			return []string{fmt.Sprintf("生命值为 0 时受到伤害，死亡豁免失败 +%d，失败 %d 次，角色死亡", failures, DEATH_SAVES)}
+		}
+		return []string{fmt.Sprintf("生命值为 0 时受到伤害，死亡豁免失败 +%d", failures)}
+	case remaining == 0 && damage-current >= maxHP:
+		hp.Dead = true
+		return []string{fmt.Sprintf("溢出伤害 %d 达到生命值上限，角色当场死亡", damage-current)}
+	case remaining == 0:
+		clearDownState(hp)
+		return []string{"生命值降为 0，陷入昏迷，请在每个回合开始时使用 .ds 进行死亡豁免"}
+	}
+	return nil
+}
+
+// coc7DamageState CoC7 受伤：单次伤害达到上限即死亡，达到上限一半为重伤，重伤且生命值归零时濒死
+func coc7DamageState(ctx *CommandContext, card *storage.CharacterCard, remaining, maxHP, damage int) []string {
+	hp := card.HP
+	if damage >= maxHP {
+		hp.Dead = true
+		return []string{"单次伤害达到生命值上限，角色死亡"}
+	}
+	var lines []string
+	if damage >= max(maxHP/2, 1) && !hp.MajorWound {
+		hp.MajorWound = true
+		lines = append(lines, "单次伤害达到生命值上限的一半：受到重伤")
+		if remaining > 0 {
+			con, ok := card.Int("体质")
+			if !ok {
+				lines = append(lines, "请进行体质检定，失败则陷入昏迷")
+			} else {
+				r := ctx.Engine.CoC7Roll(con, DifficultyRegular, coc7Rules(ctx))
+				result := FormatCoC7Result(card.Name+" 的体质", r)
+				if r.Passed() {
+					lines = append(lines, result+"，保持清醒")
+				} else {
+					lines = append(lines, result+"，陷入昏迷")
+				}
+			}
+		}
+	}
+	if remaining == 0 {
+		if hp.MajorWound {
+			hp.Dying = true
+			lines = append(lines, "生命值归零且处于重伤状态：濒死，每轮使用 .ds 进行体质检定，失败则死亡；急救成功可暂时稳定")
+		} else {
+			lines = append(lines, "生命值归零，陷入昏迷")
+		}
+	}
+	return lines
+}
+
+// deathSave 完成 .ds：DnD5E 死亡豁免，CoC7 濒死时的体质检定
+func deathSave(ctx *CommandContext) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用人物卡"
+	}
+	card := currentCard(ctx)
+	if card == nil {
+		return "你在本群还没有人物卡，请先使用 .pc new [角色名] 或 .st 创建"
+	}
+	if card.HP == nil {
+		card.HP = &storage.HitPoints{}
+	}
+	hp := card.HP
+	current, ok := card.Int("生命值")
+	switch {
+	case hp.Dead:
+		return fmt.Sprintf("%s 已经死亡", card.Name)
+	case !ok || current > 0:
+		return fmt.Sprintf("%s 的生命值不为 0，无需检定", card.Name)
+	}
+
+	var lines []string
+	if card.DnD != nil {
+		if hp.Stable {
+			return fmt.Sprintf("%s 情况稳定，无需死亡豁免", card.Name)
+		}
+		lines = dndDeathSave(ctx, card)
+	} else {
+		if !hp.Dying {
+			return fmt.Sprintf("%s 没有濒死，只是陷入昏迷，无需检定", card.Name)
+		}
+		con, ok := card.Int("体质")
+		if !ok {
+			return "人物卡没有体质，请先使用 .st 体质60 记录"
+		}
+		r := ctx.Engine.CoC7Roll(con, DifficultyRegular, coc7Rules(ctx))
+		result := FormatCoC7Result(card.Name+" 的体质", r)
+		if r.Passed() {
+			lines = append(lines, result+"，本轮存活，仍处于濒死")
+		} else {
+			hp.Dead = true
+			lines = append(lines, result+"，角色死亡")
+		}
+	}
+
+	if err := saveCard(ctx, card, false); err != nil {
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+	return strings.Join(append(lines, hpBar(card)), "\n")
+}
+
+// dndDeathSave DnD5E 死亡豁免：10 以上成功，1 记两次失败，20 恢复 1 点生命值
+func dndDeathSave(ctx *CommandContext, card *storage.CharacterCard) []string {
+	hp := card.HP
+	r := ctx.Engine.RollD20(0)
+	label := fmt.Sprintf("%s 的死亡豁免: 1D20(%d)", card.Name, r.Natural)
+	switch {
+	case r.Natural == 20:
+		card.SetInt("生命值", 1)
+		clearDownState(hp)
+		return []string{label + " 大成功！恢复 1 点生命值并苏醒"}
+	case r.Natural == 1:
+		hp.Failures += 2
+		label += " 大失败！记两次失败"
+	case r.Natural >= 10:
+		hp.Successes++
+		label += " 成功"
+	default:
+		hp.Failures++
+		label += " 失败"
+	}
+
+	switch {
+	case hp.Failures >= DEATH_SAVES:
+		hp.Dead = true
+		return []string{label, fmt.Sprintf("死亡豁免失败 %d 次，角色死亡", DEATH_SAVES)}
+	case hp.Successes >= DEATH_SAVES:
+		hp.Successes, hp.Failures, hp.Stable = 0, 0, true
+		return []string{label, fmt.Sprintf("死亡豁免成功 %d 次，情况稳定", DEATH_SAVES)}
+	}
+	return []string{label}
+}
+
+// HPCommand .hp 指令 (生命值管理)
+type HPCommand struct {
+	BaseCommand
+}
+
+func NewHPCommand() *HPCommand {
+	return &HPCommand{
+		BaseCommand: BaseCommand{
+			name:  "hp",
+			help:  ".hp [当前值/上限|±伤害|temp 临时生命值] - 查看或修改人物卡的生命值",
+			regex: regexp.MustCompile(`^hp\s*(.*)$`),
+		},
+	}
+}
+
+func (c *HPCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *HPCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return hpUsage
+	}
+	return hpCommand(ctx, strings.TrimSpace(matches[1]))
+}
+
+// DeathSaveCommand .ds 指令 (死亡豁免)
+type DeathSaveCommand struct {
+	BaseCommand
+}
+
+func NewDeathSaveCommand() *DeathSaveCommand {
+	return &DeathSaveCommand{
+		BaseCommand: BaseCommand{
+			name:  "ds",
+			help:  ".ds - 生命值为 0 时进行死亡豁免，CoC7 濒死时进行体质检定",
+			regex: regexp.MustCompile(`^ds$`),
+		},
+	}
+}
+
+func (c *DeathSaveCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *DeathSaveCommand) Process(ctx *CommandContext) string {
+	return deathSave(ctx)
+}
@@ -0,0 +1,60 @@
+package dice
+
+import "testing"
+
+// TestHP 生命值增减、临时生命值、DnD5E 死亡豁免和 CoC7 重伤濒死
+func TestHP(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+	runCommand(registry, 1, 2, ".pc new 艾琳 dnd5e")
+	runCommand(registry, 2, 2, ".st 体质60 体型50 生命值11")
+	runCommand(registry, 3, 2, ".pc new 布兰 dnd5e")
+	runCommand(registry, 4, 2, ".st 生命值10")
+
+	const down = "[░░░░░░░░░░] 0/20"
+	tests := []struct {
+		player int64
+		cmd    string
+		draws  []int
+		want   string
+	}{
+		{1, ".hp", nil, "艾琳 没有记录生命值，请使用 .hp 当前/上限 设置，例如 .hp 25/45"},
+		{1, ".hp 20/20", nil, "艾琳 的生命值设为 20\n[██████████] 20/20"},
+		{1, ".hp temp 5", nil, "艾琳 获得临时生命值 5，临时生命值 0 → 5\n[██████████] 20/20 临时+5"},
+		{1, ".hp temp 3", nil, "艾琳 获得临时生命值 3，临时生命值不叠加，保留原有的 5\n[██████████] 20/20 临时+5"},
+		{1, ".hp -2d6", []int{3, 4}, "艾琳 受到 2d6=9 点伤害，临时生命值 5 → 0，生命值 20 → 16\n[████████░░] 16/20"},
+		{1, ".hp +2d4+2", []int{0, 0}, "艾琳 恢复 2d4+2=4 点生命值，生命值 16 → 20\n[██████████] 20/20"},
+		{1, ".hp -23", nil, "艾琳 受到 23 点伤害，生命值 20 → 0\n生命值降为 0，陷入昏迷，请在每个回合开始时使用 .ds 进行死亡豁免\n" +
+			down + "（昏迷，死亡豁免 成功0/3 失败0/3）"},
+		{1, ".ds", []int{9}, "艾琳 的死亡豁免: 1D20(10) 成功\n" + down + "（昏迷，死亡豁免 成功1/3 失败0/3）"},
+		{1, ".ds", []int{0}, "艾琳 的死亡豁免: 1D20(1) 大失败！记两次失败\n" + down + "（昏迷，死亡豁免 成功1/3 失败2/3）"},
+		{1, ".hp -1 crit", nil, "艾琳 受到 1 点伤害，生命值 0 → 0\n生命值为 0 时受到伤害，死亡豁免失败 +2，失败 3 次，角色死亡\n" + down + "（死亡）"},
+		{1, ".ds", nil, "艾琳 已经死亡"},
+		{1, ".hp +5", nil, "艾琳 已经死亡，无法恢复生命值，使用 .hp clear 清除状态\n" + down + "（死亡）"},
+		{1, ".hp clear", nil, "已清除 艾琳 的重伤、濒死和死亡豁免状态\n" + down + "（昏迷，死亡豁免 成功0/3 失败0/3）"},
+		{1, ".ds", []int{19}, "艾琳 的死亡豁免: 1D20(20) 大成功！恢复 1 点生命值并苏醒\n[█░░░░░░░░░] 1/20"},
+		{1, ".hp -25", nil, "艾琳 受到 25 点伤害，生命值 1 → 0\n溢出伤害 24 达到生命值上限，角色当场死亡\n" + down + "（死亡）"},
+		{1, ".hp abc", nil, hpUsage},
+
+		{2, ".hp", nil, "未命名角色 的生命值 [██████████] 11/11"},
+		{2, ".ds", nil, "未命名角色 的生命值不为 0，无需检定"},
+		{2, ".hp -6", []int{39}, "未命名角色 受到 6 点伤害，生命值 11 → 5\n单次伤害达到生命值上限的一半：受到重伤\n" +
+			"未命名角色 的体质检定 60 → 40 成功，保持清醒\n[█████░░░░░] 5/11（重伤）"},
+		{2, ".hp -5", nil, "未命名角色 受到 5 点伤害，生命值 5 → 0\n" +
+			"生命值归零且处于重伤状态：濒死，每轮使用 .ds 进行体质检定，失败则死亡；急救成功可暂时稳定\n[░░░░░░░░░░] 0/11（重伤，濒死）"},
+		{2, ".ds", []int{49}, "未命名角色 的体质检定 60 → 50 成功，本轮存活，仍处于濒死\n[░░░░░░░░░░] 0/11（重伤，濒死）"},
+		{2, ".hp +1", nil, "未命名角色 恢复 1 点生命值，生命值 0 → 1\n脱离濒死状态\n[█░░░░░░░░░] 1/11（重伤）"},
+		{2, ".hp -12", nil, "未命名角色 受到 12 点伤害，生命值 1 → 0\n单次伤害达到生命值上限，角色死亡\n[░░░░░░░░░░] 0/11（死亡）"},
+
+		// 没有给出上限时，设置的值或 .st 记录的生命值成为上限
+		{3, ".hp 20", nil, "布兰 的生命值设为 20\n[██████████] 20/20"},
+		{3, ".hp -5", nil, "布兰 受到 5 点伤害，生命值 20 → 15\n[████████░░] 15/20"},
+		{3, ".hp +5", nil, "布兰 恢复 5 点生命值，生命值 15 → 20\n[██████████] 20/20"},
+		{4, ".hp -4", nil, "未命名角色 受到 4 点伤害，生命值 10 → 6\n[██████░░░░] 6/10"},
+		{4, ".hp +9", nil, "未命名角色 恢复 9 点生命值，生命值 6 → 10\n[██████████] 10/10"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, tt.player, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
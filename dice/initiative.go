@@ -0,0 +1,264 @@
+package dice
+
+import (
+	"fmt"
+	"island/storage"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// riRegex 匹配 .ri 的参数：[名称][±加值|=先攻值]，例如 哥布林+2、哥布林=15、+3
+var riRegex = regexp.MustCompile(`^ri\s*(.*?)\s*(?:([+\-]\s*\d+)|=\s*(\d+))?$`)
+
+const initUsage = "用法:\n" +
+	".init [先攻加值] - 先攻检定，省略加值时读取人物卡\n" +
+	".ri [名称][±加值] - 加入本群的先攻列表，省略名称时加入自己，同名的 NPC 自动编号，例如 哥布林2\n" +
+	".ri [名称]=[先攻值] - 直接给出先攻值，名称已在列表中时更新该参与者\n" +
+	".init list - 查看先攻列表\n" +
+	".init next - 轮到下一位行动\n" +
+	".init del [名称] - 移出先攻列表\n" +
+	".init clear - 结束战斗并清空先攻列表"
+
+// loadInitiative 读取本群的先攻列表，没有时返回空列表
+func loadInitiative(ctx *CommandContext) *storage.Initiative {
+	if initiative, ok := ctx.Storage.Initiative(ctx.GroupID); ok {
+		return initiative
+	}
+	return &storage.Initiative{}
+}
+
+// saveInitiative 保存本群的先攻列表，为 nil 时删除；校验重放时不保存
+func saveInitiative(ctx *CommandContext, initiative *storage.Initiative) error {
+	if ctx.DryRun {
+		return nil
+	}
+	return ctx.Storage.SetInitiative(ctx.GroupID, initiative)
+}
+
+// sortCombatants 按先攻值从高到低排列，先攻值相同时加值高者在前，战斗中保持当前行动者不变
+func sortCombatants(initiative *storage.Initiative) {
+	var current *storage.Combatant
+	if initiative.Round > 0 && initiative.Turn >= 0 && initiative.Turn < len(initiative.Combatants) {
+		c := initiative.Combatants[initiative.Turn]
+		current = &c
+	}
+	slices.SortStableFunc(initiative.Combatants, func(a, b storage.Combatant) int {
+		if a.Score != b.Score {
+			return b.Score - a.Score
+		}
+		return b.Modifier - a.Modifier
+	})
+	if current != nil {
+		initiative.Turn = findCombatant(initiative, current.Name, current.PlayerID)
+	}
+}
+
+// findCombatant 查找参与者的下标，玩家按 QQ 号查找，NPC 按名称查找，找不到时返回 -1
+func findCombatant(initiative *storage.Initiative, name string, playerID int64) int {
+	return slices.IndexFunc(initiative.Combatants, func(c storage.Combatant) bool {
+		if playerID != 0 {
+			return c.PlayerID == playerID
+		}
+		return c.PlayerID == 0 && c.Name == name
+	})
+}
+
+// uniqueName 为同名的 NPC 编号，例如第二个 哥布林 为 哥布林2
+func uniqueName(initiative *storage.Initiative, name string) string {
+	taken := func(name string) bool {
+		return slices.ContainsFunc(initiative.Combatants, func(c storage.Combatant) bool { return c.Name == name })
+	}
+	if !taken(name) {
+		return name
+	}
+	for n := 2; ; n++ {
+		if numbered := fmt.Sprintf("%s%d", name, n); !taken(numbered) {
+			return numbered
+		}
+	}
+}
+
+// joinInitiative 完成 .ri：掷先攻并加入本群的先攻列表
+// 玩家已在列表中时更新先攻值；NPC 用 =先攻值 更新同名的参与者，否则作为新的参与者加入，同名时自动编号
+func joinInitiative(ctx *CommandContext, name, modText, scoreText string) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用先攻列表"
+	}
+	initiative := loadInitiative(ctx)
+	combatant := storage.Combatant{Name: name}
+	if name == "" {
+		combatant.PlayerID = ctx.PlayerID
+		combatant.Name = fmt.Sprintf("玩家%d", ctx.PlayerID)
+		if card := currentCard(ctx); card != nil {
+			combatant.Name = card.Name
+			if card.DnD != nil && modText == "" {
+				combatant.Modifier = AbilityModifier(card.DnD.Abilities["dex"])
+			}
+		}
+	}
+	if modText != "" {
+		combatant.Modifier, _ = strconv.Atoi(strings.ReplaceAll(modText, " ", ""))
+	}
+	existing := -1
+	if combatant.PlayerID != 0 || scoreText != "" {
+		existing = findCombatant(initiative, combatant.Name, combatant.PlayerID)
+	}
+	if existing < 0 && combatant.PlayerID == 0 {
+		combatant.Name = uniqueName(initiative, combatant.Name)
+	}
+
+	var line string
+	if scoreText != "" {
+		combatant.Score, _ = strconv.Atoi(scoreText)
+		line = fmt.Sprintf("%s 的先攻设为 %d", combatant.Name, combatant.Score)
+	} else {
+		r := ctx.Engine.RollD20(combatant.Modifier)
+		combatant.Score = r.Total()
+		line = FormatD20(combatant.Name+" 的先攻", r)
+	}
+
+	if existing >= 0 {
+		// 重新掷先攻或设置先攻值时保留身上的状态
+		previous := initiative.Combatants[existing]
+		combatant.Conditions = previous.Conditions
+		if modText == "" && scoreText != "" {
+			combatant.Modifier = previous.Modifier
+		}
+		initiative.Combatants[existing] = combatant
+		line += "\n已更新先攻列表"
+	} else {
+		initiative.Combatants = append(initiative.Combatants, combatant)
+		line += fmt.Sprintf("\n已加入先攻列表，共 %d 名参与者", len(initiative.Combatants))
+	}
+	sortCombatants(initiative)
+	if err := saveInitiative(ctx, initiative); err != nil {
+		return fmt.Sprintf("保存先攻列表失败: %v", err)
+	}
+	return line
+}
+
+// listInitiative 完成 .init list：按顺序列出参与者并标出当前行动者
+func listInitiative(ctx *CommandContext) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用先攻列表"
+	}
+	initiative, ok := ctx.Storage.Initiative(ctx.GroupID)
+	if !ok || len(initiative.Combatants) == 0 {
+		return "先攻列表为空，请先使用 .ri 加入先攻"
+	}
+	lines := []string{"先攻列表（尚未开始，使用 .init next 开始第 1 轮）:"}
+	if initiative.Round > 0 {
+		lines[0] = fmt.Sprintf("先攻列表（第 %d 轮）:", initiative.Round)
+	}
+	for i, c := range initiative.Combatants {
+		line := fmt.Sprintf("%d. %s %d", i+1, c.Name, c.Score)
+		if len(c.Conditions) > 0 {
+			line += " [" + formatConditions(c.Conditions) + "]"
+		}
+		if initiative.Round > 0 && i == initiative.Turn {
+			line += " ← 当前行动"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// nextInitiative 完成 .init next：轮到下一位行动，一轮结束后进入下一轮，该参与者的状态剩余轮数减一
+func nextInitiative(ctx *CommandContext) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用先攻列表"
+	}
+	initiative, ok := ctx.Storage.Initiative(ctx.GroupID)
+	if !ok || len(initiative.Combatants) == 0 {
+		return "先攻列表为空，请先使用 .ri 加入先攻"
+	}
+	if initiative.Round == 0 {
+		initiative.Round, initiative.Turn = 1, 0
+	} else if initiative.Turn++; initiative.Turn >= len(initiative.Combatants) {
+		initiative.Round, initiative.Turn = initiative.Round+1, 0
+	}
+
+	c := &initiative.Combatants[initiative.Turn]
+	lines := []string{fmt.Sprintf("第 %d 轮，轮到 %s 行动", initiative.Round, c.Name)}
+	if c.PlayerID != 0 {
+		lines[0] += " " + mention(c.PlayerID)
+	}
+	for _, name := range tickConditions(c) {
+		lines = append(lines, fmt.Sprintf("%s 的 %s 状态已结束", c.Name, name))
+	}
+	if len(c.Conditions) > 0 {
+		lines = append(lines, "当前状态: "+formatConditions(c.Conditions))
+	}
+	if err := saveInitiative(ctx, initiative); err != nil {
+		return fmt.Sprintf("保存先攻列表失败: %v", err)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// removeCombatant 完成 .init del：将参与者移出先攻列表
+func removeCombatant(ctx *CommandContext, name string) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用先攻列表"
+	}
+	initiative := loadInitiative(ctx)
+	i := slices.IndexFunc(initiative.Combatants, func(c storage.Combatant) bool { return c.Name == name })
+	if i < 0 {
+		return fmt.Sprintf("先攻列表中没有 %s", name)
+	}
+	initiative.Combatants = slices.Delete(initiative.Combatants, i, i+1)
+	// 移出当前行动者时退回上一位，.init next 时轮到原来的下一位
+	if i <= initiative.Turn && initiative.Round > 0 {
+		initiative.Turn--
+	}
+	if err := saveInitiative(ctx, initiative); err != nil {
+		return fmt.Sprintf("保存先攻列表失败: %v", err)
+	}
+	return fmt.Sprintf("已将 %s 移出先攻列表，剩余 %d 名参与者", name, len(initiative.Combatants))
+}
+
+// clearInitiative 完成 .init clear：结束战斗并清空先攻列表
+func clearInitiative(ctx *CommandContext) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用先攻列表"
+	}
+	initiative, ok := ctx.Storage.Initiative(ctx.GroupID)
+	if !ok {
+		return "本群没有进行中的战斗"
+	}
+	if err := saveInitiative(ctx, nil); err != nil {
+		return fmt.Sprintf("保存先攻列表失败: %v", err)
+	}
+	if initiative.Round > 0 {
+		return fmt.Sprintf("战斗结束，共进行 %d 轮，已清空先攻列表", initiative.Round)
+	}
+	return "战斗结束，已清空先攻列表"
+}
+
+// RICommand .ri 指令 (加入先攻列表)
+type RICommand struct {
+	BaseCommand
+}
+
+func NewRICommand() *RICommand {
+	return &RICommand{
+		BaseCommand: BaseCommand{
+			name:  "ri",
+			help:  ".ri [名称][±加值] - 掷先攻并加入本群的先攻列表",
+			regex: riRegex,
+		},
+	}
+}
+
+func (c *RICommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *RICommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 4 {
+		return initUsage
+	}
+	return joinInitiative(ctx, matches[1], matches[2], matches[3])
+}
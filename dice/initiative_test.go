@@ -0,0 +1,59 @@
+package dice
+
+import "testing"
+
+// TestInitiativeTracker .ri 加入先攻列表，.init next 按顺序推进并进入下一轮，重启后列表仍在
+func TestInitiativeTracker(t *testing.T) {
+	dir := t.TempDir()
+	registry, _ := newCardTestRegistry(t, dir)
+	runCommand(registry, 1, 2, ".pc new 艾琳 dnd5e")
+	runCommand(registry, 1, 2, ".pc set dex16")
+
+	tests := []struct {
+		player int64
+		cmd    string
+		draws  []int
+		want   string
+	}{
+		{1, ".init list", nil, "先攻列表为空，请先使用 .ri 加入先攻"},
+		{1, ".init next", nil, "先攻列表为空，请先使用 .ri 加入先攻"},
+		{1, ".ri", []int{11}, "艾琳 的先攻: 1D20(12) + 3 = 15\n已加入先攻列表，共 1 名参与者"},
+		{2, ".ri +1", []int{16}, "玩家2 的先攻: 1D20(17) + 1 = 18\n已加入先攻列表，共 2 名参与者"},
+		{1, ".ri 哥布林+2", []int{12}, "哥布林 的先攻: 1D20(13) + 2 = 15\n已加入先攻列表，共 3 名参与者"},
+		{1, ".init list", nil, "先攻列表（尚未开始，使用 .init next 开始第 1 轮）:\n1. 玩家2 18\n2. 艾琳 15\n3. 哥布林 15"},
+		{1, ".init next", nil, "第 1 轮，轮到 玩家2 行动 [CQ:at,qq=2]"},
+		{1, ".init next", nil, "第 1 轮，轮到 艾琳 行动 [CQ:at,qq=1]"},
+		{1, ".ri 狼=20", nil, "狼 的先攻设为 20\n已加入先攻列表，共 4 名参与者"},
+		{1, ".init list", nil, "先攻列表（第 1 轮）:\n1. 狼 20\n2. 玩家2 18\n3. 艾琳 15 ← 当前行动\n4. 哥布林 15"},
+		{1, ".init next", nil, "第 1 轮，轮到 哥布林 行动"},
+		{1, ".init next", nil, "第 2 轮，轮到 狼 行动"},
+		{1, ".init del 狼", nil, "已将 狼 移出先攻列表，剩余 3 名参与者"},
+		{1, ".init next", nil, "第 2 轮，轮到 玩家2 行动 [CQ:at,qq=2]"},
+		{1, ".init del 史莱姆", nil, "先攻列表中没有 史莱姆"},
+		{1, ".ri 哥布林+2", []int{4}, "哥布林2 的先攻: 1D20(5) + 2 = 7\n已加入先攻列表，共 4 名参与者"},
+		{1, ".ri 哥布林2=16", nil, "哥布林2 的先攻设为 16\n已更新先攻列表"},
+		{1, ".init list", nil, "先攻列表（第 2 轮）:\n1. 玩家2 18 ← 当前行动\n2. 哥布林2 16\n3. 艾琳 15\n4. 哥布林 15"},
+		{1, ".init del 哥布林2", nil, "已将 哥布林2 移出先攻列表，剩余 3 名参与者"},
+		{1, ".init 3", []int{9}, "先攻检定: 1D20(10) + 3 = 13"},
+		{1, ".init -1", []int{9}, "先攻检定: 1D20(10) - 1 = 9"},
+		{1, ".init foo", nil, initUsage},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, tt.player, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+
+	// 重新加载数据目录，模拟机器人重启
+	registry, _ = newCardTestRegistry(t, dir)
+	want := "先攻列表（第 2 轮）:\n1. 玩家2 18 ← 当前行动\n2. 艾琳 15\n3. 哥布林 15"
+	if got := runCommand(registry, 1, 2, ".init list"); got != want {
+		t.Errorf("after restart .init list = %q, want %q", got, want)
+	}
+	if got := runCommand(registry, 1, 2, ".init clear"); got != "战斗结束，共进行 2 轮，已清空先攻列表" {
+		t.Errorf(".init clear = %q", got)
+	}
+	if got := runCommand(registry, 1, 2, ".init clear"); got != "本群没有进行中的战斗" {
+		t.Errorf("second .init clear = %q", got)
+	}
+}
@@ -0,0 +1,268 @@
+package dice
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"island/storage"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MAX_COC7_CANDIDATES .coc7 一次最多生成的属性组数
+const MAX_COC7_CANDIDATES = 10
+
+// OCCUPATION_FILE 群自定义职业表的文件名，放在数据目录或 groups/<群号>/ 下
+const OCCUPATION_FILE = "occupations.json"
+
+//go:embed tables/occupations.json
+var defaultOccupationData []byte
+
+// coc7TwoD6Attrs 体型、智力、教育为 (2d6+6)×5，其余属性为 3d6×5
+var coc7TwoD6Attrs = map[string]bool{"体型": true, "智力": true, "教育": true}
+
+// CoC7RollStats 按规则书生成一组调查员属性
+func (e *Engine) CoC7RollStats() map[string]int {
+	stats := make(map[string]int, len(CoC7Attributes))
+	for _, attr := range CoC7Attributes {
+		if coc7TwoD6Attrs[attr] {
+			stats[attr] = (e.intn(6) + e.intn(6) + 2 + 6) * 5
+		} else {
+			stats[attr] = (e.intn(6) + e.intn(6) + e.intn(6) + 3) * 5
+		}
+	}
+	return stats
+}
+
+// CoC7Derived 由属性计算的衍生值
+type CoC7Derived struct {
+	HP    int    // 生命值 (体质+体型)/10
+	MP    int    // 魔法值 意志/5
+	SAN   int    // 理智 等于意志
+	DB    string // 伤害加值
+	Build int    // 体格
+	MOV   int    // 移动力
+}
+
+// NewCoC7Derived 按规则书计算衍生值，移动力不计年龄修正
+func NewCoC7Derived(stats map[string]int) CoC7Derived {
+	d := CoC7Derived{
+		HP:  (stats["体质"] + stats["体型"]) / 10,
+		MP:  stats["意志"] / 5,
+		SAN: stats["意志"],
+		MOV: 8,
+	}
+
+	switch sum := stats["力量"] + stats["体型"]; {
+	case sum <= 64:
+		d.DB, d.Build = "-2", -2
+	case sum <= 84:
+		d.DB, d.Build = "-1", -1
+	case sum <= 124:
+		d.DB, d.Build = "0", 0
+	case sum <= 164:
+		d.DB, d.Build = "+1d4", 1
+	case sum <= 204:
+		d.DB, d.Build = "+1d6", 2
+	default:
+		// 205 起每 80 点增加 1d6 和 1 点体格
+		n := (sum-205)/80 + 2
+		d.DB, d.Build = fmt.Sprintf("+%dd6", n), n+1
+	}
+
+	str, dex, siz := stats["力量"], stats["敏捷"], stats["体型"]
+	switch {
+	case str < siz && dex < siz:
+		d.MOV = 7
+	case str > siz && dex > siz:
+		d.MOV = 9
+	}
+	return d
+}
+
+// FormatCoC7Stats 格式化一组属性及其衍生值
+func FormatCoC7Stats(stats map[string]int) string {
+	attrs := make([]string, 0, len(CoC7Attributes))
+	total := 0
+	for _, attr := range CoC7Attributes {
+		attrs = append(attrs, fmt.Sprintf("%s:%d", attr, stats[attr]))
+		if attr != "幸运" {
+			total += stats[attr]
+		}
+	}
+	d := NewCoC7Derived(stats)
+	return fmt.Sprintf("%s\n生命值:%d 魔法值:%d 理智:%d 伤害加值:%s 体格:%d 移动力:%d 总和:%d/含幸运%d",
+		strings.Join(attrs, " "), d.HP, d.MP, d.SAN, d.DB, d.Build, d.MOV, total, total+stats["幸运"])
+}
+
+// Occupation 职业的本职技能点，Points 的每一项为属性到倍数的映射，取其中最高的一项
+// 例如 [{"教育": 2, "敏捷": 2}, {"教育": 2, "力量": 2}] 表示 教育×2 + 敏捷×2或力量×2
+type Occupation struct {
+	Points []map[string]int `json:"points"`
+}
+
+// SkillPoints 按属性计算本职技能点
+func (o Occupation) SkillPoints(stats map[string]int) int {
+	best := 0
+	for _, formula := range o.Points {
+		points := 0
+		for attr, times := range formula {
+			points += stats[attr] * times
+		}
+		best = max(best, points)
+	}
+	return best
+}
+
+// parseOccupations 解析职业表数据文件
+func parseOccupations(data []byte) (map[string]Occupation, error) {
+	var occupations map[string]Occupation
+	if err := json.Unmarshal(data, &occupations); err != nil {
+		return nil, err
+	}
+	for name, occupation := range occupations {
+		if len(occupation.Points) == 0 {
+			return nil, fmt.Errorf("职业 %s 没有技能点计算方式", name)
+		}
+	}
+	return occupations, nil
+}
+
+// occupations 返回当前群使用的职业表，群自定义的职业按名称覆盖内置的职业
+func occupations(ctx *CommandContext) (map[string]Occupation, error) {
+	result, err := parseOccupations(defaultOccupationData)
+	if err != nil {
+		return nil, fmt.Errorf("内置职业表有误: %w", err)
+	}
+	if ctx.Storage == nil {
+		return result, nil
+	}
+	data, err := ctx.Storage.ReadGroupFile(ctx.GroupID, OCCUPATION_FILE)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	custom, err := parseOccupations(data)
+	if err != nil {
+		return nil, fmt.Errorf("本群的职业表文件 %s 有误: %w", OCCUPATION_FILE, err)
+	}
+	for name, occupation := range custom {
+		result[name] = occupation
+	}
+	return result, nil
+}
+
+// coc7SaveRegex 匹配 .coc7 save [序号] [角色名] [职业]
+var coc7SaveRegex = regexp.MustCompile(`^save\s+(\d+)(?:\s+(\S+))?(?:\s+(\S+))?$`)
+
+// rollCandidates 生成 n 组候选属性，启用存储时记录下来供 .coc7 save 使用
+func rollCandidates(ctx *CommandContext, n int) string {
+	if n < 1 || n > MAX_COC7_CANDIDATES {
+		return fmt.Sprintf("一次最多生成 %d 组属性", MAX_COC7_CANDIDATES)
+	}
+	candidates := make([]map[string]int, n)
+	lines := []string{"COC7版角色属性："}
+	for i := range candidates {
+		candidates[i] = ctx.Engine.CoC7RollStats()
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, FormatCoC7Stats(candidates[i])))
+	}
+	if ctx.Storage == nil {
+		return strings.Join(lines, "\n")
+	}
+	if !ctx.DryRun {
+		if err := ctx.Storage.SetCandidates(ctx.PlayerID, ctx.GroupID, candidates); err != nil {
+			return fmt.Sprintf("记录候选属性失败: %v", err)
+		}
+	}
+	lines = append(lines, "使用 .coc7 save [序号] [角色名] [职业] 保存为人物卡")
+	return strings.Join(lines, "\n")
+}
+
+// saveCandidate 将选中的候选属性保存为新的人物卡并设为当前人物卡
+func saveCandidate(ctx *CommandContext, index int, name, occupation string) string {
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法保存人物卡"
+	}
+	candidates, ok := ctx.Storage.Candidates(ctx.PlayerID, ctx.GroupID)
+	if !ok {
+		return "请先使用 .coc7 [数量] 生成属性"
+	}
+	if index < 1 || index > len(candidates) {
+		return fmt.Sprintf("序号必须在1-%d之间", len(candidates))
+	}
+	stats := candidates[index-1]
+
+	var job Occupation
+	if occupation != "" {
+		table, err := occupations(ctx)
+		if err != nil {
+			return err.Error()
+		}
+		if job, ok = table[occupation]; !ok {
+			names := make([]string, 0, len(table))
+			for name := range table {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Sprintf("未知职业 %s，可选职业: %s", occupation, strings.Join(names, "、"))
+		}
+	}
+
+	if name == "" {
+		name = "未命名角色"
+	}
+	card := &storage.CharacterCard{
+		ID:       storage.NewCardID(ctx.PlayerID),
+		Name:     name,
+		System:   "coc7",
+		PlayerID: ctx.PlayerID,
+		GroupID:  ctx.GroupID,
+		Attrs:    make(map[string]interface{}),
+	}
+	for attr, value := range stats {
+		card.SetInt(attr, value)
+	}
+	d := NewCoC7Derived(stats)
+	card.SetInt("生命值", d.HP)
+	card.SetInt("魔法值", d.MP)
+	card.SetInt("理智", d.SAN)
+	card.SetInt("体格", d.Build)
+	card.SetInt("移动力", d.MOV)
+	card.Attrs["伤害加值"] = d.DB
+
+	lines := []string{fmt.Sprintf("已保存人物卡 %s，并设为当前人物卡", name), FormatCoC7Stats(stats)}
+	if occupation != "" {
+		points := job.SkillPoints(stats)
+		interest := stats["智力"] * 2
+		card.Attrs["职业"] = occupation
+		card.SetInt("职业技能点", points)
+		card.SetInt("兴趣技能点", interest)
+		lines = append(lines, fmt.Sprintf("职业 %s: 本职技能点 %d，兴趣技能点 %d", occupation, points, interest))
+	}
+	if err := saveCard(ctx, card, true); err != nil {
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// coc7Generate 处理 .coc7 的参数：空、生成数量或 save 子指令
+func coc7Generate(ctx *CommandContext, args string) string {
+	args = strings.TrimSpace(args)
+	if m := coc7SaveRegex.FindStringSubmatch(args); m != nil {
+		index, _ := strconv.Atoi(m[1])
+		return saveCandidate(ctx, index, m[2], m[3])
+	}
+	n := 1
+	if args != "" {
+		var err error
+		if n, err = strconv.Atoi(args); err != nil {
+			return "用法: .coc7 [数量] 或 .coc7 save [序号] [角色名] [职业]"
+		}
+	}
+	return rollCandidates(ctx, n)
+}
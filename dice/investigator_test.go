@@ -0,0 +1,83 @@
+package dice
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestCoC7Generate .coc7 生成多组属性并保存选中的一组
+func TestCoC7Generate(t *testing.T) {
+	registry, store := newCardTestRegistry(t, t.TempDir())
+
+	// 每组属性 24 次抽取：六项 3d6 和三项 2d6
+	draws := append(slices.Repeat([]int{2}, 24), slices.Repeat([]int{5}, 24)...)
+	want := "COC7版角色属性：\n" +
+		"1. 力量:45 体质:45 体型:60 敏捷:45 外貌:45 智力:60 意志:45 教育:60 幸运:45\n" +
+		"生命值:10 魔法值:9 理智:45 伤害加值:0 体格:0 移动力:7 总和:405/含幸运450\n" +
+		"2. 力量:90 体质:90 体型:90 敏捷:90 外貌:90 智力:90 意志:90 教育:90 幸运:90\n" +
+		"生命值:18 魔法值:18 理智:90 伤害加值:+1d6 体格:2 移动力:8 总和:720/含幸运810\n" +
+		"使用 .coc7 save [序号] [角色名] [职业] 保存为人物卡"
+	if got := runCommand(registry, 1, 2, ".coc7 2", draws...); got != want {
+		t.Errorf(".coc7 2 = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{".coc7 save 3", "序号必须在1-2之间"},
+		{".coc7 11", "一次最多生成 10 组属性"},
+		{".coc7 save 1 李四 运动员", "已保存人物卡 李四，并设为当前人物卡\n" +
+			"力量:45 体质:45 体型:60 敏捷:45 外貌:45 智力:60 意志:45 教育:60 幸运:45\n" +
+			"生命值:10 魔法值:9 理智:45 伤害加值:0 体格:0 移动力:7 总和:405/含幸运450\n" +
+			"职业 运动员: 本职技能点 210，兴趣技能点 120"},
+		{".coc7 save 2 张三 医生", "已保存人物卡 张三，并设为当前人物卡\n" +
+			"力量:90 体质:90 体型:90 敏捷:90 外貌:90 智力:90 意志:90 教育:90 幸运:90\n" +
+			"生命值:18 魔法值:18 理智:90 伤害加值:+1d6 体格:2 移动力:8 总和:720/含幸运810\n" +
+			"职业 医生: 本职技能点 360，兴趣技能点 180"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+	if got := runCommand(registry, 1, 2, ".coc7 save 1 王五 宇航员"); !strings.HasPrefix(got, "未知职业 宇航员，可选职业: ") {
+		t.Errorf("unknown occupation = %q", got)
+	}
+
+	card, ok := store.ActiveCard(1, 2)
+	if !ok || card.Name != "张三" {
+		t.Fatalf("active card = %+v, want 张三", card)
+	}
+	for name, want := range map[string]int{"教育": 90, "生命值": 18, "理智": 90, "职业技能点": 360} {
+		if got, _ := card.Int(name); got != want {
+			t.Errorf("saved %s = %d, want %d", name, got, want)
+		}
+	}
+	if card.Attrs["伤害加值"] != "+1d6" || card.Attrs["职业"] != "医生" {
+		t.Errorf("saved attrs = %v", card.Attrs)
+	}
+}
+
+// TestCoC7Derived 伤害加值、体格和移动力按力量和体型计算
+func TestCoC7Derived(t *testing.T) {
+	tests := []struct {
+		str, siz, dex int
+		db            string
+		build, mov    int
+	}{
+		{30, 30, 50, "-2", -2, 8},
+		{40, 40, 30, "-1", -1, 8},
+		{75, 80, 30, "+1d4", 1, 7},
+		{100, 105, 50, "+2d6", 3, 7},
+		{200, 85, 90, "+3d6", 4, 9},
+	}
+	for _, tt := range tests {
+		d := NewCoC7Derived(map[string]int{"力量": tt.str, "体型": tt.siz, "敏捷": tt.dex})
+		if d.DB != tt.db || d.Build != tt.build || d.MOV != tt.mov {
+			t.Errorf("str %d siz %d dex %d = %s/%d/%d, want %s/%d/%d",
+				tt.str, tt.siz, tt.dex, d.DB, d.Build, d.MOV, tt.db, tt.build, tt.mov)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package dice
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MADNESS_FILE 群自定义疯狂表的文件名，放在数据目录或 groups/<群号>/ 下
+const MADNESS_FILE = "madness.json"
+
+// MAX_MADNESS_DEPTH 症状引用子表的最大层数，防止子表互相引用
+const MAX_MADNESS_DEPTH = 3
+
+// 疯狂发作表的名称
+const (
+	MadnessRealtime = "realtime" // 即时症状，持续 1d10 轮
+	MadnessSummary  = "summary"  // 总结症状，持续 1d10 小时
+)
+
+//go:embed tables/madness.json
+var defaultMadnessData []byte
+
+// MadnessEntry 疯狂表中的一条症状，Table 不为空时继续在该子表中抽取
+type MadnessEntry struct {
+	Text  string `json:"text"`
+	Table string `json:"table,omitempty"`
+}
+
+// MadnessTable 一张疯狂表，按条目数量掷骰抽取
+type MadnessTable struct {
+	Name     string         `json:"name"`
+	Duration string         `json:"duration,omitempty"` // 症状持续时间的表达式
+	Unit     string         `json:"unit,omitempty"`     // 持续时间的单位
+	Entries  []MadnessEntry `json:"entries"`
+}
+
+// MadnessTables 按名称索引的疯狂表
+type MadnessTables map[string]*MadnessTable
+
+// ParseMadnessTables 解析疯狂表数据文件
+func ParseMadnessTables(data []byte) (MadnessTables, error) {
+	var tables MadnessTables
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return nil, err
+	}
+	for name, table := range tables {
+		if table == nil || len(table.Entries) == 0 {
+			return nil, fmt.Errorf("疯狂表 %s 没有条目", name)
+		}
+		if table.Name == "" {
+			table.Name = name
+		}
+	}
+	return tables, nil
+}
+
+// DefaultMadnessTables 规则书中的疯狂发作表、恐惧症状表和躁狂症状表
+func DefaultMadnessTables() MadnessTables {
+	tables, err := ParseMadnessTables(defaultMadnessData)
+	if err != nil {
+		panic(fmt.Sprintf("内置疯狂表有误: %v", err))
+	}
+	return tables
+}
+
+// madnessTables 返回当前群使用的疯狂表，群自定义的表按名称覆盖内置的表
+func madnessTables(ctx *CommandContext) (MadnessTables, error) {
+	tables := DefaultMadnessTables()
+	if ctx.Storage == nil {
+		return tables, nil
+	}
+	data, err := ctx.Storage.ReadGroupFile(ctx.GroupID, MADNESS_FILE)
+	if os.IsNotExist(err) {
+		return tables, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	custom, err := ParseMadnessTables(data)
+	if err != nil {
+		return nil, err
+	}
+	for name, table := range custom {
+		tables[name] = table
+	}
+	return tables, nil
+}
+
+// RollMadness 在指定的疯狂表中抽取症状并掷出持续时间，引用子表的症状继续抽取子表
+func (e *Engine) RollMadness(tables MadnessTables, name string) (string, error) {
+	var lines []string
+	for depth := 0; name != ""; depth++ {
+		table, ok := tables[name]
+		if !ok {
+			return "", fmt.Errorf("找不到疯狂表 %s", name)
+		}
+		if depth >= MAX_MADNESS_DEPTH {
+			return "", fmt.Errorf("疯狂表 %s 引用子表的层数过多", name)
+		}
+
+		roll := e.intn(len(table.Entries)) + 1
+		entry := table.Entries[roll-1]
+		lines = append(lines, fmt.Sprintf("%s 1d%d → %d", table.Name, len(table.Entries), roll), entry.Text)
+		if table.Duration != "" {
+			duration, process, err := e.EvalInt(table.Duration)
+			if err != nil {
+				return "", fmt.Errorf("疯狂表 %s 的持续时间有误: %w", table.Name, err)
+			}
+			if process != "" {
+				lines = append(lines, fmt.Sprintf("持续 %s=%d%s", table.Duration, duration, table.Unit))
+			} else {
+				lines = append(lines, fmt.Sprintf("持续 %d%s", duration, table.Unit))
+			}
+		}
+		name = entry.Table
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// rollMadness 使用当前群的疯狂表抽取症状
+func rollMadness(ctx *CommandContext, name string) string {
+	tables, err := madnessTables(ctx)
+	if err != nil {
+		return fmt.Sprintf("本群的疯狂表文件 %s 有误: %v", MADNESS_FILE, err)
+	}
+	result, err := ctx.Engine.RollMadness(tables, name)
+	if err != nil {
+		return fmt.Sprintf("抽取疯狂症状出错: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package dice
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMadnessTables .ti/.li 抽取疯狂症状、持续时间和子表，并使用群自定义的表
+func TestMadnessTables(t *testing.T) {
+	dir := t.TempDir()
+	registry, _ := newCardTestRegistry(t, dir)
+
+	custom := filepath.Join(dir, "groups", "3")
+	if err := os.MkdirAll(custom, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"phobia": {"name": "本群恐惧症", "entries": [{"text": "怕猫"}, {"text": "怕狗"}]}}`
+	if err := os.WriteFile(filepath.Join(custom, MADNESS_FILE), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group int64
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{2, ".ti", []int{5, 2}, "疯狂发作-即时症状 1d10 → 6\n昏厥：调查员当场昏倒。\n持续 1d10=3轮"},
+		{2, ".li", []int{8, 6, 44}, "疯狂发作-总结症状 1d10 → 9\n" +
+			"恐惧：调查员患上一个新的恐惧症。调查员恢复清醒后，他们会发现自己已经采取了各种措施来避免恐惧源。\n" +
+			"持续 1d10=7小时\n" +
+			"恐惧症状 1d100 → 45\n爬虫恐惧症（Herpetophobia）：对爬行动物的恐惧。"},
+		{3, ".ti", []int{8, 0, 1}, "疯狂发作-即时症状 1d10 → 9\n" +
+			"恐惧：调查员获得一个新的恐惧症状，即使恐惧的来源并不存在，调查员也会在接下来的时间里想象它就在那里。\n" +
+			"持续 1d10=1轮\n" +
+			"本群恐惧症 1d2 → 2\n怕狗"},
+		{3, ".ti", []int{9, 0, 99}, "疯狂发作-即时症状 1d10 → 10\n" +
+			"躁狂：调查员获得一个新的躁狂症状，在接下来的时间里，调查员会沉溺于新的狂躁症状之中。\n" +
+			"持续 1d10=1轮\n" +
+			"躁狂症状 1d100 → 100\n喜兽癖（Zoomania）：对待动物的态度近乎疯狂地友好。"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, tt.group, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(custom, MADNESS_FILE), []byte(`{"mania": {"entries": []}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := "本群的疯狂表文件 madness.json 有误: 疯狂表 mania 没有条目"
+	if got := runCommand(registry, 1, 3, ".ti"); got != want {
+		t.Errorf(".ti with bad file = %q, want %q", got, want)
+	}
+}
+
+// TestDefaultMadnessTables 内置的症状表条目齐全，子表引用都存在
+func TestDefaultMadnessTables(t *testing.T) {
+	tables := DefaultMadnessTables()
+	sizes := map[string]int{MadnessRealtime: 10, MadnessSummary: 10, "phobia": 100, "mania": 100}
+	for name, size := range sizes {
+		if got := len(tables[name].Entries); got != size {
+			t.Errorf("%s has %d entries, want %d", name, got, size)
+		}
+	}
+	for name, table := range tables {
+		for _, entry := range table.Entries {
+			if _, ok := tables[entry.Table]; entry.Table != "" && !ok {
+				t.Errorf("%s references missing table %s", name, entry.Table)
+			}
+		}
+	}
+}
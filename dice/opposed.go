@@ -0,0 +1,296 @@
+package dice
+
+import (
+	"fmt"
+	"island/storage"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mentionRegex 匹配 @某人：QQ 消息中的 [CQ:at,qq=123456]，或直接写出的 @123456
+var mentionRegex = regexp.MustCompile(`\[CQ:at,qq=(\d+)[^\]]*\]|@(\d+)`)
+
+// extractMention 取出参数中 @ 的玩家，返回去掉 @ 之后的参数
+func extractMention(input string) (playerID int64, rest string, ok bool) {
+	loc := mentionRegex.FindStringSubmatchIndex(input)
+	if loc == nil {
+		return 0, input, false
+	}
+	var id string
+	if loc[2] >= 0 {
+		id = input[loc[2]:loc[3]]
+	} else {
+		id = input[loc[4]:loc[5]]
+	}
+	playerID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, input, false
+	}
+	return playerID, strings.TrimSpace(input[:loc[0]] + " " + input[loc[1]:]), true
+}
+
+// mention 生成 @玩家 的 CQ 码
+func mention(playerID int64) string {
+	return fmt.Sprintf("[CQ:at,qq=%d]", playerID)
+}
+
+// mentions 返回参数中 @ 的所有玩家
+func mentions(input string) []int64 {
+	var ids []int64
+	for _, m := range mentionRegex.FindAllStringSubmatch(input, -1) {
+		id := m[1]
+		if id == "" {
+			id = m[2]
+		}
+		if playerID, err := strconv.ParseInt(id, 10, 64); err == nil {
+			ids = append(ids, playerID)
+		}
+	}
+	return ids
+}
+
+// playerCard 读取指定玩家在当前群使用的人物卡，没有时返回 nil
+func playerCard(ctx *CommandContext, playerID int64) *storage.CharacterCard {
+	if ctx.Storage == nil {
+		return nil
+	}
+	card, _ := ctx.Storage.ActiveCard(playerID, ctx.GroupID)
+	return card
+}
+
+// participantName 对抗双方的称呼，有人物卡时用角色名，否则 @ 玩家
+func participantName(card *storage.CharacterCard, playerID int64) string {
+	if card != nil {
+		return card.Name
+	}
+	return mention(playerID)
+}
+
+// opponent 对抗的对象：@ 的玩家，或 KP 操作的 NPC
+type opponent struct {
+	playerID int64
+	npc      string // NPC 的名称，对象为玩家时为空
+}
+
+// opposedArgs 解析对抗检定的参数：[我方技能] [对方技能] @对方，省略对方技能时双方使用同一技能
+// 没有 @ 时对方为 NPC：[我方技能] [NPC名称][数值]，或 [我方技能] [NPC名称] [对方技能][数值]
+func opposedArgs(ctx *CommandContext, input string) (target opponent, mine, theirs *skillCheckArgs, errMsg string) {
+	playerID, rest, mentioned := extractMention(input)
+	if mentioned && playerID == ctx.PlayerID {
+		return target, nil, nil, "不能和自己进行对抗检定"
+	}
+	target.playerID = playerID
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 3 || mentioned && len(fields) > 2 {
+		return target, nil, nil, ""
+	}
+	var ok bool
+	if mine, ok = parseSkillCheckArgs(fields[0]); !ok || mine.name == "" {
+		return target, nil, nil, ""
+	}
+	theirs = &skillCheckArgs{name: mine.name}
+	switch {
+	case mentioned && len(fields) == 2:
+		if theirs, ok = parseSkillCheckArgs(fields[1]); !ok || theirs.name == "" {
+			return target, nil, nil, ""
+		}
+	case !mentioned && len(fields) == 1:
+		return target, nil, nil, "请 @ 对抗的对象，或写出 NPC 的名称和数值，例如 .rav 斗殴 邪教徒50"
+	case !mentioned:
+		npc, ok := parseSkillCheckArgs(fields[1])
+		if !ok || npc.name == "" {
+			return target, nil, nil, ""
+		}
+		target.npc = npc.name
+		if len(fields) == 3 {
+			if npc, ok = parseSkillCheckArgs(fields[2]); !ok || npc.name == "" || npc.difficulty != DifficultyRegular {
+				return target, nil, nil, ""
+			}
+			theirs.name = npc.name
+		}
+		theirs.value, theirs.hasValue, theirs.modifier = npc.value, npc.hasValue, npc.modifier
+	}
+	if mine.difficulty != DifficultyRegular || theirs.difficulty != DifficultyRegular {
+		return target, nil, nil, "对抗检定总是使用常规难度，请去掉 困难/极难"
+	}
+	return target, mine, theirs, ""
+}
+
+// CoC7OpposedWinner 判定 CoC7 对抗检定的胜者：成功等级高者胜，等级相同时技能值高者胜
+// 返回 1 表示 a 胜出，-1 表示 b 胜出，0 表示平局或双方都失败
+func CoC7OpposedWinner(a, b *CoC7Result) int {
+	if !a.Level.Succeeded() && !b.Level.Succeeded() {
+		return 0
+	}
+	switch {
+	case a.Level > b.Level, a.Level == b.Level && a.Skill > b.Skill:
+		return 1
+	case a.Level < b.Level, a.Level == b.Level && a.Skill < b.Skill:
+		return -1
+	}
+	return 0
+}
+
+// opposedSide 对抗一方的人物卡和称呼，NPC 没有人物卡
+func opposedSide(ctx *CommandContext, side opponent) (*storage.CharacterCard, string) {
+	if side.npc != "" {
+		return nil, side.npc
+	}
+	card := playerCard(ctx, side.playerID)
+	return card, participantName(card, side.playerID)
+}
+
+// coc7OpposedSide 对抗一方的称呼、检定名称和技能值
+func coc7OpposedSide(ctx *CommandContext, side opponent, args *skillCheckArgs) (name, label string, value int, errMsg string) {
+	card, name := opposedSide(ctx, side)
+	value, base := args.value, false
+	if !args.hasValue {
+		var ok bool
+		if side.npc != "" {
+			return "", "", 0, fmt.Sprintf("请写出 %s 的技能值，例如 .rav %s %s50", name, args.name, name)
+		}
+		if value, base, ok = cardSkill(card, args.name); !ok {
+			return "", "", 0, fmt.Sprintf("未找到 %s 的技能 %s，可以直接给出技能值，例如 .rav %s50 @对方", name, args.name, args.name)
+		}
+	}
+	label = name + " 的" + args.name
+	if base {
+		label += "(基础值)"
+	}
+	return name, label, value + args.modifier, ""
+}
+
+// RAVCommand .rav 指令 (CoC7 对抗检定)
+type RAVCommand struct {
+	BaseCommand
+}
+
+func NewRAVCommand() *RAVCommand {
+	return &RAVCommand{
+		BaseCommand: BaseCommand{
+			name:  "rav",
+			help:  ".rav [技能] [对方技能] @对方 - CoC7 对抗检定，读取双方人物卡，对方为 NPC 时写出名称和技能值",
+			regex: regexp.MustCompile(`^rav\s*(.+)$`),
+		},
+	}
+}
+
+func (c *RAVCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *RAVCommand) Process(ctx *CommandContext) string {
+	const usage = "用法: .rav [技能] [对方技能] @对方，例如 .rav 斗殴 @对方、.rav 斗殴 闪避 @对方\n" +
+		"对方为 NPC 时: .rav [技能] [NPC名称][技能值]，例如 .rav 斗殴 邪教徒50、.rav 斗殴 邪教徒 闪避40"
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return usage
+	}
+	target, mine, theirs, errMsg := opposedArgs(ctx, matches[1])
+	if mine == nil {
+		if errMsg == "" {
+			return usage
+		}
+		return errMsg
+	}
+
+	myName, myLabel, myValue, errMsg := coc7OpposedSide(ctx, opponent{playerID: ctx.PlayerID}, mine)
+	if errMsg != "" {
+		return errMsg
+	}
+	theirName, theirLabel, theirValue, errMsg := coc7OpposedSide(ctx, target, theirs)
+	if errMsg != "" {
+		return errMsg
+	}
+
+	rules := coc7Rules(ctx)
+	myResult := ctx.Engine.CoC7Roll(myValue, DifficultyRegular, rules)
+	theirResult := ctx.Engine.CoC7Roll(theirValue, DifficultyRegular, rules)
+	lines := []string{
+		"对抗检定:",
+		FormatCoC7Result(myLabel, myResult),
+		FormatCoC7Result(theirLabel, theirResult),
+	}
+	switch CoC7OpposedWinner(myResult, theirResult) {
+	case 1:
+		lines = append(lines, myName+" 胜出")
+	case -1:
+		lines = append(lines, theirName+" 胜出")
+	default:
+		if myResult.Level.Succeeded() {
+			lines = append(lines, "成功等级和技能值都相同，平局")
+		} else {
+			lines = append(lines, "双方都失败，无人胜出")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// dndContestSide 对抗一方的称呼、检定名称和加值：直接给出的数值，或按人物卡计算
+func dndContestSide(ctx *CommandContext, side opponent, args *skillCheckArgs) (name, label string, bonus int) {
+	card, name := opposedSide(ctx, side)
+	label, bonus = args.name, args.value
+	switch {
+	case args.hasValue || card == nil:
+	case card.DnD != nil:
+		if skill, ok := dndSkill(args.name); ok {
+			label, bonus = skill, dndSkillModifier(card.DnD, skill)
+		} else if ability, ok := dndAbility(args.name); ok {
+			label, bonus = dndAbilityNames[ability], AbilityModifier(card.DnD.Abilities[ability])
+		}
+	default:
+		bonus, _ = card.Int(args.name)
+	}
+	return name, name + " 的" + label, bonus + args.modifier
+}
+
+// ContestCommand .contest 指令 (DnD5E 对抗检定)
+type ContestCommand struct {
+	BaseCommand
+}
+
+func NewContestCommand() *ContestCommand {
+	return &ContestCommand{
+		BaseCommand: BaseCommand{
+			name:  "contest",
+			help:  ".contest [技能][加值] [对方技能] @对方 - DnD5E 对抗检定，总值高者胜，相同则维持原状，对方为 NPC 时写出名称和加值",
+			regex: regexp.MustCompile(`^contest\s*(.+)$`),
+		},
+	}
+}
+
+func (c *ContestCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *ContestCommand) Process(ctx *CommandContext) string {
+	const usage = "用法: .contest [技能][加值] [对方技能] @对方，例如 .contest 运动+5 特技 @对方\n" +
+		"对方为 NPC 时: .contest [技能][加值] [NPC名称][加值]，例如 .contest 运动+5 食人魔+6"
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return usage
+	}
+	target, mine, theirs, errMsg := opposedArgs(ctx, matches[1])
+	if mine == nil {
+		if errMsg == "" {
+			return usage
+		}
+		return errMsg
+	}
+
+	myName, myLabel, myBonus := dndContestSide(ctx, opponent{playerID: ctx.PlayerID}, mine)
+	theirName, theirLabel, theirBonus := dndContestSide(ctx, target, theirs)
+	myRoll := ctx.Engine.RollD20(myBonus)
+	theirRoll := ctx.Engine.RollD20(theirBonus)
+	lines := []string{"对抗检定:", FormatD20(myLabel, myRoll), FormatD20(theirLabel, theirRoll)}
+	switch mine, theirs := myRoll.Total(), theirRoll.Total(); {
+	case mine > theirs:
+		lines = append(lines, myName+" 胜出")
+	case mine < theirs:
+		lines = append(lines, theirName+" 胜出")
+	default:
+		lines = append(lines, "总值相同，平局，维持原状")
+	}
+	return strings.Join(lines, "\n")
+}
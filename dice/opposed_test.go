@@ -0,0 +1,67 @@
+package dice
+
+import "testing"
+
+// TestOpposedChecks .rav 和 .contest 读取双方人物卡并判定胜者
+func TestOpposedChecks(t *testing.T) {
+	registry, _ := newCardTestRegistry(t, t.TempDir())
+
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".st 斗殴60", nil, "已更新 未命名角色 的属性: 斗殴 60"},
+		{".rav 斗殴 [CQ:at,qq=2]", []int{24, 39}, "对抗检定:\n" +
+			"未命名角色 的斗殴检定 60 → 25 困难成功\n" +
+			"[CQ:at,qq=2] 的斗殴(基础值)检定 25 → 40 失败\n" +
+			"未命名角色 胜出"},
+		{".rav 斗殴 闪避30 @2", []int{59, 9}, "对抗检定:\n" +
+			"未命名角色 的斗殴检定 60 → 60 成功\n" +
+			"[CQ:at,qq=2] 的闪避检定 30 → 10 困难成功\n" +
+			"[CQ:at,qq=2] 胜出"},
+		{".rav 斗殴 斗殴50 @2", []int{49, 49}, "对抗检定:\n" +
+			"未命名角色 的斗殴检定 60 → 50 成功\n" +
+			"[CQ:at,qq=2] 的斗殴检定 50 → 50 成功\n" +
+			"未命名角色 胜出"},
+		{".rav 斗殴 斗殴60 @2", []int{49, 54}, "对抗检定:\n" +
+			"未命名角色 的斗殴检定 60 → 50 成功\n" +
+			"[CQ:at,qq=2] 的斗殴检定 60 → 55 成功\n" +
+			"成功等级和技能值都相同，平局"},
+		{".rav 斗殴 @2", []int{79, 89}, "对抗检定:\n" +
+			"未命名角色 的斗殴检定 60 → 80 失败\n" +
+			"[CQ:at,qq=2] 的斗殴(基础值)检定 25 → 90 失败\n" +
+			"双方都失败，无人胜出"},
+		{".rav 斗殴 闪避 @2", nil, "未找到 [CQ:at,qq=2] 的技能 闪避，可以直接给出技能值，例如 .rav 闪避50 @对方"},
+		{".rav 斗殴", nil, "请 @ 对抗的对象，或写出 NPC 的名称和数值，例如 .rav 斗殴 邪教徒50"},
+		{".rav 斗殴 邪教徒50", []int{24, 39}, "对抗检定:\n" +
+			"未命名角色 的斗殴检定 60 → 25 困难成功\n" +
+			"邪教徒 的斗殴检定 50 → 40 成功\n" +
+			"未命名角色 胜出"},
+		{".rav 斗殴 邪教徒 闪避40", []int{59, 7}, "对抗检定:\n" +
+			"未命名角色 的斗殴检定 60 → 60 成功\n" +
+			"邪教徒 的闪避检定 40 → 8 极难成功\n" +
+			"邪教徒 胜出"},
+		{".rav 斗殴 邪教徒", nil, "请写出 邪教徒 的技能值，例如 .rav 斗殴 邪教徒50"},
+		{".rav 斗殴 @1", nil, "不能和自己进行对抗检定"},
+		{".rav 困难斗殴 @2", nil, "对抗检定总是使用常规难度，请去掉 困难/极难"},
+		{".contest 运动+5 特技 [CQ:at,qq=2]", []int{13, 17}, "对抗检定:\n" +
+			"未命名角色 的运动: 1D20(14) + 5 = 19\n" +
+			"[CQ:at,qq=2] 的特技: 1D20(18) + 0 = 18\n" +
+			"未命名角色 胜出"},
+		{".contest 运动 @2", []int{9, 9}, "对抗检定:\n" +
+			"未命名角色 的运动: 1D20(10) + 0 = 10\n" +
+			"[CQ:at,qq=2] 的运动: 1D20(10) + 0 = 10\n" +
+			"总值相同，平局，维持原状"},
+		{".contest 运动+5 食人魔+6", []int{13, 9}, "对抗检定:\n" +
+			"未命名角色 的运动: 1D20(14) + 5 = 19\n" +
+			"食人魔 的运动: 1D20(10) + 6 = 16\n" +
+			"未命名角色 胜出"},
+		{".ra 斗殴", []int{0}, "未命名角色 的斗殴检定 60 → 1 大成功！"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
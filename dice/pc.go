@@ -0,0 +1,344 @@
+package dice
+
+import (
+	"fmt"
+	"island/parser"
+	"island/storage"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pcSetRegex 匹配一项 DnD5E 数值设置，例如 str16、敏捷:14、lv3
+var pcSetRegex = regexp.MustCompile(`^([^\s\d+\-:：=]+)\s*[:：=]?\s*(\d+)\s*`)
+
+// PcCommand .pc 指令 (人物卡管理)
+type PcCommand struct {
+	BaseCommand
+}
+
+func NewPcCommand() *PcCommand {
+	return &PcCommand{
+		BaseCommand: BaseCommand{
+			name:  "pc",
+			help:  ".pc [new|set|prof|expert|weapon|resist|vuln|immune] - 创建人物卡，设置 DnD5E 属性、等级、熟练项、武器和伤害抗性",
+			regex: regexp.MustCompile(`^pc\s*(\S*)\s*(.*)$`),
+		},
+	}
+}
+
+func (c *PcCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *PcCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 3 {
+		return pcUsage
+	}
+	if ctx.Storage == nil {
+		return "未启用数据存储，无法使用人物卡"
+	}
+
+	sub, args := matches[1], strings.TrimSpace(matches[2])
+	switch sub {
+	case "", "show":
+		return showPc(ctx)
+	case "new":
+		return newPc(ctx, strings.Fields(args))
+	}
+
+	card, errMsg := dndCard(ctx)
+	if errMsg != "" {
+		return errMsg
+	}
+	var result string
+	switch sub {
+	case "set":
+		result, errMsg = setDnDStats(card.DnD, args)
+	case "prof":
+		result, errMsg = setProficiencies(card.DnD, strings.Fields(args), false)
+	case "expert":
+		result, errMsg = setProficiencies(card.DnD, strings.Fields(args), true)
+	case "weapon":
+		result, errMsg = setWeapon(card.DnD, strings.Fields(args))
+	case "resist":
+		result, errMsg = setDamageTypes(&card.DnD.Resistances, "抗性", strings.Fields(args))
+	case "vuln":
+		result, errMsg = setDamageTypes(&card.DnD.Vulnerable, "易伤", strings.Fields(args))
+	case "immune":
+		result, errMsg = setDamageTypes(&card.DnD.Immunities, "免疫", strings.Fields(args))
+	default:
+		return pcUsage
+	}
+	if errMsg != "" {
+		return errMsg
+	}
+	if err := saveCard(ctx, card, false); err != nil {
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+	return fmt.Sprintf("已更新 %s: %s", card.Name, result)
+}
+
+const pcUsage = "用法:\n" +
+	".pc new [角色名] [coc7|dnd5e] - 新建人物卡并设为当前人物卡\n" +
+	".pc set str16 dex14 lv3 - 设置 DnD5E 属性值、等级(lv)和熟练加值(prof)\n" +
+	".pc prof 隐匿 察觉 wis - 添加熟练技能或熟练豁免，名称前加 - 移除\n" +
+	".pc expert 隐匿 - 添加专精技能\n" +
+	".pc weapon 长剑 1d8 str [挥砍] [+1] - 添加武器，属性可为 finesse（灵巧），.pc weapon -长剑 移除\n" +
+	".pc resist/vuln/immune 火焰 - 添加伤害抗性、易伤或免疫，名称前加 - 移除"
+
+// newPc 新建人物卡并设为当前人物卡
+func newPc(ctx *CommandContext, fields []string) string {
+	if len(fields) == 0 || len(fields) > 2 {
+		return "用法: .pc new [角色名] [coc7|dnd5e]"
+	}
+	system := "coc7"
+	if len(fields) == 2 {
+		system = strings.ToLower(fields[1])
+	}
+	if system != "coc7" && system != "dnd5e" {
+		return fmt.Sprintf("不支持的规则: %s，可选 coc7 或 dnd5e", fields[1])
+	}
+
+	card := &storage.CharacterCard{
+		ID:       storage.NewCardID(ctx.PlayerID),
+		Name:     fields[0],
+		System:   system,
+		PlayerID: ctx.PlayerID,
+		GroupID:  ctx.GroupID,
+		Attrs:    make(map[string]interface{}),
+	}
+	if system == "dnd5e" {
+		card.DnD = &storage.DnD5EStats{Abilities: make(map[string]int), Level: 1}
+		for _, ability := range DnD5EAbilities {
+			card.DnD.Abilities[ability] = 10
+		}
+	}
+	if err := saveCard(ctx, card, true); err != nil {
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+	return fmt.Sprintf("已新建 %s 人物卡 %s，并设为当前人物卡", system, card.Name)
+}
+
+// showPc 展示当前人物卡，DnD5E 人物卡列出调整值、熟练项和武器
+func showPc(ctx *CommandContext) string {
+	card, ok := ctx.Storage.ActiveCard(ctx.PlayerID, ctx.GroupID)
+	if !ok {
+		return "你在本群还没有人物卡，请先使用 .pc new [角色名] [coc7|dnd5e] 创建"
+	}
+	if card.DnD == nil {
+		return showCard(ctx, nil)
+	}
+
+	d := card.DnD
+	lines := []string{fmt.Sprintf("%s (DnD5E %d级，熟练加值 +%d)", card.Name, d.Level, ProficiencyBonus(d))}
+	abilities := make([]string, len(DnD5EAbilities))
+	for i, ability := range DnD5EAbilities {
+		score := d.Abilities[ability]
+		abilities[i] = fmt.Sprintf("%s:%d(%+d)", dndAbilityNames[ability], score, AbilityModifier(score))
+	}
+	lines = append(lines, strings.Join(abilities, " "))
+
+	if len(d.Saves) > 0 {
+		saves := make([]string, len(d.Saves))
+		for i, ability := range d.Saves {
+			saves[i] = dndAbilityNames[ability]
+		}
+		lines = append(lines, "熟练豁免: "+strings.Join(saves, "、"))
+	}
+	if len(d.Skills) > 0 {
+		lines = append(lines, "熟练技能: "+strings.Join(d.Skills, "、"))
+	}
+	if len(d.Expertise) > 0 {
+		lines = append(lines, "专精技能: "+strings.Join(d.Expertise, "、"))
+	}
+	if len(d.Weapons) > 0 {
+		names := make([]string, 0, len(d.Weapons))
+		for name := range d.Weapons {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		weapons := make([]string, len(names))
+		for i, name := range names {
+			w := d.Weapons[name]
+			weapons[i] = weaponText(d, name, w)
+		}
+		lines = append(lines, "武器: "+strings.Join(weapons, "、"))
+	}
+	for _, defense := range []struct {
+		label string
+		types []string
+	}{{"抗性", d.Resistances}, {"易伤", d.Vulnerable}, {"免疫", d.Immunities}} {
+		if len(defense.types) > 0 {
+			lines = append(lines, defense.label+": "+strings.Join(defense.types, "、"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// weaponText 武器的命中加值和伤害，例如 长剑(命中+5 伤害1d8+3 挥砍)
+func weaponText(d *storage.DnD5EStats, name string, w storage.Weapon) string {
+	damage := weaponDamage(d, w)
+	if w.Type != "" {
+		damage += " " + w.Type
+	}
+	return fmt.Sprintf("%s(命中%+d 伤害%s)", name, dndWeaponModifier(d, w), damage)
+}
+
+// weaponDamage 武器的伤害表达式，加上属性调整值和武器加值
+func weaponDamage(d *storage.DnD5EStats, w storage.Weapon) string {
+	if mod := dndWeaponAbilityModifier(d, w) + w.Bonus; mod != 0 {
+		return fmt.Sprintf("%s%+d", w.Damage, mod)
+	}
+	return w.Damage
+}
+
+// setDnDStats 设置属性值、等级和熟练加值
+func setDnDStats(d *storage.DnD5EStats, args string) (string, string) {
+	var results []string
+	for rest := args; rest != ""; {
+		m := pcSetRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return "", fmt.Sprintf("无法识别: %s\n例如: .pc set str16 dex14 lv3", rest)
+		}
+		rest = strings.TrimLeft(rest[len(m[0]):], " ,，")
+		value, _ := strconv.Atoi(m[2])
+		switch key := strings.ToLower(m[1]); key {
+		case "lv", "level", "等级":
+			if value < 1 || value > 20 {
+				return "", "等级必须在1-20之间"
+			}
+			d.Level = value
+			results = append(results, fmt.Sprintf("等级 %d", value))
+		case "prof", "熟练加值":
+			d.Proficiency = value
+			results = append(results, fmt.Sprintf("熟练加值 +%d", value))
+		default:
+			ability, ok := dndAbility(key)
+			if !ok {
+				return "", fmt.Sprintf("未知的属性: %s", m[1])
+			}
+			d.Abilities[ability] = value
+			results = append(results, fmt.Sprintf("%s %d", dndAbilityNames[ability], value))
+		}
+	}
+	if len(results) == 0 {
+		return "", "例如: .pc set str16 dex14 lv3"
+	}
+	return strings.Join(results, "，"), ""
+}
+
+// setProficiencies 添加或移除熟练技能、熟练豁免，expert 为 true 时设置专精技能
+func setProficiencies(d *storage.DnD5EStats, names []string, expert bool) (string, string) {
+	if len(names) == 0 {
+		return "", "请给出技能或属性，例如 .pc prof 隐匿 wis"
+	}
+	var results []string
+	for _, name := range names {
+		name, remove := strings.CutPrefix(name, "-")
+		list, label := &d.Skills, "熟练"
+		if expert {
+			list, label = &d.Expertise, "专精"
+		}
+		skill, ok := dndSkill(name)
+		if !ok {
+			ability, isAbility := dndAbility(name)
+			if !isAbility || expert {
+				return "", fmt.Sprintf("未知的技能: %s", name)
+			}
+			list, skill, label = &d.Saves, ability, "熟练豁免"
+			name = dndAbilityNames[ability]
+		} else {
+			name = skill
+		}
+
+		index := slices.Index(*list, skill)
+		switch {
+		case remove && index >= 0:
+			*list = slices.Delete(*list, index, index+1)
+			results = append(results, "移除"+label+" "+name)
+		case !remove && index < 0:
+			*list = append(*list, skill)
+			results = append(results, label+" "+name)
+		}
+	}
+	if len(results) == 0 {
+		return "没有变化", ""
+	}
+	return strings.Join(results, "，"), ""
+}
+
+// setWeapon 添加或移除武器：名称 伤害 [属性] [伤害类型] [±加值]
+func setWeapon(d *storage.DnD5EStats, fields []string) (string, string) {
+	const usage = "例如: .pc weapon 长剑 1d8 str 挥砍 或 .pc weapon 短剑 1d6 finesse +1，.pc weapon -长剑 移除"
+	if len(fields) == 1 {
+		name, ok := strings.CutPrefix(fields[0], "-")
+		if _, found := d.Weapons[name]; !ok || !found {
+			return "", usage
+		}
+		delete(d.Weapons, name)
+		return "移除武器 " + name, ""
+	}
+	if len(fields) < 2 || len(fields) > 5 {
+		return "", usage
+	}
+
+	name := fields[0]
+	weapon := storage.Weapon{Ability: "str", Damage: fields[1]}
+	if _, err := parser.ParseProgram(weapon.Damage); err != nil {
+		return "", fmt.Sprintf("伤害表达式有误: %s\n%v", weapon.Damage, err)
+	}
+	for _, field := range fields[2:] {
+		if bonus, err := strconv.Atoi(field); err == nil {
+			weapon.Bonus = bonus
+			continue
+		}
+		if typ, ok := damageType(field); ok {
+			weapon.Type = typ
+			continue
+		}
+		switch ability, ok := dndAbility(field); {
+		case ok:
+			weapon.Ability = ability
+		case field == "finesse" || field == "灵巧":
+			weapon.Ability = "finesse"
+		default:
+			return "", fmt.Sprintf("未知的属性: %s\n%s", field, usage)
+		}
+	}
+	if d.Weapons == nil {
+		d.Weapons = make(map[string]storage.Weapon)
+	}
+	d.Weapons[name] = weapon
+	return "武器 " + weaponText(d, name, weapon), ""
+}
+
+// setDamageTypes 添加或移除伤害抗性、易伤或免疫
+func setDamageTypes(list *[]string, label string, names []string) (string, string) {
+	if len(names) == 0 {
+		return "", fmt.Sprintf("请给出伤害类型，例如 .pc resist 火焰，可选: %s", strings.Join(DnD5EDamageTypes, "、"))
+	}
+	var results []string
+	for _, name := range names {
+		name, remove := strings.CutPrefix(name, "-")
+		typ, ok := damageType(name)
+		if !ok {
+			return "", fmt.Sprintf("未知的伤害类型: %s，可选: %s", name, strings.Join(DnD5EDamageTypes, "、"))
+		}
+		index := slices.Index(*list, typ)
+		switch {
+		case remove && index >= 0:
+			*list = slices.Delete(*list, index, index+1)
+			results = append(results, "移除"+label+" "+typ)
+		case !remove && index < 0:
+			*list = append(*list, typ)
+			results = append(results, label+" "+typ)
+		}
+	}
+	if len(results) == 0 {
+		return "没有变化", ""
+	}
+	return strings.Join(results, "，"), ""
+}
@@ -0,0 +1,201 @@
+package dice
+
+import (
+	"fmt"
+	"island/storage"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rememberCheck 记录玩家最近一次技能检定，供 .push 和 .luck 使用；校验重放时不记录
+func rememberCheck(ctx *CommandContext, label string, r *CoC7Result) {
+	if ctx.Storage == nil || ctx.DryRun {
+		return
+	}
+	check := storage.LastCheck{
+		Label:      label,
+		Skill:      r.Skill,
+		Difficulty: r.Difficulty,
+		Bonus:      r.Bonus,
+		Roll:       r.Roll,
+		Level:      int(r.Level),
+	}
+	if err := ctx.Storage.SetLastCheck(ctx.PlayerID, ctx.GroupID, check); err != nil {
+		log.Printf("记录最近检定失败: %v", err)
+	}
+}
+
+// lastCheck 读取玩家最近一次技能检定，没有时 errMsg 不为空
+func lastCheck(ctx *CommandContext) (check storage.LastCheck, result *CoC7Result, errMsg string) {
+	if ctx.Storage == nil {
+		return check, nil, "未启用数据存储，无法读取上一次检定"
+	}
+	check, ok := ctx.Storage.LastCheck(ctx.PlayerID, ctx.GroupID)
+	if !ok {
+		return check, nil, "你在本群还没有进行过技能检定"
+	}
+	result = &CoC7Result{
+		Roll:       check.Roll,
+		Skill:      check.Skill,
+		Difficulty: check.Difficulty,
+		Level:      SuccessLevel(check.Level),
+	}
+	return check, result, ""
+}
+
+// addHistory 将没有随机数抽取的操作写入掷骰历史；校验重放时不写入
+func addHistory(ctx *CommandContext, result string) {
+	if ctx.Storage == nil || ctx.DryRun {
+		return
+	}
+	entry := &storage.RollHistory{
+		PlayerID:   ctx.PlayerID,
+		GroupID:    ctx.GroupID,
+		Expression: ctx.Args,
+		Result:     result,
+	}
+	if err := ctx.Storage.AddHistory(entry); err != nil {
+		log.Printf("写入掷骰历史失败: %v", err)
+	}
+}
+
+// PushCommand .push 指令 (孤注一掷)
+type PushCommand struct {
+	BaseCommand
+}
+
+func NewPushCommand() *PushCommand {
+	return &PushCommand{
+		BaseCommand: BaseCommand{
+			name:  "push",
+			help:  ".push - 孤注一掷，重新进行上一次失败的检定",
+			regex: regexp.MustCompile(`^push$`),
+		},
+	}
+}
+
+func (c *PushCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *PushCommand) Process(ctx *CommandContext) string {
+	check, last, errMsg := lastCheck(ctx)
+	switch {
+	case errMsg != "":
+		return errMsg
+	case check.Pushed:
+		return "孤注一掷的检定不能再次孤注一掷"
+	case last.Passed():
+		return "上一次检定已经成功，无需孤注一掷"
+	}
+
+	rules := coc7Rules(ctx)
+	var result *CoC7Result
+	if check.Bonus != 0 {
+		var err error
+		if result, err = ctx.Engine.CoC7BonusRoll(check.Skill, check.Bonus, check.Difficulty, rules); err != nil {
+			return fmt.Sprintf("检定出错: %v", err)
+		}
+	} else {
+		result = ctx.Engine.CoC7Roll(check.Skill, check.Difficulty, rules)
+	}
+
+	lines := []string{
+		"孤注一掷！失败将招致严重的后果，由守秘人决定",
+		FormatCoC7Result(check.Label, result),
+	}
+	if !result.Passed() {
+		lines = append(lines, "孤注一掷失败，守秘人将施加可怕的后果")
+	}
+
+	check.Roll, check.Level, check.Pushed, check.Time = result.Roll, int(result.Level), true, 0
+	if !ctx.DryRun {
+		if err := ctx.Storage.SetLastCheck(ctx.PlayerID, ctx.GroupID, check); err != nil {
+			log.Printf("记录最近检定失败: %v", err)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LuckCommand .luck 指令 (消耗幸运使上一次失败的检定成功)
+type LuckCommand struct {
+	BaseCommand
+}
+
+func NewLuckCommand() *LuckCommand {
+	return &LuckCommand{
+		BaseCommand: BaseCommand{
+			name:  "luck",
+			help:  ".luck [点数] - 消耗人物卡的幸运，使上一次失败的检定成功，省略点数时消耗恰好所需的幸运",
+			regex: regexp.MustCompile(`^luck\s*(\d*)$`),
+		},
+	}
+}
+
+func (c *LuckCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *LuckCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return "用法: .luck [点数]"
+	}
+	check, last, errMsg := lastCheck(ctx)
+	switch {
+	case errMsg != "":
+		return errMsg
+	case last.Passed():
+		return "上一次检定已经成功，无需消耗幸运"
+	case check.Pushed:
+		return "孤注一掷的检定不能消耗幸运"
+	case last.Level == LevelFumble:
+		return "大失败不能消耗幸运挽回"
+	}
+
+	card := currentCard(ctx)
+	luck, ok := 0, false
+	if card != nil {
+		luck, ok = card.Int("幸运")
+	}
+	if !ok {
+		return "没有找到幸运值，请先使用 .st 幸运50 记录"
+	}
+
+	needed := check.Roll - last.Target()
+	spend := needed
+	if matches[1] != "" {
+		spend, _ = strconv.Atoi(matches[1])
+	}
+	switch {
+	case spend < needed:
+		return fmt.Sprintf("掷出 %d，目标值 %d，至少需要消耗 %d 点幸运", check.Roll, last.Target(), needed)
+	case spend >= check.Roll:
+		return fmt.Sprintf("最多只能消耗 %d 点幸运", check.Roll-1)
+	case spend > luck:
+		return fmt.Sprintf("幸运不足: 需要 %d 点，当前幸运 %d", spend, luck)
+	}
+
+	// 消耗幸运不能换来大成功
+	result := *last
+	result.Roll -= spend
+	result.Level = min(coc7Rules(ctx).Resolve(result.Roll, result.Skill, result.Difficulty), LevelExtreme)
+	card.SetInt("幸运", luck-spend)
+	if err := saveCard(ctx, card, false); err != nil {
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+
+	check.Roll, check.Level, check.LuckSpent, check.Time = result.Roll, int(result.Level), check.LuckSpent+spend, 0
+	if !ctx.DryRun {
+		if err := ctx.Storage.SetLastCheck(ctx.PlayerID, ctx.GroupID, check); err != nil {
+			log.Printf("记录最近检定失败: %v", err)
+		}
+	}
+
+	output := fmt.Sprintf("%s 消耗 %d 点幸运，幸运 %d → %d\n%s (原掷骰 %d)",
+		card.Name, spend, luck, luck-spend, FormatCoC7Result(check.Label, &result), check.Roll+spend)
+	addHistory(ctx, output)
+	return output
+}
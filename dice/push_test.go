@@ -0,0 +1,50 @@
+package dice
+
+import "testing"
+
+// TestPushAndLuck .push 重新进行上一次失败的检定，.luck 消耗幸运使其成功
+func TestPushAndLuck(t *testing.T) {
+	registry, store := newCardTestRegistry(t, t.TempDir())
+
+	tests := []struct {
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{".push", nil, "你在本群还没有进行过技能检定"},
+		{".st 侦查60 幸运50", nil, "已更新 未命名角色 的属性: 侦查 60，幸运 50"},
+		{".ra 侦查", []int{79}, "未命名角色 的侦查检定 60 → 80 失败"},
+		{".luck 10", nil, "掷出 80，目标值 60，至少需要消耗 20 点幸运"},
+		{".luck", nil, "未命名角色 消耗 20 点幸运，幸运 50 → 30\n未命名角色 的侦查检定 60 → 60 成功 (原掷骰 80)"},
+		{".luck", nil, "上一次检定已经成功，无需消耗幸运"},
+		{".ra 困难侦查", []int{44}, "未命名角色 的困难侦查检定 60/30 → 45 成功，未达到难度要求，检定失败"},
+		{".luck 40", nil, "幸运不足: 需要 40 点，当前幸运 30"},
+		{".push", []int{9}, "孤注一掷！失败将招致严重的后果，由守秘人决定\n未命名角色 的困难侦查检定 60/30 → 10 极难成功"},
+		{".push", nil, "孤注一掷的检定不能再次孤注一掷"},
+		{".rb 侦查", []int{8, 8, 7}, "未命名角色 的侦查(奖励骰×1)检定 60 → 78 失败 (十位 80/70，个位 8)"},
+		{".push", []int{1, 2, 0}, "孤注一掷！失败将招致严重的后果，由守秘人决定\n" +
+			"未命名角色 的侦查(奖励骰×1)检定 60 → 2 极难成功 (十位 10/0，个位 2)"},
+		{".ra 侦查", []int{99}, "未命名角色 的侦查检定 60 → 100 大失败！"},
+		{".luck", nil, "大失败不能消耗幸运挽回"},
+		{".push", []int{69}, "孤注一掷！失败将招致严重的后果，由守秘人决定\n" +
+			"未命名角色 的侦查检定 60 → 70 失败\n孤注一掷失败，守秘人将施加可怕的后果"},
+		{".luck", nil, "孤注一掷的检定不能消耗幸运"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, 2, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+
+	card, _ := store.ActiveCard(1, 2)
+	if luck, _ := card.Int("幸运"); luck != 30 {
+		t.Errorf("saved luck = %d, want 30", luck)
+	}
+	found := false
+	for _, h := range store.GetHistory(1, 20) {
+		found = found || h.Expression == "luck"
+	}
+	if !found {
+		t.Error("spending luck should be recorded in history")
+	}
+}
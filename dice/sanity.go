@@ -0,0 +1,133 @@
+package dice
+
+import (
+	"fmt"
+	"island/parser"
+	"island/storage"
+	"strconv"
+	"strings"
+)
+
+// TEMP_INSANITY_LOSS 单次损失达到此值时可能陷入临时性疯狂
+const TEMP_INSANITY_LOSS = 5
+
+// SanCheckResult 一次理智检定的结果
+type SanCheckResult struct {
+	Check    *CoC7Result
+	LossExpr string // 使用的损失表达式
+	Loss     int    // 损失的理智
+	Rolled   bool   // 损失是否经过投掷
+	MaxLoss  bool   // 大失败时直接取最大损失
+}
+
+// CoC7SanCheck 理智检定：d100 对当前理智，成功按 successLoss、失败按 failureLoss 扣除
+// 大失败时失败损失取最大值，损失表达式由解析器计算
+func (e *Engine) CoC7SanCheck(san int, successLoss, failureLoss string, rules CoC7Rules) (*SanCheckResult, error) {
+	result := &SanCheckResult{Check: e.CoC7Roll(san, DifficultyRegular, rules)}
+	result.LossExpr = failureLoss
+	if result.Check.Level.Succeeded() {
+		result.LossExpr = successLoss
+	}
+
+	if result.Check.Level == LevelFumble {
+		dist, err := parser.AnalyzeDistribution(failureLoss)
+		if err == nil {
+			result.Loss, result.MaxLoss = dist.Max(), true
+		}
+	}
+	if !result.MaxLoss {
+		loss, process, err := e.EvalInt(result.LossExpr)
+		if err != nil {
+			return nil, err
+		}
+		result.Loss, result.Rolled = loss, process != ""
+	}
+	result.Loss = max(result.Loss, 0)
+	return result, nil
+}
+
+// sanCheck 完成 .sc：读取人物卡的理智（或使用指令给出的理智），扣除损失并保存
+func sanCheck(ctx *CommandContext, successLoss, failureLoss, sanArg string) string {
+	var card *storage.CharacterCard
+	var san int
+	if sanArg != "" {
+		san, _ = strconv.Atoi(sanArg)
+	} else {
+		card = currentCard(ctx)
+		value, ok := 0, false
+		if card != nil {
+			value, ok = card.Int("理智")
+		}
+		if !ok {
+			return "没有找到理智值，请先使用 .st 理智60 记录，或在指令后给出，例如 .sc 1/1d6 60"
+		}
+		san = value
+	}
+
+	// 先确认两个损失表达式都能解析，避免掷骰后才发现写错
+	for _, expr := range []string{successLoss, failureLoss} {
+		if _, err := parser.ParseProgram(expr); err != nil {
+			return fmt.Sprintf("损失表达式有误: %s\n%v", expr, err)
+		}
+	}
+
+	result, err := ctx.Engine.CoC7SanCheck(san, successLoss, failureLoss, coc7Rules(ctx))
+	if err != nil {
+		return fmt.Sprintf("理智损失计算出错: %v", err)
+	}
+	newSan := max(san-result.Loss, 0)
+
+	label := "理智"
+	if card != nil {
+		label = card.Name + " 的理智"
+	}
+	lossText := strconv.Itoa(result.Loss)
+	switch {
+	case result.MaxLoss:
+		lossText = fmt.Sprintf("%s 取最大值 %d", result.LossExpr, result.Loss)
+	case result.Rolled:
+		lossText = fmt.Sprintf("%s=%d", result.LossExpr, result.Loss)
+	}
+	check := strings.TrimSuffix(FormatCoC7Result(label, result.Check), "！")
+	lines := []string{fmt.Sprintf("%s，理智损失 %s，理智 %d → %d", check, lossText, san, newSan)}
+
+	if result.Loss >= TEMP_INSANITY_LOSS {
+		lines = append(lines, fmt.Sprintf("单次损失理智达到 %d：请进行智力检定，成功则陷入临时性疯狂（.ti 抽取症状）", TEMP_INSANITY_LOSS))
+	}
+
+	if card != nil {
+		card.SetInt("理智", newSan)
+		if result.Loss > 0 {
+			if card.Sanity == nil {
+				card.Sanity = &storage.SanitySession{StartSan: san}
+			}
+			threshold := max(card.Sanity.StartSan/5, 1)
+			before := card.Sanity.Lost
+			card.Sanity.Lost += result.Loss
+			if before < threshold && card.Sanity.Lost >= threshold {
+				lines = append(lines, fmt.Sprintf("本场次累计损失理智 %d，达到起始理智 %d 的五分之一：陷入不定性疯狂（.li 抽取症状）",
+					card.Sanity.Lost, card.Sanity.StartSan))
+			}
+		}
+		if err := saveCard(ctx, card, false); err != nil {
+			return fmt.Sprintf("保存人物卡失败: %v", err)
+		}
+	}
+	if newSan == 0 && san > 0 {
+		lines = append(lines, "理智归零：陷入永久性疯狂")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resetSanitySession 开始新的场次，清零累计的理智损失
+func resetSanitySession(ctx *CommandContext) string {
+	card := currentCard(ctx)
+	if card == nil {
+		return "你在本群还没有人物卡，请先使用 .st 记录属性"
+	}
+	card.Sanity = nil
+	if err := saveCard(ctx, card, false); err != nil {
+		return fmt.Sprintf("保存人物卡失败: %v", err)
+	}
+	return fmt.Sprintf("%s 开始新的场次，累计理智损失已清零", card.Name)
+}
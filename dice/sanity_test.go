@@ -0,0 +1,41 @@
+package dice
+
+import "testing"
+
+// TestSanCheck .sc 扣除人物卡理智，并提示临时性和不定性疯狂
+func TestSanCheck(t *testing.T) {
+	registry, store := newCardTestRegistry(t, t.TempDir())
+
+	tests := []struct {
+		group int64
+		cmd   string
+		draws []int
+		want  string
+	}{
+		{2, ".st 理智60", nil, "已更新 未命名角色 的属性: 理智 60"},
+		{2, ".sc 1/1d6+1", []int{79, 3}, "未命名角色 的理智检定 60 → 80 失败，理智损失 1d6+1=5，理智 60 → 55\n" +
+			"单次损失理智达到 5：请进行智力检定，成功则陷入临时性疯狂（.ti 抽取症状）"},
+		{2, ".sc 1/1d10", []int{9}, "未命名角色 的理智检定 55 → 10 极难成功，理智损失 1，理智 55 → 54"},
+		{2, ".sc 1/1d10", []int{99}, "未命名角色 的理智检定 54 → 100 大失败，理智损失 1d10 取最大值 10，理智 54 → 44\n" +
+			"单次损失理智达到 5：请进行智力检定，成功则陷入临时性疯狂（.ti 抽取症状）\n" +
+			"本场次累计损失理智 16，达到起始理智 60 的五分之一：陷入不定性疯狂（.li 抽取症状）"},
+		{2, ".sc reset", nil, "未命名角色 开始新的场次，累计理智损失已清零"},
+		{2, ".sc 0/1d3", []int{0}, "未命名角色 的理智检定 44 → 1 大成功，理智损失 0，理智 44 → 44"},
+		{3, ".sc 1/1d6 30", []int{9}, "理智检定 30 → 10 困难成功，理智损失 1，理智 30 → 29"},
+		{3, ".sc 1/1d6", nil, "没有找到理智值，请先使用 .st 理智60 记录，或在指令后给出，例如 .sc 1/1d6 60"},
+		{2, ".sc 1/1d", nil, "损失表达式有误: 1d\n第 3 个字符: 语法错误"},
+	}
+	for _, tt := range tests {
+		if got := runCommand(registry, 1, tt.group, tt.cmd, tt.draws...); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+
+	card, _ := store.ActiveCard(1, 2)
+	if san, _ := card.Int("理智"); san != 44 {
+		t.Errorf("saved san = %d, want 44", san)
+	}
+	if card.Sanity != nil {
+		t.Errorf("sanity session = %+v, want reset", card.Sanity)
+	}
+}
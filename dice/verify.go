@@ -0,0 +1,138 @@
+package dice
+
+import (
+	"errors"
+	"fmt"
+	"island/rng"
+	"island/storage"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VerifyResult 掷骰记录的校验结果
+type VerifyResult struct {
+	Roll     *storage.RollHistory `json:"roll"`
+	Replayed string               `json:"replayed"`          // 重放得到的输出
+	Match    bool                 `json:"match"`             // 重放输出与记录一致且恰好用完所有抽取
+	Problem  string               `json:"problem,omitempty"` // 不一致的原因
+}
+
+// Verify 使用记录的随机数抽取重放指定编号的掷骰，确认输出与记录一致
+func (r *CommandRegistry) Verify(id int64, engine *Engine) (*VerifyResult, error) {
+	if r.storage == nil {
+		return nil, errors.New("未启用掷骰记录")
+	}
+	roll, err := r.storage.GetRoll(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var handler CommandHandler
+	for _, c := range r.commands {
+		if c.Match(roll.Expression) {
+			handler = c
+			break
+		}
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("无法识别记录中的指令: %s", roll.Expression)
+	}
+
+	// 在掷骰时的数据上重放，早期的记录没有保存数据时使用当前数据
+	store := r.storage
+	if roll.State != nil {
+		store = r.storage.Restore(roll.PlayerID, roll.GroupID, roll.State)
+	}
+	replay := rng.NewReplay(roll.Draws)
+	ctx := &CommandContext{
+		PlayerID: roll.PlayerID,
+		GroupID:  roll.GroupID,
+		Args:     roll.Expression,
+		Engine:   engine.WithSource(replay),
+		DryRun:   true,
+		Storage:  store,
+	}
+	result := &VerifyResult{Roll: roll, Replayed: handler.Process(ctx)}
+
+	switch {
+	case replay.Err() != nil:
+		result.Problem = replay.Err().Error()
+	case replay.Remaining() > 0:
+		result.Problem = fmt.Sprintf("还有 %d 次抽取未被使用", replay.Remaining())
+	case result.Replayed != roll.Result:
+		result.Problem = "重放输出与记录不一致"
+	default:
+		result.Match = true
+	}
+	return result, nil
+}
+
+// VerifyCommand .verify 指令 (校验掷骰记录)
+type VerifyCommand struct {
+	BaseCommand
+	registry *CommandRegistry
+}
+
+func NewVerifyCommand(registry *CommandRegistry) *VerifyCommand {
+	return &VerifyCommand{
+		BaseCommand: BaseCommand{
+			name:  "verify",
+			help:  ".verify [编号] - 重放并校验掷骰记录，省略编号时校验自己最近一次掷骰",
+			regex: regexp.MustCompile(`^verify\s*#?(\d*)$`),
+		},
+		registry: registry,
+	}
+}
+
+func (c *VerifyCommand) Match(cmd string) bool {
+	return c.regex.MatchString(cmd)
+}
+
+func (c *VerifyCommand) Process(ctx *CommandContext) string {
+	matches := c.regex.FindStringSubmatch(ctx.Args)
+	if len(matches) < 2 {
+		return "用法: .verify [编号]"
+	}
+	if c.registry.Storage() == nil {
+		return "未启用掷骰记录"
+	}
+
+	var id int64
+	if matches[1] != "" {
+		id, _ = strconv.ParseInt(matches[1], 10, 64)
+	} else {
+		last, ok := c.registry.Storage().LastRoll(ctx.PlayerID, ctx.GroupID)
+		if !ok {
+			return "没有找到你的掷骰记录"
+		}
+		id = last.ID
+	}
+
+	result, err := c.registry.Verify(id, ctx.Engine)
+	if err != nil {
+		return fmt.Sprintf("校验失败: %v", err)
+	}
+	return FormatVerifyResult(result)
+}
+
+// FormatVerifyResult 将校验结果格式化为回复文本
+func FormatVerifyResult(result *VerifyResult) string {
+	roll := result.Roll
+	var lines []string
+	if result.Match {
+		lines = append(lines, fmt.Sprintf("记录 #%d 校验通过", roll.ID))
+	} else {
+		lines = append(lines, fmt.Sprintf("记录 #%d 校验不通过: %s", roll.ID, result.Problem))
+	}
+	lines = append(lines, fmt.Sprintf("指令: .%s", roll.Expression))
+	lines = append(lines, fmt.Sprintf("玩家: %d", roll.PlayerID))
+	lines = append(lines, fmt.Sprintf("时间: %s", time.Unix(roll.Time, 0).Format("2006-01-02 15:04:05")))
+	lines = append(lines, fmt.Sprintf("随机数抽取: %d 次", len(roll.Draws)))
+	lines = append(lines, fmt.Sprintf("记录输出: %s", roll.Result))
+	if !result.Match {
+		lines = append(lines, fmt.Sprintf("重放输出: %s", result.Replayed))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,96 @@
+package dice
+
+import (
+	"island/rng"
+	"island/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestVerifyReplaysRecordedDraws 记录的掷骰可以被重放校验，篡改后的记录无法通过
+func TestVerifyReplaysRecordedDraws(t *testing.T) {
+	store, err := storage.NewAt(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewCommandRegistry()
+	registry.SetStorage(store)
+	engine := NewWithSource(rng.NewSeeded(7))
+
+	ctx := &CommandContext{PlayerID: 1, GroupID: 2, Engine: engine}
+	reply := registry.Process(".r 4d6kh3+1d20 力量", ctx)
+	if ctx.RollID == 0 || !strings.HasSuffix(reply, "(记录 #1)") {
+		t.Fatalf("roll was not recorded: %q", reply)
+	}
+
+	result, err := registry.Verify(ctx.RollID, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Match {
+		t.Fatalf("verify failed: %s\nrecorded: %s\nreplayed: %s", result.Problem, result.Roll.Result, result.Replayed)
+	}
+
+	verifyCtx := &CommandContext{PlayerID: 1, GroupID: 2, Engine: engine}
+	if got := registry.Process(".verify", verifyCtx); !strings.HasPrefix(got, "记录 #1 校验通过") {
+		t.Errorf(".verify = %q", got)
+	}
+	if verifyCtx.RollID != 0 {
+		t.Errorf(".verify itself was recorded as #%d", verifyCtx.RollID)
+	}
+
+	// 改动一次抽取后重放结果应与记录不符
+	roll := result.Roll
+	roll.Draws[0].Value = (roll.Draws[0].Value + 1) % roll.Draws[0].N
+	forged := &storage.RollHistory{PlayerID: 1, GroupID: 2, Expression: roll.Expression, Result: roll.Result, Draws: roll.Draws}
+	if err := store.AppendRoll(forged); err != nil {
+		t.Fatal(err)
+	}
+	result, err = registry.Verify(forged.ID, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Match {
+		t.Error("forged record passed verification")
+	}
+}
+
+// TestVerifyUsesRecordedState 校验在掷骰时的人物卡、检定和群数据文件上重放，之后修改数据不影响校验
+func TestVerifyUsesRecordedState(t *testing.T) {
+	dir := t.TempDir()
+	registry, _ := newCardTestRegistry(t, dir)
+	engine := NewWithSource(rng.NewSeeded(7))
+	run := func(cmd string) *CommandContext {
+		ctx := &CommandContext{PlayerID: 1, GroupID: 2, Engine: engine}
+		registry.Process(cmd, ctx)
+		return ctx
+	}
+
+	writeMadness := func(text string) {
+		data := `{"realtime": {"name": "本群疯狂表", "entries": [{"text": "` + text + `"}, {"text": "` + text + `"}]}}`
+		if err := os.WriteFile(filepath.Join(dir, MADNESS_FILE), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeMadness("原来的症状")
+	run(".st 侦查 50 幸运 60 生命值 12")
+	check := run(".ra 侦查")
+	hp := run(".hp -1d6")
+	madness := run(".ti")
+	run(".st 侦查 90 生命值 3")
+	run(".ra 侦查")
+	writeMadness("修改后的症状")
+
+	for _, ctx := range []*CommandContext{check, hp, madness} {
+		result, err := registry.Verify(ctx.RollID, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Match {
+			t.Errorf("record #%d: %s\nrecorded: %s\nreplayed: %s", ctx.RollID, result.Problem, result.Roll.Result, result.Replayed)
+		}
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"island/config"
 	"island/connection"
 	"island/dice"
+	"island/parser"
+	"island/storage"
 	"log"
 	"regexp"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -37,11 +40,18 @@ type OneBotMessage struct {
 
 // NewMessageHandler 创建新的消息处理器
 func NewMessageHandler(connManager *connection.ConnectionManager, cfg *config.Config) *MessageHandler {
+	registry := dice.NewCommandRegistry()
+	if store, err := storage.New(); err != nil {
+		log.Printf("数据存储初始化失败，掷骰记录已停用: %v", err)
+	} else {
+		registry.SetStorage(store)
+	}
+
 	return &MessageHandler{
 		connManager:  connManager,
 		config:      cfg,
 		diceEngine:  dice.New(),
-		cmdRegistry: dice.NewCommandRegistry(),
+		cmdRegistry: registry,
 	}
 }
 
@@ -99,18 +109,30 @@ func (h *MessageHandler) handleMessage(msg *OneBotMessage) {
 	}
 
 	// 处理命令
-	response := h.cmdRegistry.Process(content, ctx)
+	response := h.processCommand(content, ctx)
 
 	// 发送响应
 	h.sendResponse(msg, response)
 }
 
+// processCommand 处理一条指令，指令出错 panic 时记录日志并回复错误，避免消息循环退出
+func (h *MessageHandler) processCommand(content string, ctx *dice.CommandContext) (response string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("处理指令 %q 时出错: %v\n%s", content, r, debug.Stack())
+			response = "指令处理出错，请检查输入"
+		}
+	}()
+	return h.cmdRegistry.Process(content, ctx)
+}
+
 // extractMessageContent 提取消息文本内容
 func (h *MessageHandler) extractMessageContent(msg json.RawMessage) (string, error) {
 	var messageSegments []struct {
 		Type string `json:"type"`
 		Data struct {
-			Text string `json:"text"`
+			Text string          `json:"text"`
+			QQ   json.RawMessage `json:"qq"` // at 消息段的 QQ 号，可能是字符串或数字
 		} `json:"data"`
 	}
 
@@ -125,8 +147,13 @@ func (h *MessageHandler) extractMessageContent(msg json.RawMessage) (string, err
 
 	var builder strings.Builder
 	for _, seg := range messageSegments {
-		if seg.Type == "text" {
+		switch seg.Type {
+		case "text":
 			builder.WriteString(seg.Data.Text)
+		case "at":
+			// 保留 @ 为 CQ 码，供对抗检定等指令识别对象
+			qq := strings.Trim(string(seg.Data.QQ), `"`)
+			builder.WriteString(fmt.Sprintf("[CQ:at,qq=%s]", qq))
 		}
 	}
 	return builder.String(), nil
@@ -210,12 +237,24 @@ func (h *MessageHandler) GetCommandRegistry() *dice.CommandRegistry {
 
 // ProcessCommand 处理命令（供 Web 调用）
 func (h *MessageHandler) ProcessCommand(cmd string) string {
+	response, _ := h.ProcessCommandWithTrace(cmd)
+	return response
+}
+
+// ProcessCommandWithTrace 处理命令并返回掷骰求值树（供 Web 调用）
+func (h *MessageHandler) ProcessCommandWithTrace(cmd string) (string, *parser.TraceNode) {
 	ctx := &dice.CommandContext{
 		PlayerID: 0,
 		GroupID:  0,
 		Engine:   h.diceEngine,
 	}
-	return h.cmdRegistry.Process(cmd, ctx)
+	response := h.processCommand(cmd, ctx)
+	return response, ctx.Trace
+}
+
+// VerifyRoll 重放并校验指定编号的掷骰记录（供 Web 调用）
+func (h *MessageHandler) VerifyRoll(id int64) (*dice.VerifyResult, error) {
+	return h.cmdRegistry.Verify(id, h.diceEngine)
 }
 
 // HandleGetGroupList 处理获取群组列表请求
@@ -295,7 +334,7 @@ func (h *MessageHandler) HandleWebSocketRequest(conn *websocket.Conn, msgType st
 					GroupID:  0,
 					Engine:   h.diceEngine,
 				}
-				response := h.cmdRegistry.Process(cmd, ctx)
+				response := h.processCommand(cmd, ctx)
 				conn.WriteJSON(map[string]interface{}{
 					"type":    "command_result",
 					"result":  response,
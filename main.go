@@ -6,15 +6,12 @@ import (
 	"island/handlers"
 	"island/web"
 	"log"
-	"math/rand"
 	"time"
 	"os/exec"
 	"runtime"
 )
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-
 	// 加载配置
 	appConfig, err := config.LoadConfig()
 	if err != nil {
@@ -3,8 +3,6 @@ package parser
 import (
 	"fmt"
 	"math"
-	"math/rand"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,47 +15,44 @@ var (
 	MIN_DICE_SIDES = 1
 )
 
+// MAX_BONUS_DICE 一次掷骰最多使用的奖励骰或惩罚骰数量
+const MAX_BONUS_DICE = 10
+
 // Interface for expressions that can return both a numeric value and a list of rolls
 type MultiValueExpr interface {
 	Expr
-	EvaluateMulti() []int
+	EvaluateMulti(ctx *Context) []int
 }
 
 // FateDiceExpr represents a FATE dice roll (df/f)
 type FateDiceExpr struct {
-	Count   Expr
-	process string
-	rolls   []int
-}
-
-func (e *FateDiceExpr) GetProcess() string {
-	return e.process
+	Node
+	Count Expr
 }
 
-func (e *FateDiceExpr) Evaluate() interface{} {
+func (e *FateDiceExpr) Evaluate(ctx *Context) interface{} {
 	count := 4 // Default is 4 dice
 	if e.Count != nil {
-		count = e.Count.Evaluate().(int)
+		count = ctx.evalInt(e.Count)
 	}
 
-	if count > MAX_ROLLS {
-		fmt.Println(fmt.Sprintf("Exceeded maximum rolls: %d", MAX_ROLLS))
-		return 0
-	}
+	checkCount(ctx, count)
 
-	e.rolls = make([]int, count)
+	rolls := make([]int, count)
+	dice := make([]Die, count)
 	sum := 0
 
 	for i := 0; i < count; i++ {
 		// FATE dice have values of -1, 0, and 1
-		roll := rand.Intn(3) - 1
-		e.rolls[i] = roll
+		roll := ctx.intn(3) - 1
+		rolls[i] = roll
+		dice[i] = Die{Sides: 3, Value: roll}
 		sum += roll
 	}
 
 	// Convert rolls to symbols for display
 	symbols := make([]string, count)
-	for i, r := range e.rolls {
+	for i, r := range rolls {
 		switch r {
 		case -1:
 			symbols[i] = "-"
@@ -69,7 +64,7 @@ func (e *FateDiceExpr) Evaluate() interface{} {
 	}
 
 	// 记录投掷过程
-	e.process = fmt.Sprintf("%df = %s = %d", count, formatRollsCompact(e.rolls), sum)
+	ctx.addDice(dice, fmt.Sprintf("%df = %s = %d", count, formatRollsCompact(rolls), sum))
 
 	return sum
 }
@@ -90,96 +85,95 @@ func symbolsAsInts(symbols []string) []int {
 	return result
 }
 
-func (e *FateDiceExpr) EvaluateMulti() []int {
+func (e *FateDiceExpr) EvaluateMulti(ctx *Context) []int {
 	count := 4 // Default is 4 dice
 	if e.Count != nil {
-		count = e.Count.Evaluate().(int)
+		count = ctx.evalInt(e.Count)
 	}
 
-	if count > MAX_ROLLS {
-		fmt.Println(fmt.Sprintf("Exceeded maximum rolls: %d", MAX_ROLLS))
-		return []int{0}
-	}
+	checkCount(ctx, count)
 
 	rolls := make([]int, count)
 	for i := 0; i < count; i++ {
-		rolls[i] = rand.Intn(3) - 1
+		rolls[i] = ctx.intn(3) - 1
 	}
 	return rolls
 }
 
 // PenaltyBonusDiceExpr represents CoC penalty or bonus dice (pb)
 type PenaltyBonusDiceExpr struct {
+	Node
 	IsBonus bool
 	Count   Expr
 }
 
-func (e *PenaltyBonusDiceExpr) Evaluate() interface{} {
+func (e *PenaltyBonusDiceExpr) Evaluate(ctx *Context) interface{} {
 	count := 1
 	if e.Count != nil {
-		count = e.Count.Evaluate().(int)
+		count = ctx.evalInt(e.Count)
 	}
 
-	if count > MAX_ROLLS {
-		fmt.Println(fmt.Sprintf("Exceeded maximum rolls: %d", MAX_ROLLS))
-		return 0
+	if count < 0 {
+		ctx.fail(ErrInvalidCount, "%d", count)
+	}
+	if count > MAX_BONUS_DICE {
+		ctx.fail(ErrTooManyDice, "奖励骰和惩罚骰的上限为 %d", MAX_BONUS_DICE)
 	}
 
 	// Roll the tens digit (0-9)
-	tensDie := rand.Intn(10)
+	tensDie := ctx.intn(10)
 
 	// Roll the units digit (0-9)
-	unitsDie := rand.Intn(10)
+	unitsDie := ctx.intn(10)
 
 	// Roll the penalty/bonus dice (0-9)
 	bonusDice := make([]int, count)
 	for i := 0; i < count; i++ {
-		bonusDice[i] = rand.Intn(10)
+		bonusDice[i] = ctx.intn(10)
 	}
 
-	// Calculate the result based on penalty or bonus
-	var result int
-	var tensDigit int
-
-	if e.IsBonus {
-		// For bonus: use the lowest tens digit
-		tensDigit = tensDie
-		for _, die := range bonusDice {
-			if die < tensDigit {
-				tensDigit = die
-			}
-		}
-	} else {
-		// For penalty: use the highest tens digit
-		tensDigit = tensDie
-		for _, die := range bonusDice {
-			if die > tensDigit {
-				tensDigit = die
-			}
+	// 个位和十位都为 0 时结果为 100，因此按实际结果而不是十位点数选择：
+	// 奖励骰取结果最小的十位骰，惩罚骰取结果最大的
+	value := func(tens int) int {
+		if tens == 0 && unitsDie == 0 {
+			return 100
 		}
+		return tens*10 + unitsDie
 	}
-
-	// Special case: handle 00 as 100
-	if tensDigit == 0 && unitsDie == 0 {
-		result = 100
-	} else {
-		result = tensDigit*10 + unitsDie
+	tensDigit := tensDie
+	for _, die := range bonusDice {
+		if e.IsBonus && value(die) < value(tensDigit) || !e.IsBonus && value(die) > value(tensDigit) {
+			tensDigit = die
+		}
 	}
+	result := value(tensDigit)
 
 	bonusType := "b"
 	if !e.IsBonus {
 		bonusType = "p"
 	}
 
+	// 个位骰在前，其后是所有十位骰，未被采用的十位骰标记为舍弃
+	dice := []Die{{Sides: 10, Value: unitsDie}}
+	chosen := false
+	for _, tens := range append([]int{tensDie}, bonusDice...) {
+		dropped := chosen || tens != tensDigit
+		if !dropped {
+			chosen = true
+		}
+		dice = append(dice, Die{Sides: 10, Value: tens, Dropped: dropped})
+	}
+
 	// 使用统一的输出格式
 	allRolls := append([]int{tensDie*10 + unitsDie}, bonusDice...)
-	fmt.Fprintln(os.Stdout, formatDiceOutput(fmt.Sprintf("1%s%d", bonusType, count), allRolls, result))
+	ctx.addDice(dice, formatDiceOutput(fmt.Sprintf("1%s%d", bonusType, count), allRolls, result))
 
 	return result
 }
 
 // InfinitePoolDiceExpr represents infinite addition dice pool (a)
 type InfinitePoolDiceExpr struct {
+	Node
 	Initial            Expr
 	AddLine            Expr
 	SuccessLine        Expr
@@ -187,25 +181,27 @@ type InfinitePoolDiceExpr struct {
 	Sides              Expr
 }
 
-func (e *InfinitePoolDiceExpr) Evaluate() interface{} {
-	initial := e.Initial.Evaluate().(int)
-	addLine := e.AddLine.Evaluate().(int)
+func (e *InfinitePoolDiceExpr) Evaluate(ctx *Context) interface{} {
+	initial := ctx.evalInt(e.Initial)
+	addLine := ctx.evalInt(e.AddLine)
 
 	successLine := 8 // Default success line is 8
 	if e.SuccessLine != nil {
-		successLine = e.SuccessLine.Evaluate().(int)
+		successLine = ctx.evalInt(e.SuccessLine)
 	}
 
 	sides := 10 // Default sides is 10
 	if e.Sides != nil {
-		sides = e.Sides.Evaluate().(int)
+		sides = ctx.evalInt(e.Sides)
 	}
 
-	if sides < MIN_DICE_SIDES || sides > MAX_DICE_SIDES {
-		fmt.Println(fmt.Sprintf("Invalid number of sides: %d", sides))
-		return 0
+	reverseSuccessLine := 0
+	if e.ReverseSuccessLine != nil {
+		reverseSuccessLine = ctx.evalInt(e.ReverseSuccessLine)
 	}
 
+	checkSides(ctx, sides)
+
 	iterations := 0
 	totalSuccesses := 0
 	allRolls := make([][]int, 0)
@@ -215,8 +211,7 @@ func (e *InfinitePoolDiceExpr) Evaluate() interface{} {
 	for currentPool > 0 {
 		iterations++
 		if iterations > MAX_ITERATIONS {
-			fmt.Println(fmt.Sprintf("Exceeded maximum iterations: %d", MAX_ITERATIONS))
-			break
+			ctx.fail(ErrIterationLimit, "%d", MAX_ITERATIONS)
 		}
 
 		// Roll the current pool of dice
@@ -224,7 +219,7 @@ func (e *InfinitePoolDiceExpr) Evaluate() interface{} {
 		successes := 0
 
 		for i := 0; i < currentPool; i++ {
-			roll := rand.Intn(sides) + 1
+			roll := ctx.intn(sides) + 1
 			rolls[i] = roll
 
 			// Count successes for next pool
@@ -239,7 +234,6 @@ func (e *InfinitePoolDiceExpr) Evaluate() interface{} {
 		// Count successes for final result
 		for _, roll := range rolls {
 			if e.ReverseSuccessLine != nil {
-				reverseSuccessLine := e.ReverseSuccessLine.Evaluate().(int)
 				if roll <= reverseSuccessLine {
 					totalSuccesses++
 				}
@@ -255,7 +249,7 @@ func (e *InfinitePoolDiceExpr) Evaluate() interface{} {
 		expr += fmt.Sprintf("k%d", successLine)
 	}
 	if e.ReverseSuccessLine != nil {
-		expr += fmt.Sprintf("q%d", e.ReverseSuccessLine.Evaluate().(int))
+		expr += fmt.Sprintf("q%d", reverseSuccessLine)
 	}
 	if e.Sides != nil && sides != 10 {
 		expr += fmt.Sprintf("m%d", sides)
@@ -268,31 +262,29 @@ func (e *InfinitePoolDiceExpr) Evaluate() interface{} {
 	}
 
 	// 使用统一的输出格式
-	fmt.Fprintln(os.Stdout, formatDiceOutput(expr, allDiceResults, totalSuccesses))
+	ctx.addDice(poolDice(allDiceResults, sides), formatDiceOutput(expr, allDiceResults, totalSuccesses))
 
 	return totalSuccesses
 }
 
 // DoubleCrossDiceExpr represents double cross addition dice pool (c)
 type DoubleCrossDiceExpr struct {
+	Node
 	Initial Expr
 	AddLine Expr
 	Sides   Expr
 }
 
-func (e *DoubleCrossDiceExpr) Evaluate() interface{} {
-	initial := e.Initial.Evaluate().(int)
-	addLine := e.AddLine.Evaluate().(int)
+func (e *DoubleCrossDiceExpr) Evaluate(ctx *Context) interface{} {
+	initial := ctx.evalInt(e.Initial)
+	addLine := ctx.evalInt(e.AddLine)
 
 	sides := 10 // Default sides is 10
 	if e.Sides != nil {
-		sides = e.Sides.Evaluate().(int)
+		sides = ctx.evalInt(e.Sides)
 	}
 
-	if sides < MIN_DICE_SIDES || sides > MAX_DICE_SIDES {
-		fmt.Println(fmt.Sprintf("Invalid number of sides: %d", sides))
-		return 0
-	}
+	checkSides(ctx, sides)
 
 	iterations := 0
 	totalScore := 0
@@ -303,8 +295,7 @@ func (e *DoubleCrossDiceExpr) Evaluate() interface{} {
 	for currentPool > 0 {
 		iterations++
 		if iterations > MAX_ITERATIONS {
-			fmt.Println(fmt.Sprintf("Exceeded maximum iterations: %d", MAX_ITERATIONS))
-			break
+			ctx.fail(ErrIterationLimit, "%d", MAX_ITERATIONS)
 		}
 
 		// Roll the current pool of dice
@@ -312,7 +303,7 @@ func (e *DoubleCrossDiceExpr) Evaluate() interface{} {
 		successes := 0
 
 		for i := 0; i < currentPool; i++ {
-			roll := rand.Intn(sides) + 1
+			roll := ctx.intn(sides) + 1
 			rolls[i] = roll
 
 			// Count successes for next pool
@@ -353,29 +344,38 @@ func (e *DoubleCrossDiceExpr) Evaluate() interface{} {
 	}
 
 	// 使用统一的输出格式
-	fmt.Fprintln(os.Stdout, formatDiceOutput(expr, allDiceResults, totalScore))
+	ctx.addDice(poolDice(allDiceResults, sides), formatDiceOutput(expr, allDiceResults, totalScore))
 
 	return totalScore
 }
 
+// poolDice 将骰池每一轮的结果转换为骰子列表
+func poolDice(rolls []int, sides int) []Die {
+	dice := make([]Die, len(rolls))
+	for i, roll := range rolls {
+		dice[i] = Die{Sides: sides, Value: roll}
+	}
+	return dice
+}
+
 // ArrayExpr represents an array of expressions [A,B,C,...]
 type ArrayExpr struct {
 	Elements []Expr
 }
 
-func (e *ArrayExpr) Evaluate() interface{} {
+func (e *ArrayExpr) Evaluate(ctx *Context) interface{} {
 	if len(e.Elements) == 0 {
 		return 0
 	}
 
 	// By default, return the last element's value
-	return e.Elements[len(e.Elements)-1].Evaluate()
+	return e.Elements[len(e.Elements)-1].Evaluate(ctx)
 }
 
-func (e *ArrayExpr) EvaluateMulti() []int {
+func (e *ArrayExpr) EvaluateMulti(ctx *Context) []int {
 	results := make([]int, len(e.Elements))
 	for i, elem := range e.Elements {
-		switch v := elem.Evaluate().(type) {
+		switch v := ctx.eval(elem).(type) {
 		case int:
 			results[i] = v
 		case bool:
@@ -391,107 +391,107 @@ func (e *ArrayExpr) EvaluateMulti() []int {
 	return results
 }
 
+// values 返回求值得到的数组中已经算好的各项，不会再次掷骰
+// 求值结果中的数组只包含常数，含有其他表达式时返回 false
+func (e *ArrayExpr) values() ([]int, bool) {
+	results := make([]int, len(e.Elements))
+	for i, elem := range e.Elements {
+		num, ok := elem.(*NumberExpr)
+		if !ok {
+			return nil, false
+		}
+		results[i] = num.Value
+	}
+	return results, true
+}
+
 // HighLowSelectExpr represents kh/kl/dh/dl operators
 type HighLowSelectExpr struct {
+	Node
 	Expr     Expr
 	Count    Expr
 	KeepHigh bool // true for kh/dh, false for kl/dl
 	KeepLeft bool // true for kh/kl, false for dh/dl
 }
 
-func (e *HighLowSelectExpr) Evaluate() interface{} {
-	var values []int
+func (e *HighLowSelectExpr) Evaluate(ctx *Context) interface{} {
+	var dice []Die
 
-	// Try to get multiple values first
-	if multiExpr, ok := e.Expr.(MultiValueExpr); ok {
-		values = multiExpr.EvaluateMulti()
+	if diceExpr, ok := e.Expr.(*DiceExpr); ok {
+		// 直接掷骰，保留面数信息
+		dice, _ = diceExpr.roll(ctx)
+	} else if multiExpr, ok := e.Expr.(MultiValueExpr); ok {
+		// Try to get multiple values first
+		for _, v := range multiExpr.EvaluateMulti(ctx) {
+			dice = append(dice, Die{Value: v})
+		}
 	} else {
 		// Otherwise, treat it as a single value
-		values = []int{e.Expr.Evaluate().(int)}
+		dice = []Die{{Value: ctx.evalInt(e.Expr)}}
 	}
 
 	count := 1
 	if e.Count != nil {
-		count = e.Count.Evaluate().(int)
+		count = ctx.evalInt(e.Count)
 	}
 
-	if count > len(values) {
-		count = len(values)
+	// 被重骰替换的骰子不参与选择
+	var order []int
+	for i, die := range dice {
+		if !die.Dropped {
+			order = append(order, i)
+		}
 	}
 
-	// Make a copy to avoid modifying the original
-	sortedValues := make([]int, len(values))
-	copy(sortedValues, values)
-
-	// Sort based on keep high/low
-	if e.KeepHigh {
-		sort.Sort(sort.Reverse(sort.IntSlice(sortedValues)))
-	} else {
-		sort.Ints(sortedValues)
+	if count > len(order) {
+		count = len(order)
+	}
+	if count < 0 {
+		count = 0
 	}
 
+	// Sort indexes based on keep high/low, keeping the original order of the dice
+	sort.SliceStable(order, func(a, b int) bool {
+		if e.KeepHigh {
+			return dice[order[a]].Value > dice[order[b]].Value
+		}
+		return dice[order[a]].Value < dice[order[b]].Value
+	})
+
 	// Select values based on keep left/right
-	selected := sortedValues
-	if e.KeepLeft {
-		selected = sortedValues[:count]
-	} else {
-		selected = sortedValues[len(sortedValues)-count:]
+	keptOrder := order[:count]
+	if !e.KeepLeft {
+		keptOrder = order[len(order)-count:]
 	}
 
-	// Sum the selected values
-	sum := 0
-	for _, v := range selected {
-		sum += v
+	for i := range dice {
+		dice[i].Dropped = true
 	}
-
-	// Output the result
-	op := ""
-	if e.KeepHigh {
-		if e.KeepLeft {
-			op = "kh"
-		}
-	} else {
-		if e.KeepLeft {
-			op = "kl"
-		}
+	selected := make([]int, len(keptOrder))
+	sum := 0
+	for i, idx := range keptOrder {
+		dice[idx].Dropped = false
+		selected[i] = dice[idx].Value
+		sum += dice[idx].Value
 	}
 
 	// 使用统一的输出格式
-	exprStr := fmt.Sprintf("%s%s%d", formatExpr(e.Expr), op, count)
-	fmt.Fprintln(os.Stdout, formatDiceOutput(exprStr, selected, sum))
+	ctx.addDice(dice, formatDiceOutput(ExprString(e), selected, sum))
 
 	return sum
 }
 
-// 添加一个辅助函数用于获取原始表达式
-func formatExpr(expr Expr) string {
-	switch e := expr.(type) {
-	case *DiceExpr:
-		count, _ := toInt(e.Count.Evaluate())
-		sides, _ := toInt(e.Sides.Evaluate())
-		return fmt.Sprintf("%dd%d", count, sides)
-	case *ArrayExpr:
-		return "array"
-	default:
-		return "expr"
-	}
-}
-
 // MaxMinExpr represents max/min constraints
 type MaxMinExpr struct {
+	Node
 	Expr  Expr
 	Limit Expr
 	IsMax bool // true for max, false for min
 }
 
-func (e *MaxMinExpr) Evaluate() interface{} {
-	val := e.Expr.Evaluate().(int)
-	limit := e.Limit.Evaluate().(int)
-
-	op := "max"
-	if !e.IsMax {
-		op = "min"
-	}
+func (e *MaxMinExpr) Evaluate(ctx *Context) interface{} {
+	val := ctx.evalInt(e.Expr)
+	limit := ctx.evalInt(e.Limit)
 
 	result := val
 	if e.IsMax && val > limit {
@@ -500,9 +500,6 @@ func (e *MaxMinExpr) Evaluate() interface{} {
 		result = limit
 	}
 
-	// 使用统一的输出格式
-	fmt.Fprintln(os.Stdout, fmt.Sprintf("%d %s %d = %d", val, op, limit, result))
-
 	return result
 }
 
@@ -512,15 +509,15 @@ type SliceExpr struct {
 	SliceSpec Expr
 }
 
-func (e *SliceExpr) Evaluate() interface{} {
+func (e *SliceExpr) Evaluate(ctx *Context) interface{} {
 	var array []int
 
 	// Try to get multiple values
 	if multiExpr, ok := e.Array.(MultiValueExpr); ok {
-		array = multiExpr.EvaluateMulti()
+		array = multiExpr.EvaluateMulti(ctx)
 	} else {
 		// Treat as a single value
-		array = []int{e.Array.Evaluate().(int)}
+		array = []int{ctx.evalInt(e.Array)}
 	}
 
 	var start, end, step int
@@ -535,7 +532,7 @@ func (e *SliceExpr) Evaluate() interface{} {
 		}
 		return 0
 	case *ArrayExpr:
-		elems := spec.EvaluateMulti()
+		elems := spec.EvaluateMulti(ctx)
 		if len(elems) == 1 {
 			// Single index
 			index := elems[0]
@@ -556,7 +553,7 @@ func (e *SliceExpr) Evaluate() interface{} {
 		}
 	default:
 		// Default to a single index
-		index := e.SliceSpec.Evaluate().(int)
+		index := ctx.evalInt(e.SliceSpec)
 		if index >= 1 && index <= len(array) {
 			return array[index-1]
 		}
@@ -586,12 +583,12 @@ func (e *SliceExpr) Evaluate() interface{} {
 	}
 }
 
-func (e *SliceExpr) EvaluateMulti() []int {
-	result := e.Evaluate()
+func (e *SliceExpr) EvaluateMulti(ctx *Context) []int {
+	result := ctx.eval(e)
 	if arr, ok := result.(*ArrayExpr); ok {
-		return arr.EvaluateMulti()
+		return arr.EvaluateMulti(ctx)
 	}
-	return []int{result.(int)}
+	return []int{ctx.mustInt(result)}
 }
 
 // ProjectionExpr represents the tp operator
@@ -599,10 +596,10 @@ type ProjectionExpr struct {
 	Expr Expr
 }
 
-func (e *ProjectionExpr) Evaluate() interface{} {
+func (e *ProjectionExpr) Evaluate(ctx *Context) interface{} {
 	// Forced projection to array type
 	if multiExpr, ok := e.Expr.(MultiValueExpr); ok {
-		values := multiExpr.EvaluateMulti()
+		values := multiExpr.EvaluateMulti(ctx)
 		return &ArrayExpr{
 			Elements: intSliceToExprSlice(values),
 		}
@@ -611,36 +608,35 @@ func (e *ProjectionExpr) Evaluate() interface{} {
 	// Otherwise create a single-element array
 	return &ArrayExpr{
 		Elements: []Expr{
-			&NumberExpr{Value: e.Expr.Evaluate().(int)},
+			&NumberExpr{Value: ctx.evalInt(e.Expr)},
 		},
 	}
 }
 
-func (e *ProjectionExpr) EvaluateMulti() []int {
+func (e *ProjectionExpr) EvaluateMulti(ctx *Context) []int {
 	if multiExpr, ok := e.Expr.(MultiValueExpr); ok {
-		return multiExpr.EvaluateMulti()
+		return multiExpr.EvaluateMulti(ctx)
 	}
-	return []int{e.Expr.Evaluate().(int)}
+	return []int{ctx.evalInt(e.Expr)}
 }
 
 // BitwiseExpr represents the &/| operators
 type BitwiseExpr struct {
+	Node
 	Left  Expr
 	Right Expr
 	IsAnd bool
 }
 
-func (e *BitwiseExpr) Evaluate() interface{} {
-	left := e.Left.Evaluate().(int)
-	right := e.Right.Evaluate().(int)
+func (e *BitwiseExpr) Evaluate(ctx *Context) interface{} {
+	left := ctx.evalInt(e.Left)
+	right := ctx.evalInt(e.Right)
 
 	var result int
 	if e.IsAnd {
 		result = left & right
-		fmt.Printf("%d & %d = %d\n", left, right, result)
 	} else {
 		result = left | right
-		fmt.Printf("%d | %d = %d\n", left, right, result)
 	}
 
 	return result
@@ -648,22 +644,21 @@ func (e *BitwiseExpr) Evaluate() interface{} {
 
 // CompareExpr represents the >/< operators
 type CompareExpr struct {
+	Node
 	Left      Expr
 	Right     Expr
 	IsGreater bool
 }
 
-func (e *CompareExpr) Evaluate() interface{} {
-	left := e.Left.Evaluate().(int)
-	right := e.Right.Evaluate().(int)
+func (e *CompareExpr) Evaluate(ctx *Context) interface{} {
+	left := ctx.evalInt(e.Left)
+	right := ctx.evalInt(e.Right)
 
 	var result bool
 	if e.IsGreater {
 		result = left > right
-		fmt.Printf("%d > %d = %t\n", left, right, result)
 	} else {
 		result = left < right
-		fmt.Printf("%d < %d = %t\n", left, right, result)
 	}
 
 	if result {
@@ -679,8 +674,8 @@ type TernaryExpr struct {
 	FalseExpr Expr
 }
 
-func (e *TernaryExpr) Evaluate() interface{} {
-	condValue := e.Condition.Evaluate()
+func (e *TernaryExpr) Evaluate(ctx *Context) interface{} {
+	condValue := ctx.eval(e.Condition)
 
 	var result bool
 	switch v := condValue.(type) {
@@ -693,9 +688,9 @@ func (e *TernaryExpr) Evaluate() interface{} {
 	}
 
 	if result {
-		return e.TrueExpr.Evaluate()
+		return ctx.eval(e.TrueExpr)
 	} else {
-		return e.FalseExpr.Evaluate()
+		return ctx.eval(e.FalseExpr)
 	}
 }
 
@@ -721,18 +716,18 @@ func intSliceToExprSlice(ints []int) []Expr {
 }
 
 type Expr interface {
-	Evaluate() interface{}
+	Evaluate(ctx *Context) interface{}
 }
 
 type Stmt interface {
-	Evaluate() interface{}
+	Evaluate(ctx *Context) interface{}
 }
 
 type NumberExpr struct {
 	Value int
 }
 
-func (e *NumberExpr) Evaluate() interface{} {
+func (e *NumberExpr) Evaluate(ctx *Context) interface{} {
 	return e.Value
 }
 
@@ -740,20 +735,66 @@ type ExprListStmt struct {
 	Exprs []Expr
 }
 
+// RepeatBlockStmt 将语句块独立重复求值 N 次，例如 6#3d6
 type RepeatBlockStmt struct {
+	Node
 	Count Expr
 	Block []Stmt
 }
 
+// Evaluate 返回每一次的结果，求值树中每一次对应 repeat 节点下的一个 iteration 节点
+func (s *RepeatBlockStmt) Evaluate(ctx *Context) interface{} {
+	node := ctx.push("repeat", ExprString(s))
+	node.Pos = s.Pos
+
+	count := ctx.evalInt(s.Count)
+	if count < 1 {
+		ctx.fail(ErrInvalidRepeat, "%d", count)
+	}
+	if count > ctx.maxRepeat() {
+		ctx.fail(ErrIterationLimit, "%d", ctx.maxRepeat())
+	}
+
+	values := make([]interface{}, count)
+	for i := range values {
+		iteration := ctx.push("iteration", blockString(s.Block))
+		var value interface{}
+		for _, stmt := range s.Block {
+			value = stmt.Evaluate(ctx)
+		}
+		ctx.pop()
+
+		iteration.Value = traceValue(value)
+		values[i] = value
+	}
+
+	ctx.pop()
+
+	node.Value = traceValue(values)
+	return values
+}
+
+// blockString 将语句块还原为表达式文本
+func blockString(block []Stmt) string {
+	parts := make([]string, len(block))
+	for i, stmt := range block {
+		if exprStmt, ok := stmt.(*ExprStmt); ok {
+			parts[i] = ExprString(exprStmt.Expr)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
 type BinaryExpr struct {
+	Node
 	Left  Expr
 	Op    int
 	Right Expr
 }
 
-func (e *BinaryExpr) Evaluate() interface{} {
-	left := e.Left.Evaluate()
-	right := e.Right.Evaluate()
+func (e *BinaryExpr) Evaluate(ctx *Context) interface{} {
+	left := ctx.eval(e.Left)
+	right := ctx.eval(e.Right)
 
 	switch e.Op {
 	case ADD:
@@ -762,40 +803,40 @@ func (e *BinaryExpr) Evaluate() interface{} {
 				return lStr + rStr
 			}
 		}
-		return left.(int) + right.(int)
+		return ctx.mustInt(left) + ctx.mustInt(right)
 	case SUB:
 		if lStr, ok := left.(string); ok {
 			if rStr, ok := right.(string); ok {
 				return strings.Replace(lStr, rStr, "", 1)
 			}
 		}
-		return left.(int) - right.(int)
+		return ctx.mustInt(left) - ctx.mustInt(right)
 	case MUL:
 		if lStr, ok := left.(string); ok {
 			if rStr, ok := right.(string); ok {
 				return longestCommonSubstring(lStr, rStr)
 			}
 		}
-		return left.(int) * right.(int)
+		return ctx.mustInt(left) * ctx.mustInt(right)
 	case DIV:
 		if lStr, ok := left.(string); ok {
 			if rStr, ok := right.(string); ok {
 				return strings.ReplaceAll(lStr, rStr, "")
 			}
 		}
-		if right.(int) == 0 {
-			fmt.Println("Division by zero")
-			return 0
+		divisor := ctx.mustInt(right)
+		if divisor == 0 {
+			ctx.fail(ErrDivisionByZero, "")
 		}
-		return left.(int) / right.(int)
+		return ctx.mustInt(left) / divisor
 	case MOD:
-		if right.(int) == 0 {
-			fmt.Println("Modulo by zero")
-			return 0
+		divisor := ctx.mustInt(right)
+		if divisor == 0 {
+			ctx.fail(ErrDivisionByZero, "")
 		}
-		return left.(int) % right.(int)
+		return ctx.mustInt(left) % divisor
 	case CIRCUMFLEX:
-		return int(math.Pow(float64(left.(int)), float64(right.(int))))
+		return int(math.Pow(float64(ctx.mustInt(left)), float64(ctx.mustInt(right))))
 	}
 	return 0
 }
@@ -830,8 +871,8 @@ type UnaryExpr struct {
 	Expr Expr
 }
 
-func (e *UnaryExpr) Evaluate() interface{} {
-	value := e.Expr.Evaluate().(int)
+func (e *UnaryExpr) Evaluate(ctx *Context) interface{} {
+	value := ctx.evalInt(e.Expr)
 	switch e.Op {
 	case SUB:
 		return -value
@@ -841,73 +882,97 @@ func (e *UnaryExpr) Evaluate() interface{} {
 
 // DiceExpr represents a standard dice roll (e.g., 3d6)
 type DiceExpr struct {
+	Node
 	Count   Expr
 	Sides   Expr
 	Drop    Expr
 	Keep    Expr
-	process string // 保存投掷过程
-	rolls   []int  // 保存骰子结果
-}
-
-func (d *DiceExpr) GetProcess() string {
-	return d.process
+	Explode *DiceExplode // 爆炸骰 !、!!、!p
+	Reroll  *DiceReroll  // 重骰 r、ro
+	Success *DiceCompare // 成功计数条件，例如 >=5
+	Failure *DiceCompare // 失败计数条件，例如 f1
 }
 
-func (d *DiceExpr) Evaluate() interface{} {
-	countVal := EvaluateToInt(d.Count)
-	sidesVal := EvaluateToInt(d.Sides)
-
-	// 安全检查
-	if countVal <= 0 || countVal > MAX_ROLLS {
-		return 0
-	}
-	if sidesVal < MIN_DICE_SIDES || sidesVal > MAX_DICE_SIDES {
+func (d *DiceExpr) Evaluate(ctx *Context) interface{} {
+	dice, rules := d.roll(ctx)
+	if dice == nil {
 		return 0
 	}
+	total := rules.total(dice)
 
-	// 投掷骰子
-	d.rolls = make([]int, countVal)
-	sum := 0
-	for i := 0; i < countVal; i++ {
-		roll := rand.Intn(sidesVal) + 1
-		d.rolls[i] = roll
-		sum += roll
+	// 记录投掷过程
+	if d.hasModifiers() {
+		ctx.addDice(dice, fmt.Sprintf("%s = %s = %d", ExprString(d), formatDice(dice, rules.mode), total))
+	} else {
+		rolls := make([]int, len(dice))
+		for i, die := range dice {
+			rolls[i] = die.Value
+		}
+		ctx.addDice(dice, fmt.Sprintf("%dd%d = %s = %d", len(dice), dice[0].Sides, formatRollsCompact(rolls), total))
 	}
 
-	// 记录投掷过程
-	d.process = fmt.Sprintf("%dd%d = %s = %d", countVal, sidesVal, formatRollsCompact(d.rolls), sum)
+	return total
+}
 
-	return sum
+func (d *DiceExpr) EvaluateMulti(ctx *Context) []int {
+	dice, _ := d.roll(ctx)
+	if dice == nil {
+		return []int{0}
+	}
 
+	var rolls []int
+	for _, die := range dice {
+		if !die.Dropped {
+			rolls = append(rolls, die.Value)
+		}
+	}
+	return rolls
 }
 
-func (d *DiceExpr) EvaluateMulti() []int {
-	// 如果 Evaluate 已经被调用并生成了结果
-	if d.rolls != nil {
-		return d.rolls
+// roll 计算个数和面数并掷骰，应用重骰、爆炸并标记成功失败，个数为零时返回 nil，为负数时报错
+func (d *DiceExpr) roll(ctx *Context) ([]Die, *diceRules) {
+	count := ctx.evalInt(d.Count)
+	if count < 0 {
+		ctx.fail(ErrInvalidCount, "%d", count)
+	}
+	if count == 0 {
+		return nil, nil
 	}
+	if ctx.DiceScale > 1 {
+		count *= ctx.DiceScale
+	}
+	checkCount(ctx, count)
 
-	// 否则重新计算
-	count := EvaluateToInt(d.Count)
-	if count > MAX_ROLLS {
-		fmt.Println(fmt.Sprintf("Exceeded maximum rolls: %d", MAX_ROLLS))
-		return []int{0}
+	sides := ctx.evalInt(d.Sides)
+	checkSides(ctx, sides)
+
+	rules := d.rules(ctx, sides)
+	dice := make([]Die, 0, count)
+	for i := 0; i < count; i++ {
+		dice = append(dice, rules.rollDie(ctx)...)
 	}
+	rules.mark(dice)
+	return dice, rules
+}
 
-	sides := EvaluateToInt(d.Sides)
-	if sides < MIN_DICE_SIDES {
-		fmt.Println(fmt.Sprintf("Minimum dice sides: %d", MIN_DICE_SIDES))
-		return []int{0}
-	} else if sides > MAX_DICE_SIDES {
-		fmt.Println(fmt.Sprintf("Exceeded maximum dice sides: %d", MAX_DICE_SIDES))
-		return []int{0}
+// checkCount 检查骰子个数是否在允许范围内
+func checkCount(ctx *Context, count int) {
+	if count < 0 {
+		ctx.fail(ErrInvalidCount, "%d", count)
 	}
+	if count > ctx.maxRolls() {
+		ctx.fail(ErrTooManyDice, "上限为 %d", ctx.maxRolls())
+	}
+}
 
-	d.rolls = make([]int, count)
-	for i := 0; i < count; i++ {
-		d.rolls[i] = rand.Intn(sides) + 1
+// checkSides 检查骰子面数是否在允许范围内
+func checkSides(ctx *Context, sides int) {
+	if sides < MIN_DICE_SIDES {
+		ctx.fail(ErrInvalidSides, "%d", sides)
+	}
+	if sides > ctx.maxSides() {
+		ctx.fail(ErrTooManySides, "上限为 %d", ctx.maxSides())
 	}
-	return d.rolls
 }
 
 // Make DiceExpr implement MultiValueExpr
@@ -919,27 +984,21 @@ type HighestDiceExpr struct {
 	Keep  Expr
 }
 
-func (e *HighestDiceExpr) Evaluate() interface{} {
-	count := e.Count.Evaluate().(int)
-	sides := e.Sides.Evaluate().(int)
-	keep := e.Keep.Evaluate().(int)
+func (e *HighestDiceExpr) Evaluate(ctx *Context) interface{} {
+	count := ctx.evalInt(e.Count)
+	sides := ctx.evalInt(e.Sides)
+	keep := ctx.evalInt(e.Keep)
 
-	if count > MAX_ROLLS {
-		fmt.Println(fmt.Sprintf("Exceeded maximum rolls: %d", MAX_ROLLS))
-		return 0
-	}
-	if sides < MIN_DICE_SIDES || sides > MAX_DICE_SIDES {
-		fmt.Println(fmt.Sprintf("Invalid number of sides: %d", sides))
-		return 0
-	}
+	checkCount(ctx, count)
+	checkSides(ctx, sides)
 	if keep > count {
-		fmt.Println(fmt.Sprintf("Cannot keep more dice than rolled"))
+		ctx.warn("保留的骰子数不能多于掷出的骰子数")
 		return 0
 	}
 
 	rolls := make([]int, count)
 	for i := 0; i < count; i++ {
-		rolls[i] = rand.Intn(sides) + 1
+		rolls[i] = ctx.intn(sides) + 1
 	}
 
 	sort.Sort(sort.Reverse(sort.IntSlice(rolls)))
@@ -950,15 +1009,24 @@ func (e *HighestDiceExpr) Evaluate() interface{} {
 
 	keptRolls := rolls[:keep]
 	discardedRolls := rolls[keep:]
-	allRolls := append(keptRolls, append([]int{-1}, discardedRolls...)...)
-	fmt.Printf("%dd%dh%d = [%s] = [%s] = %d\n",
+	allRolls := append(append([]int{}, keptRolls...), append([]int{-1}, discardedRolls...)...)
+	ctx.addDice(keepDice(rolls, keep, sides), fmt.Sprintf("%dd%dh%d = [%s] = [%s] = %d",
 		count, sides, keep,
 		formatRolls(allRolls),
 		formatRolls(keptRolls),
-		sum)
+		sum))
 	return sum
 }
 
+// keepDice 将排序后的结果转换为骰子列表，前 keep 个保留，其余舍弃
+func keepDice(sorted []int, keep, sides int) []Die {
+	dice := make([]Die, len(sorted))
+	for i, roll := range sorted {
+		dice[i] = Die{Sides: sides, Value: roll, Dropped: i >= keep}
+	}
+	return dice
+}
+
 func formatRolls(rolls []int) string {
 	strRolls := make([]string, len(rolls))
 	for i, roll := range rolls {
@@ -985,27 +1053,21 @@ type LowestDiceExpr struct {
 	Keep  Expr
 }
 
-func (e *LowestDiceExpr) Evaluate() interface{} {
-	count := e.Count.Evaluate().(int)
-	sides := e.Sides.Evaluate().(int)
-	keep := e.Keep.Evaluate().(int)
+func (e *LowestDiceExpr) Evaluate(ctx *Context) interface{} {
+	count := ctx.evalInt(e.Count)
+	sides := ctx.evalInt(e.Sides)
+	keep := ctx.evalInt(e.Keep)
 
-	if count > MAX_ROLLS {
-		fmt.Println(fmt.Sprintf("Exceeded maximum rolls: %d", MAX_ROLLS))
-		return 0
-	}
-	if sides < MIN_DICE_SIDES || sides > MAX_DICE_SIDES {
-		fmt.Println(fmt.Sprintf("Invalid number of sides: %d", sides))
-		return 0
-	}
+	checkCount(ctx, count)
+	checkSides(ctx, sides)
 	if keep > count {
-		fmt.Println(fmt.Sprintf("Cannot keep more dice than rolled"))
+		ctx.warn("保留的骰子数不能多于掷出的骰子数")
 		return 0
 	}
 
 	rolls := make([]int, count)
 	for i := 0; i < count; i++ {
-		rolls[i] = rand.Intn(sides) + 1
+		rolls[i] = ctx.intn(sides) + 1
 	}
 
 	sort.Ints(rolls)
@@ -1016,24 +1078,25 @@ func (e *LowestDiceExpr) Evaluate() interface{} {
 
 	keptRolls := rolls[:keep]
 	discardedRolls := rolls[keep:]
-	allRolls := append(keptRolls, append([]int{-1}, discardedRolls...)...)
-	fmt.Printf("%dd%dl%d = [%s] = [%s] = %d\n",
+	allRolls := append(append([]int{}, keptRolls...), append([]int{-1}, discardedRolls...)...)
+	ctx.addDice(keepDice(rolls, keep, sides), fmt.Sprintf("%dd%dl%d = [%s] = [%s] = %d",
 		count, sides, keep,
 		formatRolls(allRolls),
 		formatRolls(keptRolls),
-		sum)
+		sum))
 	return sum
 }
 
 type ComparisonExpr struct {
+	Node
 	Left  Expr
 	Op    int
 	Right Expr
 }
 
-func (e *ComparisonExpr) Evaluate() interface{} {
-	left := e.Left.Evaluate().(int)
-	right := e.Right.Evaluate().(int)
+func (e *ComparisonExpr) Evaluate(ctx *Context) interface{} {
+	left := ctx.evalInt(e.Left)
+	right := ctx.evalInt(e.Right)
 
 	switch e.Op {
 	case EQ:
@@ -1056,23 +1119,8 @@ type ExprStmt struct {
 	Expr Expr
 }
 
-func (e *ExprStmt) Evaluate() interface{} {
-	return e.Expr.Evaluate()
-}
-
-func (e *ExprStmt) GetProcess() string {
-	// 尝试获取骰子表达式的过程
-	switch expr := e.Expr.(type) {
-	case *DiceExpr:
-		return expr.GetProcess()
-	// 为其他骰子表达式类型添加 case
-	// case *FateDiceExpr:
-	//     return expr.GetProcess()
-	// ... 其他类型
-	default:
-		// 对于不是骰子表达式的情况，返回结果的字符串表示
-		return fmt.Sprintf("%v", e.Expr.Evaluate())
-	}
+func (e *ExprStmt) Evaluate(ctx *Context) interface{} {
+	return ctx.eval(e.Expr)
 }
 
 type AssignStmt struct {
@@ -1080,27 +1128,25 @@ type AssignStmt struct {
 	Value Expr
 }
 
-func (s *AssignStmt) Evaluate() interface{} {
-	value := s.Value.Evaluate()
-	variables[s.Name] = value
-	fmt.Printf("%s = %v\n", s.Name, value)
+func (s *AssignStmt) Evaluate(ctx *Context) interface{} {
+	value := ctx.eval(s.Value)
+	ctx.Variables[s.Name] = value
 	return value
 }
 
 type IdentExpr struct {
+	Node
 	Name string
 }
 
-func (e *IdentExpr) Evaluate() interface{} {
-	if value, ok := variables[e.Name]; ok {
+func (e *IdentExpr) Evaluate(ctx *Context) interface{} {
+	if value, ok := ctx.Variables[e.Name]; ok {
 		return value
 	}
-	fmt.Println(fmt.Sprintf("Undefined variable: %s", e.Name))
-	return 0
+	ctx.fail(ErrUndefinedVariable, "%s", e.Name)
+	return nil
 }
 
-var variables = make(map[string]interface{})
-
 // toInt 尝试将 interface{} 值转换为 int
 func toInt(val interface{}) (int, bool) {
 	switch v := val.(type) {
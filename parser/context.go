@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"fmt"
+	"island/rng"
+)
+
+// Context 表达式求值上下文，保存变量、随机数来源和本次求值的求值树
+// 每次求值应使用各自的上下文，同一个上下文不能被多个 goroutine 同时使用
+type Context struct {
+	Variables map[string]interface{}
+	Rand      rng.Source   // 掷骰使用的随机数来源
+	DiceScale int          // 大于 1 时普通骰子的个数乘以此值，例如 DnD 重击时伤害骰翻倍
+	MaxRolls  int          // 单个骰子表达式的骰子个数上限，为 0 时使用 MAX_ROLLS
+	MaxSides  int          // 骰子面数上限，为 0 时使用 MAX_DICE_SIDES
+	MaxRepeat int          // N# 重复掷骰的次数上限，为 0 时使用 MAX_ITERATIONS
+	stack     []*TraceNode // 正在求值的节点，栈底为根节点
+	warnings  []string
+}
+
+// NewContext 创建使用密码学安全随机数的求值上下文
+func NewContext() *Context {
+	return NewContextWithSource(rng.NewCrypto())
+}
+
+// NewContextWithSource 创建使用指定随机数来源的求值上下文
+func NewContextWithSource(source rng.Source) *Context {
+	return &Context{
+		Variables: make(map[string]interface{}),
+		Rand:      source,
+	}
+}
+
+// Result 一次求值的结果
+type Result struct {
+	Value    interface{} // 计算结果
+	Process  string      // 投掷过程
+	Trace    *TraceNode  // 求值树
+	Warnings []string    // 求值时的警告
+	Repeats  []*Result   // 使用 N# 重复掷骰时每一次的结果和过程
+}
+
+// Eval 解析并在当前上下文中计算一条骰子表达式
+func (ctx *Context) Eval(input string) (*Result, error) {
+	program, err := ParseProgram(input)
+	if err != nil {
+		return nil, err
+	}
+	return program.Evaluate(ctx)
+}
+
+// reset 开始一次新的求值，返回求值树的根节点
+func (ctx *Context) reset(source string) *TraceNode {
+	root := &TraceNode{Kind: "program", Expr: source}
+	ctx.stack = []*TraceNode{root}
+	ctx.warnings = nil
+	return root
+}
+
+// eval 计算子表达式并在求值树中记录对应的节点
+func (ctx *Context) eval(expr Expr) interface{} {
+	// 常数不单独成为节点，避免求值树过于琐碎
+	if num, ok := expr.(*NumberExpr); ok {
+		return num.Value
+	}
+
+	node := ctx.push(exprKind(expr), ExprString(expr))
+	if p, ok := expr.(positioned); ok {
+		node.Pos = p.Position()
+	}
+	value := expr.Evaluate(ctx)
+	ctx.pop()
+
+	node.Value = traceValue(value)
+	return value
+}
+
+// push 在正在求值的节点下创建子节点，并使其成为正在求值的节点
+func (ctx *Context) push(kind, expr string) *TraceNode {
+	node := &TraceNode{Kind: kind, Expr: expr}
+	if parent := ctx.current(); parent != nil {
+		parent.Children = append(parent.Children, node)
+	}
+	ctx.stack = append(ctx.stack, node)
+	return node
+}
+
+// pop 结束正在求值的节点
+func (ctx *Context) pop() {
+	ctx.stack = ctx.stack[:len(ctx.stack)-1]
+}
+
+// maxRolls 返回本次求值的骰子个数上限
+func (ctx *Context) maxRolls() int {
+	if ctx.MaxRolls > 0 {
+		return ctx.MaxRolls
+	}
+	return MAX_ROLLS
+}
+
+// maxSides 返回本次求值的骰子面数上限
+func (ctx *Context) maxSides() int {
+	if ctx.MaxSides > 0 {
+		return ctx.MaxSides
+	}
+	return MAX_DICE_SIDES
+}
+
+// maxRepeat 返回本次求值的重复掷骰次数上限
+func (ctx *Context) maxRepeat() int {
+	if ctx.MaxRepeat > 0 {
+		return ctx.MaxRepeat
+	}
+	return MAX_ITERATIONS
+}
+
+// intn 从上下文的随机数来源抽取 [0, n) 范围内的整数
+func (ctx *Context) intn(n int) int {
+	return ctx.Rand.Intn(n)
+}
+
+// current 返回正在求值的节点
+func (ctx *Context) current() *TraceNode {
+	if len(ctx.stack) == 0 {
+		return nil
+	}
+	return ctx.stack[len(ctx.stack)-1]
+}
+
+// addDice 为正在求值的节点记录掷出的骰子和投掷过程
+func (ctx *Context) addDice(dice []Die, detail string) {
+	if node := ctx.current(); node != nil {
+		node.Dice = append(node.Dice, dice...)
+		node.Detail = detail
+	}
+}
+
+// warn 记录一条警告，例如超出骰子数量上限
+func (ctx *Context) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	ctx.warnings = append(ctx.warnings, msg)
+	if node := ctx.current(); node != nil {
+		node.Warnings = append(node.Warnings, msg)
+	}
+}
@@ -0,0 +1,671 @@
+package parser
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrNoDistribution   = errors.New("无法精确计算分布")
+	ErrDistTooComplex   = errors.New("分布过于复杂")
+	MAX_DIST_RANGE      = 1000000  // 分布取值范围的上限
+	MAX_DIST_OPERATIONS = 50000000 // 一次分布计算的计算量上限
+)
+
+// Distribution 整数随机变量的精确分布，Probs[i] 为取值 Min+i 的概率
+type Distribution struct {
+	Min   int
+	Probs []float64
+}
+
+// DistPoint 分布中的一个取值
+type DistPoint struct {
+	Value int     `json:"value"`
+	P     float64 `json:"p"`   // 概率
+	CDF   float64 `json:"cdf"` // 累积概率 P(X <= Value)
+}
+
+// AnalyzeDistribution 解析表达式并计算其结果的精确分布
+func AnalyzeDistribution(input string) (*Distribution, error) {
+	program, err := ParseProgram(input)
+	if err != nil {
+		return nil, err
+	}
+	return program.Distribution()
+}
+
+// Distribution 计算程序结果的精确分布，只支持单条表达式
+func (p *Program) Distribution() (*Distribution, error) {
+	if len(p.Stmts) != 1 {
+		return nil, &EvalError{Err: ErrNoDistribution, Detail: "只支持单条表达式"}
+	}
+	stmt, ok := p.Stmts[0].(*ExprStmt)
+	if !ok {
+		return nil, &EvalError{Err: ErrNoDistribution, Detail: "不支持重复掷骰"}
+	}
+	s := &distState{ops: MAX_DIST_OPERATIONS}
+	return s.distOf(stmt.Expr)
+}
+
+// distState 一次分布计算的状态，记录剩余的计算量
+type distState struct {
+	ops int
+}
+
+// charge 扣除 n 次运算的计算量，耗尽时返回 ErrDistTooComplex
+func (s *distState) charge(expr Expr, n int) error {
+	s.ops -= n
+	if s.ops < 0 {
+		return distError(expr, ErrDistTooComplex)
+	}
+	return nil
+}
+
+// pointDist 只有一个取值的分布
+func pointDist(v int) *Distribution {
+	return &Distribution{Min: v, Probs: []float64{1}}
+}
+
+// uniformDist 在 [lo, hi] 上均匀分布
+func uniformDist(lo, hi int) *Distribution {
+	d := &Distribution{Min: lo, Probs: make([]float64, hi-lo+1)}
+	for i := range d.Probs {
+		d.Probs[i] = 1 / float64(len(d.Probs))
+	}
+	return d
+}
+
+// Max 返回最大可能取值
+func (d *Distribution) Max() int {
+	return d.Min + len(d.Probs) - 1
+}
+
+// P 返回取值为 v 的概率
+func (d *Distribution) P(v int) float64 {
+	if v < d.Min || v > d.Max() {
+		return 0
+	}
+	return d.Probs[v-d.Min]
+}
+
+// Mean 返回期望
+func (d *Distribution) Mean() float64 {
+	mean := 0.0
+	for i, p := range d.Probs {
+		mean += float64(d.Min+i) * p
+	}
+	return mean
+}
+
+// StdDev 返回标准差
+func (d *Distribution) StdDev() float64 {
+	mean := d.Mean()
+	variance := 0.0
+	for i, p := range d.Probs {
+		diff := float64(d.Min+i) - mean
+		variance += diff * diff * p
+	}
+	return math.Sqrt(variance)
+}
+
+// Points 返回所有概率不为零的取值及其累积概率
+func (d *Distribution) Points() []DistPoint {
+	var points []DistPoint
+	cdf := 0.0
+	for i, p := range d.Probs {
+		cdf += p
+		if p > 0 {
+			points = append(points, DistPoint{Value: d.Min + i, P: p, CDF: math.Min(cdf, 1)})
+		}
+	}
+	return points
+}
+
+// trim 去掉两端概率为零的取值
+func (d *Distribution) trim() *Distribution {
+	lo, hi := 0, len(d.Probs)-1
+	for lo < hi && d.Probs[lo] == 0 {
+		lo++
+	}
+	for hi > lo && d.Probs[hi] == 0 {
+		hi--
+	}
+	return &Distribution{Min: d.Min + lo, Probs: d.Probs[lo : hi+1]}
+}
+
+// builder 按取值累加概率，构造新的分布
+type builder map[int]float64
+
+func (b builder) build(expr Expr) (*Distribution, error) {
+	lo, hi := math.MaxInt, math.MinInt
+	for v := range b {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	if lo > hi {
+		return pointDist(0), nil
+	}
+	if hi-lo >= MAX_DIST_RANGE {
+		return nil, distError(expr, ErrDistTooComplex)
+	}
+	d := &Distribution{Min: lo, Probs: make([]float64, hi-lo+1)}
+	for v, p := range b {
+		d.Probs[v-lo] += p
+	}
+	return d.trim(), nil
+}
+
+// combine 组合两个独立随机变量，op 返回 false 表示该组合无法计算（例如除数为零）
+func (s *distState) combine(expr Expr, a, b *Distribution, op func(x, y int) (int, bool)) (*Distribution, error) {
+	if err := s.charge(expr, len(a.Probs)*len(b.Probs)); err != nil {
+		return nil, err
+	}
+	result := builder{}
+	for i, pa := range a.Probs {
+		if pa == 0 {
+			continue
+		}
+		for j, pb := range b.Probs {
+			if pb == 0 {
+				continue
+			}
+			v, ok := op(a.Min+i, b.Min+j)
+			if !ok {
+				return nil, distError(expr, ErrDivisionByZero)
+			}
+			result[v] += pa * pb
+		}
+	}
+	return result.build(expr)
+}
+
+// add 计算两个独立随机变量之和的分布（卷积）
+func (s *distState) add(expr Expr, a, b *Distribution) (*Distribution, error) {
+	if err := s.charge(expr, len(a.Probs)*len(b.Probs)); err != nil {
+		return nil, err
+	}
+	d := &Distribution{Min: a.Min + b.Min, Probs: make([]float64, len(a.Probs)+len(b.Probs)-1)}
+	for i, pa := range a.Probs {
+		if pa == 0 {
+			continue
+		}
+		for j, pb := range b.Probs {
+			d.Probs[i+j] += pa * pb
+		}
+	}
+	return d, nil
+}
+
+// sumOf 计算 n 个独立同分布随机变量之和的分布，使用倍增减少卷积次数
+func (s *distState) sumOf(expr Expr, d *Distribution, n int) (*Distribution, error) {
+	if n == 0 {
+		return pointDist(0), nil
+	}
+	if (len(d.Probs)-1)*n >= MAX_DIST_RANGE {
+		return nil, distError(expr, ErrDistTooComplex)
+	}
+	result := pointDist(0)
+	var err error
+	for base := d; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			if result, err = s.add(expr, result, base); err != nil {
+				return nil, err
+			}
+		}
+		if n > 1 {
+			if base, err = s.add(expr, base, base); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// mixture 根据 cond 的每个取值选择分布并按概率加权合并
+func mixture(expr Expr, cond *Distribution, choose func(v int) (*Distribution, error)) (*Distribution, error) {
+	result := builder{}
+	for i, p := range cond.Probs {
+		if p == 0 {
+			continue
+		}
+		d, err := choose(cond.Min + i)
+		if err != nil {
+			return nil, err
+		}
+		for j, q := range d.Probs {
+			result[d.Min+j] += p * q
+		}
+	}
+	return result.build(expr)
+}
+
+// distError 构造带位置的分布计算错误
+func distError(expr Expr, err error) error {
+	evalErr := &EvalError{Err: err, Detail: ExprString(expr)}
+	if p, ok := expr.(positioned); ok {
+		evalErr.Pos = p.Position()
+	}
+	return evalErr
+}
+
+// checkDistCount 骰子数量为负数时返回与求值相同的错误
+func checkDistCount(expr Expr, count int) error {
+	if count >= 0 {
+		return nil
+	}
+	evalErr := &EvalError{Err: ErrInvalidCount, Detail: strconv.Itoa(count)}
+	if p, ok := expr.(positioned); ok {
+		evalErr.Pos = p.Position()
+	}
+	return evalErr
+}
+
+// constant 计算必须为常数的子表达式，例如保留的骰子数
+func (s *distState) constant(expr Expr) (int, error) {
+	d, err := s.distOf(expr)
+	if err != nil {
+		return 0, err
+	}
+	if len(d.Probs) != 1 {
+		return 0, &EvalError{Err: ErrNoDistribution, Detail: ExprString(expr) + " 不是常数"}
+	}
+	return d.Min, nil
+}
+
+// distOf 递归计算表达式的精确分布
+func (s *distState) distOf(expr Expr) (*Distribution, error) {
+	switch e := expr.(type) {
+	case *NumberExpr:
+		return pointDist(e.Value), nil
+	case *UnaryExpr:
+		d, err := s.distOf(e.Expr)
+		if err != nil || e.Op != SUB {
+			return d, err
+		}
+		return s.combine(e, pointDist(0), d, func(x, y int) (int, bool) { return x - y, true })
+	case *BinaryExpr:
+		return s.binaryDist(e)
+	case *DiceExpr:
+		return s.diceDist(e)
+	case *FateDiceExpr:
+		count := 4
+		if e.Count != nil {
+			var err error
+			if count, err = s.constant(e.Count); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkDistCount(e, count); err != nil {
+			return nil, err
+		}
+		return s.sumOf(e, uniformDist(-1, 1), count)
+	case *PenaltyBonusDiceExpr:
+		return s.penaltyBonusDist(e)
+	case *HighLowSelectExpr:
+		return s.selectDist(e)
+	case *MaxMinExpr:
+		return s.pairDist(e, e.Expr, e.Limit, func(x, y int) (int, bool) {
+			if e.IsMax {
+				return min(x, y), true
+			}
+			return max(x, y), true
+		})
+	case *CompareExpr:
+		return s.pairDist(e, e.Left, e.Right, func(x, y int) (int, bool) {
+			return boolInt(e.IsGreater && x > y || !e.IsGreater && x < y), true
+		})
+	case *ComparisonExpr:
+		return s.pairDist(e, e.Left, e.Right, func(x, y int) (int, bool) {
+			return boolInt(compareInts(e.Op, x, y)), true
+		})
+	case *BitwiseExpr:
+		return s.pairDist(e, e.Left, e.Right, func(x, y int) (int, bool) {
+			if e.IsAnd {
+				return x & y, true
+			}
+			return x | y, true
+		})
+	case *TernaryExpr:
+		cond, err := s.distOf(e.Condition)
+		if err != nil {
+			return nil, err
+		}
+		whenTrue, err := s.distOf(e.TrueExpr)
+		if err != nil {
+			return nil, err
+		}
+		whenFalse, err := s.distOf(e.FalseExpr)
+		if err != nil {
+			return nil, err
+		}
+		return mixture(e, cond, func(v int) (*Distribution, error) {
+			if v != 0 {
+				return whenTrue, nil
+			}
+			return whenFalse, nil
+		})
+	}
+	return nil, distError(expr, ErrNoDistribution)
+}
+
+// pairDist 组合两个子表达式的分布
+func (s *distState) pairDist(expr, left, right Expr, op func(x, y int) (int, bool)) (*Distribution, error) {
+	a, err := s.distOf(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.distOf(right)
+	if err != nil {
+		return nil, err
+	}
+	return s.combine(expr, a, b, op)
+}
+
+func (s *distState) binaryDist(e *BinaryExpr) (*Distribution, error) {
+	if e.Op == ADD {
+		a, err := s.distOf(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		b, err := s.distOf(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		if len(a.Probs)+len(b.Probs) >= MAX_DIST_RANGE {
+			return nil, distError(e, ErrDistTooComplex)
+		}
+		return s.add(e, a, b)
+	}
+
+	return s.pairDist(e, e.Left, e.Right, func(x, y int) (int, bool) {
+		switch e.Op {
+		case SUB:
+			return x - y, true
+		case MUL:
+			return x * y, true
+		case DIV:
+			if y == 0 {
+				return 0, false
+			}
+			return x / y, true
+		case MOD:
+			if y == 0 {
+				return 0, false
+			}
+			return x % y, true
+		case CIRCUMFLEX:
+			return int(math.Pow(float64(x), float64(y))), true
+		}
+		return 0, true
+	})
+}
+
+// diceDist 计算 NdS 的分布，个数和面数可以是随机的；支持重骰和成功计数，不支持爆炸骰
+func (s *distState) diceDist(e *DiceExpr) (*Distribution, error) {
+	if e.Explode != nil {
+		return nil, &EvalError{Pos: e.Pos, Err: ErrNoDistribution, Detail: "不支持爆炸骰"}
+	}
+	counts, err := s.distOf(e.Count)
+	if err != nil {
+		return nil, err
+	}
+	sidesDist, err := s.distOf(e.Sides)
+	if err != nil {
+		return nil, err
+	}
+
+	return mixture(e, sidesDist, func(sides int) (*Distribution, error) {
+		if sides < MIN_DICE_SIDES {
+			return nil, &EvalError{Pos: e.Pos, Err: ErrInvalidSides, Detail: strconv.Itoa(sides)}
+		}
+		die, err := e.dieDist(s, sides)
+		if err != nil {
+			return nil, err
+		}
+		return mixture(e, counts, func(count int) (*Distribution, error) {
+			if err := checkDistCount(e, count); err != nil {
+				return nil, err
+			}
+			return s.sumOf(e, die, count)
+		})
+	})
+}
+
+// dieDist 计算单个骰子应用重骰和成功计数后的分布
+func (e *DiceExpr) dieDist(s *distState, sides int) (*Distribution, error) {
+	if sides >= MAX_DIST_RANGE {
+		return nil, distError(e, ErrDistTooComplex)
+	}
+	die := uniformDist(1, sides)
+
+	if e.Reroll != nil {
+		test, err := e.Reroll.Point.constant(s)
+		if err != nil {
+			return nil, err
+		}
+		matched := 0
+		for v := 1; v <= sides; v++ {
+			if test.match(v) {
+				matched++
+			}
+		}
+		if matched == sides && !e.Reroll.Once {
+			return nil, &EvalError{Pos: e.Pos, Err: ErrIterationLimit, Detail: "每个点数都需要重骰"}
+		}
+
+		rerolled := float64(matched) / float64(sides)
+		result := builder{}
+		for v := 1; v <= sides; v++ {
+			p := die.P(v)
+			switch {
+			case e.Reroll.Once:
+				// 重骰一次：不重骰的直接保留，需要重骰的再掷一次均匀分布
+				if !test.match(v) {
+					result[v] += p
+				}
+				result[v] += rerolled * p
+			case !test.match(v):
+				// 一直重骰：结果是不满足条件的点数上的均匀分布
+				result[v] += p / (1 - rerolled)
+			}
+		}
+		if die, err = result.build(e); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.Success == nil {
+		return die, nil
+	}
+	success, err := e.Success.constant(s)
+	if err != nil {
+		return nil, err
+	}
+	var failure *diceTest
+	if e.Failure != nil {
+		if failure, err = e.Failure.constant(s); err != nil {
+			return nil, err
+		}
+	}
+
+	counted := builder{}
+	for i, p := range die.Probs {
+		v := die.Min + i
+		switch {
+		case success.match(v):
+			counted[1] += p
+		case failure != nil && failure.match(v):
+			counted[-1] += p
+		default:
+			counted[0] += p
+		}
+	}
+	return counted.build(e)
+}
+
+// constant 计算比较条件中的常数目标值
+func (c *DiceCompare) constant(s *distState) (*diceTest, error) {
+	target, err := s.constant(c.Target)
+	if err != nil {
+		return nil, err
+	}
+	return &diceTest{op: c.Op, target: target}, nil
+}
+
+// selectDist 计算 NdS 保留最高或最低 K 个骰子之和的分布
+// 按点数从高到低（保留最低时从低到高）依次决定有几个骰子掷出该点数，
+// 已决定的骰子中前 K 个被保留，状态为（已决定的骰子数，保留的点数和）
+func (s *distState) selectDist(e *HighLowSelectExpr) (*Distribution, error) {
+	dice, ok := e.Expr.(*DiceExpr)
+	if !ok || dice.hasModifiers() {
+		return nil, distError(e, ErrNoDistribution)
+	}
+	n, err := s.constant(dice.Count)
+	if err != nil {
+		return nil, err
+	}
+	sides, err := s.constant(dice.Sides)
+	if err != nil {
+		return nil, err
+	}
+	keep := 1
+	if e.Count != nil {
+		if keep, err = s.constant(e.Count); err != nil {
+			return nil, err
+		}
+	}
+	// dh/dl 保留排序另一端的骰子，等价于反方向保留
+	high := e.KeepHigh == e.KeepLeft
+	keep = max(0, min(keep, n))
+	if n <= 0 {
+		return pointDist(0), nil
+	}
+	if sides < MIN_DICE_SIDES {
+		return nil, &EvalError{Pos: dice.Pos, Err: ErrInvalidSides, Detail: strconv.Itoa(sides)}
+	}
+	if n > MAX_DIST_OPERATIONS/n/sides/(keep*sides+1) {
+		return nil, distError(e, ErrDistTooComplex)
+	}
+	if err := s.charge(e, n*n*sides*(keep*sides+1)); err != nil {
+		return nil, err
+	}
+
+	// ways[m][t] 为前 m 个骰子保留点数和为 t 的概率
+	maxSum := keep * sides
+	ways := make([][]float64, n+1)
+	for m := range ways {
+		ways[m] = make([]float64, maxSum+1)
+	}
+	ways[0][0] = 1
+	binom := binomials(n)
+	face := 1 / float64(sides)
+
+	for step := 0; step < sides; step++ {
+		v := sides - step
+		if !high {
+			v = step + 1
+		}
+		next := make([][]float64, n+1)
+		for m := range next {
+			next[m] = make([]float64, maxSum+1)
+		}
+		for m := 0; m <= n; m++ {
+			for t, p := range ways[m] {
+				if p == 0 {
+					continue
+				}
+				// 剩余 n-m 个骰子中有 j 个掷出 v
+				for j := 0; m+j <= n; j++ {
+					kept := min(m+j, keep) - min(m, keep)
+					next[m+j][t+kept*v] += p * binom[n-m][j] * math.Pow(face, float64(j))
+				}
+			}
+		}
+		ways = next
+	}
+
+	// 每个骰子都必须恰好落在某个点数上
+	result := &Distribution{Min: 0, Probs: ways[n]}
+	return result.trim(), nil
+}
+
+// penaltyBonusDist 计算 CoC 奖励骰/惩罚骰的分布
+func (s *distState) penaltyBonusDist(e *PenaltyBonusDiceExpr) (*Distribution, error) {
+	count := 1
+	if e.Count != nil {
+		var err error
+		if count, err = s.constant(e.Count); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkDistCount(e, count); err != nil {
+		return nil, err
+	}
+	m := float64(count + 1)
+
+	result := builder{}
+	for units := 0; units <= 9; units++ {
+		// 该个位下十位骰对应的结果从小到大排列，00 为 100
+		values := make([]int, 0, 10)
+		for tens := 0; tens <= 9; tens++ {
+			if tens == 0 && units == 0 {
+				continue
+			}
+			values = append(values, tens*10+units)
+		}
+		if units == 0 {
+			values = append(values, 100)
+		}
+
+		// 奖励骰取最小的结果，惩罚骰取最大的结果
+		for i, v := range values {
+			var p float64
+			if e.IsBonus {
+				p = math.Pow(float64(10-i)/10, m) - math.Pow(float64(9-i)/10, m)
+			} else {
+				p = math.Pow(float64(i+1)/10, m) - math.Pow(float64(i)/10, m)
+			}
+			result[v] += p / 10
+		}
+	}
+	return result.build(e)
+}
+
+// binomials 返回 0..n 的二项式系数表
+func binomials(n int) [][]float64 {
+	c := make([][]float64, n+1)
+	for i := range c {
+		c[i] = make([]float64, i+1)
+		c[i][0], c[i][i] = 1, 1
+		for j := 1; j < i; j++ {
+			c[i][j] = c[i-1][j-1] + c[i-1][j]
+		}
+	}
+	return c
+}
+
+func compareInts(op, x, y int) bool {
+	switch op {
+	case EQ:
+		return x == y
+	case NEQ:
+		return x != y
+	case GT:
+		return x > y
+	case LT:
+		return x < y
+	case GE:
+		return x >= y
+	case LE:
+		return x <= y
+	}
+	return false
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"errors"
+	"island/rng"
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// TestDistributionExact 与手算的概率对比
+func TestDistributionExact(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value int
+		p     float64
+		mean  float64
+	}{
+		{"1d6", 3, 1.0 / 6, 3.5},
+		{"2d6", 7, 6.0 / 36, 7},
+		{"3d6", 10, 27.0 / 216, 10.5},
+		{"2d20kh1", 20, 39.0 / 400, 13.825},
+		{"2d20kl1", 1, 39.0 / 400, 7.175},
+		{"4d6kh3", 18, 21.0 / 1296, 15869.0 / 1296},
+		{"1d20>=11", 1, 0.5, 0.5},
+		{"1d6+1d4-1", 1, 1.0 / 24, 5},
+		{"2*1d6", 12, 1.0 / 6, 7},
+		{"1d6>3?10:0", 10, 0.5, 5},
+		{"5d10>=8", 5, math.Pow(0.3, 5), 1.5},
+		{"1d6ro1", 1, 1.0 / 36, 3.5 + 2.5/6},
+		{"1d6r<3", 3, 0.25, 4.5},
+		{"4df", 4, 1.0 / 81, 0},
+		{"(1d2)d6", 12, 1.0 / 72, 5.25},
+	}
+	for _, tt := range tests {
+		d, err := AnalyzeDistribution(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := d.P(tt.value); !near(got, tt.p) {
+			t.Errorf("%s: P(%d) = %v, want %v", tt.expr, tt.value, got, tt.p)
+		}
+		if got := d.Mean(); !near(got, tt.mean) {
+			t.Errorf("%s: mean = %v, want %v", tt.expr, got, tt.mean)
+		}
+		total := 0.0
+		for _, p := range d.Probs {
+			total += p
+		}
+		if !near(total, 1) {
+			t.Errorf("%s: total probability = %v", tt.expr, total)
+		}
+	}
+
+	d, _ := AnalyzeDistribution("3d6")
+	if got := d.StdDev(); !near(got, math.Sqrt(8.75)) {
+		t.Errorf("3d6 stddev = %v", got)
+	}
+	points := d.Points()
+	if len(points) != 16 || points[0].Value != 3 || !near(points[15].CDF, 1) {
+		t.Errorf("3d6 points = %+v", points)
+	}
+}
+
+// TestDistributionMatchesRolls 抽样结果的均值应接近精确分布的期望，确认两者语义一致
+func TestDistributionMatchesRolls(t *testing.T) {
+	const samples = 20000
+	for _, expr := range []string{"4d6kh3", "3d8kl2", "1b2", "1p1", "3d10>=6f1", "2d6r1", "1d20+5>=15"} {
+		d, err := AnalyzeDistribution(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		ctx := NewContextWithSource(rng.NewSeeded(42))
+		sum := 0.0
+		for i := 0; i < samples; i++ {
+			res, err := ctx.Eval(expr)
+			if err != nil {
+				t.Fatalf("%s: %v", expr, err)
+			}
+			n, _ := toInt(res.Value)
+			sum += float64(n)
+		}
+		mean := sum / samples
+		if diff := math.Abs(mean - d.Mean()); diff > 5*d.StdDev()/math.Sqrt(samples)+1e-9 {
+			t.Errorf("%s: sampled mean %.3f, exact %.3f", expr, mean, d.Mean())
+		}
+	}
+}
+
+func TestDistributionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want error
+	}{
+		{"1d6!", ErrNoDistribution},
+		{"5a10", ErrNoDistribution},
+		{"1d6/(1d2-1)", ErrDivisionByZero},
+		{"1d1000000d1000000", ErrDistTooComplex},
+		{"100d1000", ErrDistTooComplex},
+		{"1000d1000", ErrDistTooComplex},
+		{"1d100d100", ErrDistTooComplex},
+		{"(0-2)d6", ErrInvalidCount},
+		{"(0-1)df", ErrInvalidCount},
+		{"1d6r<7", ErrIterationLimit},
+		{"x+1", ErrNoDistribution},
+	}
+	for _, tt := range tests {
+		_, err := AnalyzeDistribution(tt.expr)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.expr, err, tt.want)
+		}
+	}
+}
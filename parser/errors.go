@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 求值错误的类型，可以用 errors.Is 判断
+var (
+	ErrDivisionByZero    = errors.New("除数为零")
+	ErrTooManyDice       = errors.New("骰子数量过多")
+	ErrTooManySides      = errors.New("骰子面数过多")
+	ErrInvalidSides      = errors.New("骰子面数无效")
+	ErrInvalidCount      = errors.New("骰子数量不能为负数")
+	ErrUndefinedVariable = errors.New("未定义的变量")
+	ErrNotInteger        = errors.New("此处需要整数")
+	ErrIterationLimit    = errors.New("迭代次数超过上限")
+	ErrInvalidRepeat     = errors.New("重复次数必须为正数")
+)
+
+// Node 语法树节点在源表达式中的位置
+type Node struct {
+	Pos int // 从 1 开始的字符序号，0 表示未知
+}
+
+// Position 返回节点的位置
+func (n Node) Position() int {
+	return n.Pos
+}
+
+// positioned 由带位置信息的语法树节点实现
+type positioned interface {
+	Position() int
+}
+
+// EvalError 表达式求值错误，记录出错的位置
+type EvalError struct {
+	Pos    int    // 出错的字符位置，0 表示未知
+	Err    error  // 错误类型，例如 ErrDivisionByZero
+	Detail string // 补充说明，例如变量名或上限
+}
+
+func (e *EvalError) Error() string {
+	msg := e.Err.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Pos > 0 {
+		return fmt.Sprintf("第 %d 个字符: %s", e.Pos, msg)
+	}
+	return msg
+}
+
+// Unwrap 返回错误类型
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// fail 以正在求值的节点位置中止本次求值，由 Program.Evaluate 恢复为返回的错误
+func (ctx *Context) fail(err error, format string, args ...interface{}) {
+	evalErr := &EvalError{Err: err, Pos: ctx.position()}
+	if format != "" {
+		evalErr.Detail = fmt.Sprintf(format, args...)
+	}
+	panic(evalErr)
+}
+
+// position 返回离栈顶最近的带位置节点的位置
+func (ctx *Context) position() int {
+	for i := len(ctx.stack) - 1; i >= 0; i-- {
+		if pos := ctx.stack[i].Pos; pos > 0 {
+			return pos
+		}
+	}
+	return 0
+}
+
+// evalInt 计算需要整数的子表达式，布尔值视为 1 和 0
+func (ctx *Context) evalInt(expr Expr) int {
+	value := ctx.eval(expr)
+	if n, ok := toInt(value); ok {
+		return n
+	}
+	ctx.fail(ErrNotInteger, "%s", ExprString(expr))
+	return 0
+}
+
+// mustInt 将已经算出的值转换为整数
+func (ctx *Context) mustInt(value interface{}) int {
+	if n, ok := toInt(value); ok {
+		return n
+	}
+	ctx.fail(ErrNotInteger, "%s", FormatValue(value))
+	return 0
+}
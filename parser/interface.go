@@ -1,5 +1,10 @@
 package parser
 
+import (
+	"fmt"
+	"strings"
+)
+
 // LexerWrapper 包装 Lexer 并实现 yyLexer 接口
 type LexerWrapper struct {
 	lexer *Lexer
@@ -26,26 +31,112 @@ func NewParser() *yyParserImpl {
 	return &yyParserImpl{}
 }
 
-var lastResult map[string]interface{}
-var lastProcess string // 新增：记录骰子投掷过程
-
-// SetResult 设置最后一次计算的结果
-func SetResult(result interface{}, process string) {
-	lastResult = map[string]interface{}{
-		"结果": result,
-		"过程": process,
-	}
+// programReceiver 由词法分析器实现，用于在语法分析结束时接收语法树
+type programReceiver interface {
+	setProgram(stmts []Stmt)
 }
 
-// GetResult 获取最后一次计算的结果
-func GetResult() map[string]interface{} {
-	return lastResult
+// setProgram 将语法树交给被包装的 Lexer
+func (l *LexerWrapper) setProgram(stmts []Stmt) {
+	l.lexer.setProgram(stmts)
 }
 
 // Parse 函数是 yyParse 的包装器
 func Parse(lexer yyLexer) int {
-	// 重置结果
-	lastResult = nil
-	lastProcess = "" // 重置过程
 	return yyParse(lexer)
 }
+
+// Program 解析后的骰子表达式
+type Program struct {
+	Source string
+	Stmts  []Stmt
+}
+
+// ParseProgram 解析一条骰子表达式，只构建语法树而不求值
+func ParseProgram(input string) (*Program, error) {
+	lexer := NewLexer(input)
+	status := Parse(NewLexerWrapper(lexer))
+	if err := lexer.Err(); err != nil {
+		return nil, err
+	}
+	if status != 0 || lexer.stmts == nil {
+		return nil, fmt.Errorf("无法解析表达式: %s", input)
+	}
+	return &Program{Source: input, Stmts: lexer.stmts}, nil
+}
+
+// Evaluate 在给定上下文中计算表达式，返回本次求值独有的结果
+// 求值失败时返回 *EvalError，例如除数为零或骰子数量过多
+func (p *Program) Evaluate(ctx *Context) (result *Result, err error) {
+	root := ctx.reset(p.Source)
+	defer func() {
+		if r := recover(); r != nil {
+			evalErr, ok := r.(*EvalError)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, evalErr
+		}
+	}()
+
+	var value interface{}
+	var last Stmt
+	for _, stmt := range p.Stmts {
+		if stmt != nil {
+			value = stmt.Evaluate(ctx)
+			last = stmt
+		}
+	}
+	root.Value = traceValue(value)
+
+	result = &Result{
+		Value:    value,
+		Process:  strings.Join(root.Details(), "; "),
+		Trace:    root,
+		Warnings: ctx.warnings,
+	}
+
+	// 重复掷骰时拆分出每一次的结果
+	if _, ok := last.(*RepeatBlockStmt); ok {
+		repeat := root.Children[len(root.Children)-1]
+		values := value.([]interface{})
+		for i, iteration := range repeat.Children {
+			result.Repeats = append(result.Repeats, &Result{
+				Value:   values[i],
+				Process: strings.Join(iteration.Details(), "; "),
+				Trace:   iteration,
+			})
+		}
+	}
+	return result, nil
+}
+
+// Eval 使用新的上下文解析并计算一条骰子表达式
+func Eval(input string) (*Result, error) {
+	return NewContext().Eval(input)
+}
+
+// FormatValue 将计算结果格式化为便于阅读的文本
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "真"
+		}
+		return "假"
+	case *ArrayExpr:
+		// 只格式化已经算好的值，格式化时不能再次掷骰
+		if values, ok := v.values(); ok {
+			return formatRollsCompact(values)
+		}
+		return ExprString(v)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = FormatValue(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
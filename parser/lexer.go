@@ -1,15 +1,19 @@
 package parser
 
 import (
-	"log"
+	"fmt"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
 type Lexer struct {
-	input string
-	pos   int
+	input    string
+	pos      int
+	tokStart int    // 当前记号的起始位置
+	err      error  // 第一个语法错误
+	stmts    []Stmt // 语法分析得到的语句
 }
 
 func NewLexer(input string) *Lexer {
@@ -36,21 +40,34 @@ var keywords = map[string]int{
 	"min": MIN,
 	"kh":  KH,
 	"kl":  KL,
+	"r":   REROLL,
+	"ro":  REROLL_ONCE,
 }
 
+// Lex 返回下一个记号，并在 lval 中记录记号的位置
 func (l *Lexer) Lex(lval *yySymType) int {
+	tok := l.lex(lval)
+	lval.Pos = l.Position()
+	return tok
+}
+
+func (l *Lexer) lex(lval *yySymType) int {
+	// 跳过空格
+	for l.pos < len(l.input) {
+		r, width := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.pos += width
+	}
+
+	l.tokStart = l.pos
 	if l.pos >= len(l.input) {
 		return 0
 	}
 
 	r, width := utf8.DecodeRuneInString(l.input[l.pos:])
 
-	// 处理空格
-	if unicode.IsSpace(r) {
-		l.pos += width
-		return l.Lex(lval)
-	}
-
 	// 处理数字
 	if unicode.IsDigit(r) {
 		return l.lexNumber(lval)
@@ -80,6 +97,12 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		}
 	}
 
+	// 紧跟数字等非字母字符的操作符字母（如 1d100p2 中的 p、3d6max10 中的 max）
+	if tok, n := l.lexOperatorWord(); tok != 0 {
+		l.pos += n
+		return tok
+	}
+
 	switch {
 	case isIdentStart(r):
 		return l.lexIdent(lval)
@@ -159,6 +182,9 @@ func (l *Lexer) Lex(lval *yySymType) int {
 	case r == '%':
 		l.pos += width
 		return MOD
+	case r == '#':
+		l.pos += width
+		return HASH
 	case r == '=':
 		l.pos += width
 		if l.pos < len(l.input) && l.input[l.pos] == '=' {
@@ -168,11 +194,20 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		return ASSIGN
 	case r == '!':
 		l.pos += width
-		if l.pos < len(l.input) && l.input[l.pos] == '=' {
-			l.pos += width
-			return NEQ
+		if l.pos < len(l.input) {
+			switch l.input[l.pos] {
+			case '=':
+				l.pos++
+				return NEQ
+			case '!':
+				l.pos++
+				return COMPOUND
+			case 'p':
+				l.pos++
+				return PENETRATE
+			}
 		}
-		return int('!')
+		return EXPLODE
 	case r == '>':
 		l.pos += width
 		if l.pos < len(l.input) && l.input[l.pos] == '=' {
@@ -209,7 +244,22 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		l.pos += width
 		return int(r)
 	}
-	return 0
+}
+
+// lexOperatorWord 识别操作符单词，只有当其后不是字母时才视为操作符，
+// 避免把 p2、a8、max10 之类的写法当成标识符
+func (l *Lexer) lexOperatorWord() (int, int) {
+	rest := l.input[l.pos:]
+	for _, word := range []string{"max", "min", "ro", "r", "h", "l", "f", "a", "c", "p", "b", "k", "q", "m"} {
+		if !strings.HasPrefix(rest, word) {
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(rest[len(word):])
+		if next == utf8.RuneError || !isIdentStart(next) {
+			return keywords[word], len(word)
+		}
+	}
+	return 0, 0
 }
 
 func (l *Lexer) lexNumber(lval *yySymType) int {
@@ -225,8 +275,12 @@ func (l *Lexer) lexNumber(lval *yySymType) int {
 
 func (l *Lexer) lexIdent(lval *yySymType) int {
 	start := l.pos
-	for l.pos < len(l.input) && isIdentPart(rune(l.input[l.pos])) {
-		l.pos++
+	for l.pos < len(l.input) {
+		r, width := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !isIdentPart(r) {
+			break
+		}
+		l.pos += width
 	}
 	ident := l.input[start:l.pos]
 
@@ -251,6 +305,28 @@ func isIdentPart(r rune) bool {
 	return isIdentStart(r) || unicode.IsDigit(r)
 }
 
+// Error 记录第一个语法错误及其位置
 func (l *Lexer) Error(s string) {
-	log.Printf("语法错误: %s", s)
+	if l.err != nil {
+		return
+	}
+	if s == "syntax error" {
+		s = "语法错误"
+	}
+	l.err = fmt.Errorf("第 %d 个字符: %s", l.Position(), s)
+}
+
+// setProgram 保存语法分析得到的语句
+func (l *Lexer) setProgram(stmts []Stmt) {
+	l.stmts = stmts
+}
+
+// Err 返回解析过程中的第一个错误
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// Position 返回当前记号的位置（从 1 开始的字符序号）
+func (l *Lexer) Position() int {
+	return utf8.RuneCountInString(l.input[:l.tokStart]) + 1
 }
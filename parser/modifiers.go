@@ -0,0 +1,320 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 爆炸骰的类型
+const (
+	ExplodeNormal    = iota // ! 每次爆炸追加一个骰子
+	ExplodeCompound         // !! 爆炸结果累加到同一个骰子
+	ExplodePenetrate        // !p 追加的骰子点数减一
+)
+
+// DiceCompare 骰子修饰符的比较条件，Op 为 EQ、GT、GE、LT、LE 之一
+type DiceCompare struct {
+	Op     int
+	Target Expr
+}
+
+// DiceExplode 爆炸骰修饰符，Point 为空时掷出最大值即爆炸
+type DiceExplode struct {
+	Mode  int
+	Point *DiceCompare
+}
+
+// DiceReroll 重骰修饰符，Once 为 true 时每个骰子最多重骰一次
+type DiceReroll struct {
+	Once  bool
+	Point *DiceCompare
+}
+
+// withExplode 为骰子表达式加上爆炸修饰符
+func withExplode(yylex yyLexer, expr Expr, mode int, point *DiceCompare) Expr {
+	d := modifiableDice(yylex, expr)
+	if d == nil {
+		return expr
+	}
+	if d.Explode != nil {
+		yylex.Error("重复的爆炸骰修饰符")
+		return expr
+	}
+	d.Explode = &DiceExplode{Mode: mode, Point: point}
+	return d
+}
+
+// withReroll 为骰子表达式加上重骰修饰符
+func withReroll(yylex yyLexer, expr Expr, once bool, point *DiceCompare) Expr {
+	d := modifiableDice(yylex, expr)
+	if d == nil {
+		return expr
+	}
+	if d.Reroll != nil {
+		yylex.Error("重复的重骰修饰符")
+		return expr
+	}
+	d.Reroll = &DiceReroll{Once: once, Point: point}
+	return d
+}
+
+// withSuccess 为骰子表达式加上成功计数条件
+func withSuccess(yylex yyLexer, expr Expr, point *DiceCompare) Expr {
+	d := modifiableDice(yylex, expr)
+	if d == nil {
+		return expr
+	}
+	if d.Success != nil {
+		yylex.Error("重复的成功计数条件")
+		return expr
+	}
+	d.Success = point
+	return d
+}
+
+// withFailure 为骰子表达式加上失败计数条件，必须先指定成功条件
+func withFailure(yylex yyLexer, expr Expr, point *DiceCompare) Expr {
+	d := modifiableDice(yylex, expr)
+	if d == nil {
+		return expr
+	}
+	if d.Success == nil {
+		yylex.Error("失败计数需要先指定成功条件，例如 5d10>=8f1")
+		return expr
+	}
+	if d.Failure != nil {
+		yylex.Error("重复的失败计数条件")
+		return expr
+	}
+	d.Failure = point
+	return d
+}
+
+// modifiableDice 检查修饰符是否作用于普通骰子
+func modifiableDice(yylex yyLexer, expr Expr) *DiceExpr {
+	d, ok := expr.(*DiceExpr)
+	if !ok {
+		yylex.Error("只有普通骰子可以使用 !、r、比较等修饰符")
+		return nil
+	}
+	return d
+}
+
+// hasModifiers 返回是否使用了任何修饰符
+func (d *DiceExpr) hasModifiers() bool {
+	return d.Explode != nil || d.Reroll != nil || d.Success != nil
+}
+
+// diceTest 计算好目标值的比较条件
+type diceTest struct {
+	op     int
+	target int
+}
+
+func (t *diceTest) match(value int) bool {
+	switch t.op {
+	case GT:
+		return value > t.target
+	case GE:
+		return value >= t.target
+	case LT:
+		return value < t.target
+	case LE:
+		return value <= t.target
+	}
+	return value == t.target
+}
+
+// diceRules 一次掷骰中已经求出目标值的修饰符
+type diceRules struct {
+	sides      int
+	explode    *diceTest
+	mode       int
+	reroll     *diceTest
+	rerollOnce bool
+	success    *diceTest
+	failure    *diceTest
+	iterations int
+}
+
+// rules 计算修饰符中的目标值
+func (d *DiceExpr) rules(ctx *Context, sides int) *diceRules {
+	r := &diceRules{sides: sides}
+	if d.Explode != nil {
+		r.mode = d.Explode.Mode
+		r.explode = &diceTest{op: EQ, target: sides}
+		if d.Explode.Point != nil {
+			r.explode = d.Explode.Point.resolve(ctx)
+		}
+	}
+	if d.Reroll != nil {
+		r.reroll = d.Reroll.Point.resolve(ctx)
+		r.rerollOnce = d.Reroll.Once
+	}
+	if d.Success != nil {
+		r.success = d.Success.resolve(ctx)
+	}
+	if d.Failure != nil {
+		r.failure = d.Failure.resolve(ctx)
+	}
+	return r
+}
+
+func (c *DiceCompare) resolve(ctx *Context) *diceTest {
+	return &diceTest{op: c.Op, target: ctx.evalInt(c.Target)}
+}
+
+// step 记录一次额外的投掷，防止 1d6!>0 之类的条件无限爆炸
+func (r *diceRules) step(ctx *Context) {
+	r.iterations++
+	if r.iterations > MAX_ITERATIONS {
+		ctx.fail(ErrIterationLimit, "%d", MAX_ITERATIONS)
+	}
+}
+
+// rollDie 掷一个骰子并依次应用重骰和爆炸，被重骰替换的骰子标记为舍弃
+func (r *diceRules) rollDie(ctx *Context) []Die {
+	var dice []Die
+	value := ctx.intn(r.sides) + 1
+
+	if r.reroll != nil {
+		for r.reroll.match(value) {
+			r.step(ctx)
+			dice = append(dice, Die{Sides: r.sides, Value: value, Dropped: true, Rerolled: true})
+			value = ctx.intn(r.sides) + 1
+			if r.rerollOnce {
+				break
+			}
+		}
+	}
+
+	if r.explode == nil {
+		return append(dice, Die{Sides: r.sides, Value: value})
+	}
+
+	if r.mode == ExplodeCompound {
+		die := Die{Sides: r.sides, Value: value}
+		for last := value; r.explode.match(last); {
+			r.step(ctx)
+			last = ctx.intn(r.sides) + 1
+			die.Value += last
+			die.Exploded = true
+		}
+		return append(dice, die)
+	}
+
+	die := Die{Sides: r.sides, Value: value}
+	for raw := value; r.explode.match(raw); {
+		r.step(ctx)
+		die.Exploded = true
+		dice = append(dice, die)
+
+		raw = ctx.intn(r.sides) + 1
+		die = Die{Sides: r.sides, Value: raw}
+		if r.mode == ExplodePenetrate {
+			die.Value--
+		}
+	}
+	return append(dice, die)
+}
+
+// mark 标记成功和失败的骰子
+func (r *diceRules) mark(dice []Die) {
+	if r.success == nil {
+		return
+	}
+	for i := range dice {
+		if dice[i].Dropped {
+			continue
+		}
+		dice[i].Success = r.success.match(dice[i].Value)
+		dice[i].Failure = !dice[i].Success && r.failure != nil && r.failure.match(dice[i].Value)
+	}
+}
+
+// total 计算结果：使用成功计数时为成功数减失败数，否则为未舍弃骰子之和
+func (r *diceRules) total(dice []Die) int {
+	total := 0
+	for _, die := range dice {
+		switch {
+		case die.Dropped:
+		case r.success == nil:
+			total += die.Value
+		case die.Success:
+			total++
+		case die.Failure:
+			total--
+		}
+	}
+	return total
+}
+
+// formatDice 格式化带修饰符的骰子结果，被重骰的点数用 ~ 包围，爆炸的骰子带 !
+func formatDice(dice []Die, mode int) string {
+	labels := make([]string, len(dice))
+	for i, die := range dice {
+		label := strconv.Itoa(die.Value)
+		switch {
+		case die.Rerolled:
+			label = "~" + label + "~"
+		case die.Exploded && mode == ExplodeCompound:
+			label += "!!"
+		case die.Exploded:
+			label += "!"
+		}
+		if die.Success {
+			label += "✓"
+		} else if die.Failure {
+			label += "✗"
+		}
+		labels[i] = label
+	}
+
+	if len(labels) <= 7 {
+		return "[" + strings.Join(labels, " ") + "]"
+	}
+	return "[" + strings.Join(labels[:3], " ") + " ... " + strings.Join(labels[len(labels)-3:], " ") + "]"
+}
+
+// modifierString 将修饰符还原为表达式文本
+func (d *DiceExpr) modifierString() string {
+	var b strings.Builder
+	if d.Reroll != nil {
+		if d.Reroll.Once {
+			b.WriteString("ro")
+		} else {
+			b.WriteString("r")
+		}
+		b.WriteString(d.Reroll.Point.String(true))
+	}
+	if d.Explode != nil {
+		switch d.Explode.Mode {
+		case ExplodeCompound:
+			b.WriteString("!!")
+		case ExplodePenetrate:
+			b.WriteString("!p")
+		default:
+			b.WriteString("!")
+		}
+		if d.Explode.Point != nil {
+			b.WriteString(d.Explode.Point.String(true))
+		}
+	}
+	if d.Success != nil {
+		b.WriteString(d.Success.String(false))
+	}
+	if d.Failure != nil {
+		b.WriteString("f" + d.Failure.String(true))
+	}
+	return b.String()
+}
+
+// String 返回比较条件的文本，omitEq 为 true 时等于条件只写目标值
+func (c *DiceCompare) String(omitEq bool) string {
+	target := wrapOperand(c.Target, &DiceExpr{})
+	if c.Op == EQ && omitEq {
+		return target
+	}
+	return fmt.Sprintf("%s%s", opString(c.Op), target)
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"island/rng"
+	"testing"
+)
+
+// TestDiceModifiers 使用回放来源固定点数，检查爆炸、重骰和成功计数的结果与过程
+func TestDiceModifiers(t *testing.T) {
+	tests := []struct {
+		input   string
+		draws   []int
+		value   interface{}
+		process string
+	}{
+		{"3d6!", []int{5, 2, 0, 3}, 14, "3d6! = [6! 3 1 4] = 14"},
+		{"3d6!!", []int{5, 2, 0, 3}, 14, "3d6!! = [9!! 1 4] = 14"},
+		{"3d6!p", []int{5, 2, 0, 3}, 13, "3d6!p = [6! 2 1 4] = 13"},
+		{"2d6!>4", []int{4, 0, 5, 5, 1}, 20, "2d6!>4 = [5! 1 6! 6! 2] = 20"},
+		{"2d6r<3", []int{0, 1, 4, 5}, 11, "2d6r<3 = [~1~ ~2~ 5 6] = 11"},
+		{"2d6ro1", []int{0, 0, 3}, 5, "2d6ro1 = [~1~ 1 4] = 5"},
+		{"5d10>=8", []int{8, 7, 6, 0, 9}, 3, "5d10>=8 = [9✓ 8✓ 7 1 10✓] = 3"},
+		{"5d10>=8f1", []int{8, 7, 6, 0, 9}, 2, "5d10>=8f1 = [9✓ 8✓ 7 1✗ 10✓] = 2"},
+		{"(3d6)>=10", []int{5, 5, 5}, true, "3d6 = [6 6 6] = 18"},
+	}
+
+	for _, tt := range tests {
+		replay := rng.NewReplayValues(tt.draws...)
+		res, err := NewContextWithSource(replay).Eval(tt.input)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.input, err)
+			continue
+		}
+		if res.Value != tt.value || res.Process != tt.process {
+			t.Errorf("Eval(%q) = %v (%s), want %v (%s)", tt.input, res.Value, res.Process, tt.value, tt.process)
+		}
+		if err := replay.Err(); err != nil || replay.Remaining() != 0 {
+			t.Errorf("Eval(%q) used the wrong number of draws: %v, %d left", tt.input, err, replay.Remaining())
+		}
+	}
+}
+
+func TestDiceModifierErrors(t *testing.T) {
+	if _, err := Eval("1d6!>0"); err == nil {
+		t.Error("1d6!>0 should hit the iteration limit")
+	}
+	if _, err := ParseProgram("3d6f1"); err == nil {
+		t.Error("3d6f1 should require a success condition")
+	}
+	if _, err := ParseProgram("4d6kh3!"); err == nil {
+		t.Error("modifiers should only apply to plain dice")
+	}
+}
+
+func TestDiceModifierString(t *testing.T) {
+	for _, input := range []string{"2d6ro<2!>5>=4f1", "3d6!!", "4d10!p>=6", "1d20r1"} {
+		program, err := ParseProgram(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ExprString(program.Stmts[0].(*ExprStmt).Expr); got != input {
+			t.Errorf("ExprString(%q) = %q", input, got)
+		}
+	}
+}
+
+// TestDiceScale 重击时骰子个数翻倍，常数加值不变
+func TestDiceScale(t *testing.T) {
+	ctx := NewContextWithSource(rng.NewReplayValues(0, 1, 2, 3, 2, 0))
+	ctx.DiceScale = 2
+	res, err := ctx.Eval("2d6+d4+3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Value != 17 || res.Process != "4d6 = [1 2 3 4] = 10; 2d4 = [3 1] = 4" {
+		t.Errorf("2d6+d4+3 doubled = %v (%s), want 17", res.Value, res.Process)
+	}
+}
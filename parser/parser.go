@@ -1,4 +1,4 @@
-// Code generated by goyacc -o parser.go -v y.output parser.y. DO NOT EDIT.
+// Code generated by goyacc -o parser.go -p yy parser.y. DO NOT EDIT.
 
 //line parser.y:2
 package parser
@@ -29,33 +29,39 @@ const Q = 57360
 const M = 57361
 const MAX = 57362
 const MIN = 57363
-const ADD = 57364
-const SUB = 57365
-const MUL = 57366
-const DIV = 57367
-const MOD = 57368
-const LBRACKET = 57369
-const RBRACKET = 57370
-const BITAND = 57371
-const BITOR = 57372
-const COMMA = 57373
-const GT = 57374
-const LT = 57375
-const GE = 57376
-const LE = 57377
-const EQ = 57378
-const NEQ = 57379
-const QUESTION = 57380
-const COLON = 57381
-const SEMICOLON = 57382
-const HASH = 57383
-const LBRACE = 57384
-const RBRACE = 57385
-const CIRCUMFLEX = 57386
-const ASSIGN = 57387
-const KL = 57388
-const KH = 57389
-const UMINUS = 57390
+const EXPLODE = 57364
+const COMPOUND = 57365
+const PENETRATE = 57366
+const REROLL = 57367
+const REROLL_ONCE = 57368
+const ADD = 57369
+const SUB = 57370
+const MUL = 57371
+const DIV = 57372
+const MOD = 57373
+const LBRACKET = 57374
+const RBRACKET = 57375
+const BITAND = 57376
+const BITOR = 57377
+const COMMA = 57378
+const GT = 57379
+const LT = 57380
+const GE = 57381
+const LE = 57382
+const EQ = 57383
+const NEQ = 57384
+const QUESTION = 57385
+const COLON = 57386
+const SEMICOLON = 57387
+const HASH = 57388
+const LBRACE = 57389
+const RBRACE = 57390
+const CIRCUMFLEX = 57391
+const ASSIGN = 57392
+const KL = 57393
+const KH = 57394
+const DICE_MODIFIER = 57395
+const UMINUS = 57396
 
 var yyToknames = [...]string{
 	"$end",
@@ -79,6 +85,11 @@ var yyToknames = [...]string{
 	"M",
 	"MAX",
 	"MIN",
+	"EXPLODE",
+	"COMPOUND",
+	"PENETRATE",
+	"REROLL",
+	"REROLL_ONCE",
 	"ADD",
 	"SUB",
 	"MUL",
@@ -105,6 +116,7 @@ var yyToknames = [...]string{
 	"ASSIGN",
 	"KL",
 	"KH",
+	"DICE_MODIFIER",
 	"UMINUS",
 }
 
@@ -114,7 +126,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line parser.y:453
+//line parser.y:564
 
 func init() {
 	// 初始化解析器相关设置
@@ -129,92 +141,117 @@ var yyExca = [...]int8{
 
 const yyPrivate = 57344
 
-const yyLast = 114
-
-var yyAct = [...]int8{
-	20, 54, 41, 40, 37, 26, 12, 27, 83, 27,
-	80, 4, 110, 45, 30, 31, 43, 11, 19, 44,
-	48, 49, 46, 47, 10, 8, 42, 81, 106, 9,
-	82, 3, 28, 29, 92, 52, 7, 55, 5, 57,
-	27, 70, 71, 72, 73, 68, 69, 74, 75, 76,
-	77, 78, 79, 51, 50, 67, 60, 61, 56, 64,
-	65, 66, 62, 63, 6, 58, 59, 34, 35, 36,
-	32, 33, 18, 21, 53, 22, 23, 84, 24, 87,
-	88, 85, 86, 17, 93, 95, 96, 97, 98, 99,
-	100, 101, 102, 103, 55, 94, 25, 38, 39, 89,
-	90, 91, 105, 104, 16, 107, 108, 109, 15, 14,
-	13, 111, 2, 1,
+const yyLast = 190
+
+var yyAct = [...]uint8{
+	40, 5, 44, 61, 60, 57, 32, 28, 123, 30,
+	107, 4, 31, 35, 36, 33, 34, 27, 28, 85,
+	18, 39, 88, 154, 45, 89, 16, 74, 5, 17,
+	25, 78, 15, 150, 79, 80, 81, 82, 83, 84,
+	76, 77, 41, 42, 52, 53, 29, 13, 58, 59,
+	32, 38, 37, 30, 28, 14, 31, 35, 36, 33,
+	34, 104, 105, 106, 108, 108, 108, 108, 108, 117,
+	118, 119, 120, 121, 108, 113, 114, 115, 116, 102,
+	103, 98, 99, 100, 122, 96, 97, 101, 132, 86,
+	87, 6, 133, 3, 11, 38, 37, 54, 55, 56,
+	24, 45, 90, 91, 92, 93, 94, 95, 149, 148,
+	134, 135, 136, 137, 46, 47, 48, 49, 50, 51,
+	7, 75, 8, 9, 43, 139, 140, 141, 142, 143,
+	144, 145, 146, 147, 7, 138, 8, 9, 129, 130,
+	131, 10, 23, 62, 22, 21, 73, 20, 12, 151,
+	152, 153, 19, 2, 1, 155, 63, 64, 65, 66,
+	67, 7, 12, 8, 9, 0, 26, 109, 111, 110,
+	112, 68, 70, 69, 71, 72, 124, 0, 127, 128,
+	125, 126, 0, 0, 0, 0, 0, 0, 0, 12,
 }
 
 var yyPact = [...]int16{
-	69, -1000, -35, -1000, -29, -1000, 3, -18, 48, 43,
-	-40, 77, -44, 17, -1000, -1000, -1000, -1000, -1000, -1000,
-	7, -1000, -1000, 69, -1000, 69, 69, 69, 69, 69,
-	69, 69, 69, 69, 69, 69, 69, 69, 69, 69,
-	69, 69, 69, 69, -1000, -1000, 69, 69, 69, 69,
-	69, 69, 2, -1, -1000, -29, -1000, -31, -18, -18,
-	48, 48, 43, 43, -40, -40, -40, 77, -44, -44,
-	-1000, -1000, -1000, 64, -1000, -1000, 82, 15, -1000, -1000,
-	-1000, -1000, 69, 69, 69, 69, 69, 69, 69, 69,
-	69, 69, 69, -1000, -29, -1000, -1000, -1000, -1000, -1000,
-	84, 9, -1000, -1000, 69, 69, 69, -1000, -7, -1000,
-	69, -1000,
+	157, -32768, -28, -32768, -25, 0, -32768, -32768, -32768, 157,
+	-32768, 8, 157, 77, 17, 68, -44, 28, -48, 134,
+	-32768, -32768, -32768, -32768, -32768, -32768, 116, 157, 157, 157,
+	116, -32768, -32768, 116, 116, 116, 116, 116, 116, 11,
+	44, 157, 157, -11, -32768, -25, 157, 157, 157, 157,
+	157, 157, 157, 157, 157, 157, 157, 157, 157, 157,
+	116, 116, 116, 130, 130, 130, 130, 130, 116, 116,
+	116, 116, 116, 130, -32768, -32768, -36, -25, 163, -32768,
+	-32768, 121, 69, -32768, -32768, -32768, 77, 77, -32768, 157,
+	17, 17, 17, 17, 17, 17, 68, 68, -44, -44,
+	-44, 28, -48, -48, -32768, -32768, -32768, -32768, -32768, 116,
+	116, 116, 116, -32768, -32768, -32768, -32768, -32768, -32768, -32768,
+	-32768, -32768, -32768, 157, 116, 116, 116, 116, 116, 116,
+	116, 116, 116, -32768, -32768, -32768, -32768, -32768, -25, -32768,
+	-32768, -32768, -32768, -32768, 90, 14, -32768, -32768, 116, 116,
+	116, -32768, 4, -32768, 116, -32768,
 }
 
-var yyPgo = [...]int8{
-	0, 113, 112, 31, 11, 6, 0, 110, 109, 108,
-	104, 83, 78, 1, 74, 72, 64, 36, 38, 25,
-	29, 24, 17, 18,
+var yyPgo = [...]uint8{
+	0, 154, 153, 93, 11, 20, 0, 152, 147, 145,
+	144, 142, 141, 2, 124, 100, 10, 94, 47, 91,
+	55, 32, 26, 29, 30,
 }
 
 var yyR1 = [...]int8{
-	0, 1, 2, 2, 3, 4, 18, 18, 16, 16,
-	16, 17, 17, 17, 19, 19, 19, 20, 20, 20,
-	20, 21, 21, 22, 22, 22, 5, 5, 5, 5,
-	5, 5, 5, 5, 5, 7, 7, 7, 7, 7,
-	7, 7, 8, 8, 9, 9, 10, 10, 10, 10,
-	10, 10, 10, 10, 11, 11, 15, 15, 23, 6,
-	6, 6, 6, 12, 14, 14, 13,
+	0, 1, 2, 2, 3, 3, 4, 19, 19, 17,
+	17, 17, 18, 18, 18, 18, 18, 18, 18, 20,
+	20, 20, 21, 21, 21, 21, 22, 22, 23, 23,
+	23, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 16, 16, 16, 16, 16, 8, 8, 9,
+	9, 10, 10, 10, 10, 10, 10, 10, 10, 11,
+	11, 15, 15, 24, 6, 6, 6, 6, 12, 14,
+	14, 13,
 }
 
 var yyR2 = [...]int8{
-	0, 1, 1, 3, 1, 1, 1, 5, 1, 3,
-	3, 1, 3, 3, 1, 3, 3, 1, 3, 3,
-	3, 1, 3, 1, 3, 3, 1, 1, 1, 1,
-	1, 1, 1, 3, 3, 3, 3, 5, 5, 5,
-	5, 5, 2, 2, 3, 3, 3, 5, 7, 5,
-	7, 7, 9, 5, 3, 5, 3, 3, 1, 1,
-	1, 3, 1, 3, 1, 3, 1,
+	0, 1, 1, 3, 1, 3, 1, 1, 5, 1,
+	3, 3, 1, 3, 3, 3, 3, 3, 3, 1,
+	3, 3, 1, 3, 3, 3, 1, 3, 1, 3,
+	3, 1, 1, 1, 1, 1, 1, 1, 3, 3,
+	3, 2, 3, 5, 5, 5, 5, 5, 2, 3,
+	2, 3, 2, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 1, 2, 2, 2, 2, 2, 2, 3,
+	3, 3, 5, 7, 5, 7, 7, 9, 5, 3,
+	5, 3, 3, 1, 1, 1, 3, 1, 3, 1,
+	3, 1,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, -2, -3, -4, -18, -16, -17, -19, -20,
-	-21, -22, -5, -7, -8, -9, -10, -11, -15, -23,
-	-6, 4, 6, 7, -12, 27, 40, 38, 29, 30,
-	32, 33, 22, 23, 24, 25, 26, 44, 20, 21,
-	47, 46, 9, 9, 12, 6, 15, 16, 13, 14,
-	47, 46, -4, -14, -13, -4, -3, -4, -17, -17,
-	-19, -19, -20, -20, -21, -21, -21, -22, -5, -5,
-	-6, -6, -6, -6, -6, -6, -6, -6, -6, -6,
-	8, 28, 31, 39, 13, 17, 18, 15, 16, 17,
-	18, 19, 19, -13, -4, -6, -6, -6, -6, -6,
-	-6, -6, -6, -6, 19, 18, 19, -6, -6, -6,
-	19, -6,
+	-32768, -1, -2, -3, -4, -6, -19, 4, 6, 7,
+	-12, -17, 32, -18, -20, -21, -22, -23, -5, -7,
+	-8, -9, -10, -11, -15, -24, 9, 45, 43, 46,
+	9, 12, 6, 15, 16, 13, 14, 52, 51, -4,
+	-6, 34, 35, -14, -13, -4, 37, 38, 39, 40,
+	41, 42, 27, 28, 29, 30, 31, 49, 20, 21,
+	52, 51, 9, 22, 23, 24, 25, 26, 37, 39,
+	38, 40, 41, 12, -6, -3, -4, -4, -6, -6,
+	-6, -6, -6, -6, -6, 8, -18, -18, 33, 36,
+	-20, -20, -20, -20, -20, -20, -21, -21, -22, -22,
+	-22, -23, -5, -5, -6, -6, -6, -16, -6, 37,
+	39, 38, 40, -16, -16, -16, -16, -6, -6, -6,
+	-6, -6, -16, 44, 13, 17, 18, 15, 16, 17,
+	18, 19, 19, -13, -6, -6, -6, -6, -4, -6,
+	-6, -6, -6, -6, -6, -6, -6, -6, 19, 18,
+	19, -6, -6, -6, 19, -6,
 }
 
 var yyDef = [...]int8{
-	0, -2, 1, 2, 4, 5, 6, 8, 11, 14,
-	17, 21, 23, 26, 27, 28, 29, 30, 31, 32,
-	58, 59, 60, 0, 62, 0, 0, 0, 0, 0,
+	0, -2, 1, 2, 4, 83, 6, 84, 85, 0,
+	87, 7, 0, 9, 12, 19, 22, 26, 28, 31,
+	32, 33, 34, 35, 36, 37, 0, 0, 0, 0,
+	0, 67, 68, 0, 0, 0, 0, 0, 0, 0,
+	83, 0, 0, 0, 89, 91, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 42, 43, 0, 0, 0, 0,
-	0, 0, 0, 0, 64, 66, 3, 0, 9, 10,
-	12, 13, 15, 16, 18, 19, 20, 22, 24, 25,
-	33, 34, 36, 35, 44, 45, 46, 54, 56, 57,
-	61, 63, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 65, 7, 37, 38, 39, 40, 41,
-	47, 49, 53, 55, 0, 0, 0, 48, 51, 50,
-	0, 52,
+	0, 0, 0, 48, 50, 52, 0, 0, 0, 0,
+	0, 0, 0, 0, 41, 3, 0, 5, 40, 69,
+	70, 71, 79, 81, 82, 86, 10, 11, 88, 0,
+	13, 14, 15, 16, 17, 18, 20, 21, 23, 24,
+	25, 27, 29, 30, 38, 39, 42, 49, 62, 0,
+	0, 0, 0, 51, 53, 54, 55, 56, 57, 58,
+	59, 60, 61, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 90, 63, 64, 65, 66, 8, 43,
+	44, 45, 46, 47, 72, 74, 78, 80, 0, 0,
+	0, 73, 76, 75, 0, 77,
 }
 
 var yyTok1 = [...]int8{
@@ -226,7 +263,8 @@ var yyTok2 = [...]int8{
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
-	42, 43, 44, 45, 46, 47, 48,
+	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
+	52, 53, 54,
 }
 
 var yyTok3 = [...]int8{
@@ -272,7 +310,7 @@ func yyNewParser() yyParser {
 	return &yyParserImpl{}
 }
 
-const yyFlag = -1000
+const yyFlag = -32768
 
 func yyTokname(c int) string {
 	if c >= 1 && c-1 < len(yyToknames) {
@@ -572,300 +610,442 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:48
-		{
-			var result interface{}
-			var process string = ""
-			for _, stmt := range yyDollar[1].StmtList {
-				if stmt != nil {
-					// 获取表达式结果
-					result = stmt.Evaluate()
-
-					// 获取投掷过程
-					if exprStmt, ok := stmt.(*ExprStmt); ok {
-						process = exprStmt.GetProcess()
-					}
-				}
+//line parser.y:54
+		{
+			// 只构建语法树，求值由 Program.Evaluate 在独立的上下文中完成
+			if receiver, ok := yylex.(programReceiver); ok {
+				receiver.setProgram(yyDollar[1].StmtList)
 			}
-			SetResult(result, process) // 保存计算结果和过程
 			yyVAL.StmtList = yyDollar[1].StmtList
 		}
 	case 2:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:68
+//line parser.y:64
 		{
 			yyVAL.StmtList = []Stmt{yyDollar[1].Stmt}
 		}
 	case 3:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:72
+//line parser.y:68
 		{
 			yyVAL.StmtList = append(yyDollar[1].StmtList, yyDollar[3].Stmt)
 		}
 	case 4:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:78
+//line parser.y:74
 		{
-			yyVAL.Stmt = &ExprStmt{yyDollar[1].Expr}
+			yyVAL.Stmt = &ExprStmt{Expr: yyDollar[1].Expr}
 		}
 	case 5:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:84
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:78
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			// 重复掷骰，例如 6#3d6
+			yyVAL.Stmt = &RepeatBlockStmt{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr, Block: []Stmt{&ExprStmt{Expr: yyDollar[3].Expr}}}
 		}
 	case 6:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:90
+//line parser.y:85
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 7:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:94
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:91
 		{
-			yyVAL.Expr = &TernaryExpr{yyDollar[1].Expr, yyDollar[3].Expr, yyDollar[5].Expr}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 8:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:100
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.y:95
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &TernaryExpr{yyDollar[1].Expr, yyDollar[3].Expr, yyDollar[5].Expr}
 		}
 	case 9:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:104
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:101
 		{
-			yyVAL.Expr = &BitwiseExpr{yyDollar[1].Expr, yyDollar[3].Expr, true}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 10:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:108
+//line parser.y:105
 		{
-			yyVAL.Expr = &BitwiseExpr{yyDollar[1].Expr, yyDollar[3].Expr, false}
+			yyVAL.Expr = &BitwiseExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Right: yyDollar[3].Expr, IsAnd: true}
 		}
 	case 11:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:114
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:109
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &BitwiseExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Right: yyDollar[3].Expr, IsAnd: false}
 		}
 	case 12:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:118
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:115
 		{
-			yyVAL.Expr = &CompareExpr{yyDollar[1].Expr, yyDollar[3].Expr, true}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 13:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:122
+//line parser.y:119
 		{
-			yyVAL.Expr = &CompareExpr{yyDollar[1].Expr, yyDollar[3].Expr, false}
+			yyVAL.Expr = &CompareExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Right: yyDollar[3].Expr, IsGreater: true}
 		}
 	case 14:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:128
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:123
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &CompareExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Right: yyDollar[3].Expr, IsGreater: false}
 		}
 	case 15:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:132
+//line parser.y:127
 		{
-			yyVAL.Expr = &BinaryExpr{yyDollar[1].Expr, ADD, yyDollar[3].Expr}
+			yyVAL.Expr = &ComparisonExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: GE, Right: yyDollar[3].Expr}
 		}
 	case 16:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:136
+//line parser.y:131
 		{
-			yyVAL.Expr = &BinaryExpr{yyDollar[1].Expr, SUB, yyDollar[3].Expr}
+			yyVAL.Expr = &ComparisonExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: LE, Right: yyDollar[3].Expr}
 		}
 	case 17:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:142
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:135
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &ComparisonExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: EQ, Right: yyDollar[3].Expr}
 		}
 	case 18:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:146
+//line parser.y:139
 		{
-			yyVAL.Expr = &BinaryExpr{yyDollar[1].Expr, MUL, yyDollar[3].Expr}
+			yyVAL.Expr = &ComparisonExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: NEQ, Right: yyDollar[3].Expr}
 		}
 	case 19:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:150
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:145
 		{
-			yyVAL.Expr = &BinaryExpr{yyDollar[1].Expr, DIV, yyDollar[3].Expr}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 20:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:154
+//line parser.y:149
 		{
-			yyVAL.Expr = &BinaryExpr{yyDollar[1].Expr, MOD, yyDollar[3].Expr}
+			yyVAL.Expr = &BinaryExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: ADD, Right: yyDollar[3].Expr}
 		}
 	case 21:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:160
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:153
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &BinaryExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: SUB, Right: yyDollar[3].Expr}
 		}
 	case 22:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:164
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:159
 		{
-			yyVAL.Expr = &BinaryExpr{yyDollar[1].Expr, CIRCUMFLEX, yyDollar[3].Expr}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 23:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:170
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:163
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &BinaryExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: MUL, Right: yyDollar[3].Expr}
 		}
 	case 24:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:174
+//line parser.y:167
 		{
-			yyVAL.Expr = &MaxMinExpr{yyDollar[1].Expr, yyDollar[3].Expr, true}
+			yyVAL.Expr = &BinaryExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: DIV, Right: yyDollar[3].Expr}
 		}
 	case 25:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:178
+//line parser.y:171
 		{
-			yyVAL.Expr = &MaxMinExpr{yyDollar[1].Expr, yyDollar[3].Expr, false}
+			yyVAL.Expr = &BinaryExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: MOD, Right: yyDollar[3].Expr}
 		}
 	case 26:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:184
+//line parser.y:177
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 27:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:188
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:181
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &BinaryExpr{Node: Node{yyDollar[2].Pos}, Left: yyDollar[1].Expr, Op: CIRCUMFLEX, Right: yyDollar[3].Expr}
 		}
 	case 28:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:192
+//line parser.y:187
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 29:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:196
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:191
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &MaxMinExpr{Node: Node{yyDollar[2].Pos}, Expr: yyDollar[1].Expr, Limit: yyDollar[3].Expr, IsMax: true}
 		}
 	case 30:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:200
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:195
 		{
-			yyVAL.Expr = yyDollar[1].Expr
+			yyVAL.Expr = &MaxMinExpr{Node: Node{yyDollar[2].Pos}, Expr: yyDollar[1].Expr, Limit: yyDollar[3].Expr, IsMax: false}
 		}
 	case 31:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:204
+//line parser.y:201
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 32:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:208
+//line parser.y:205
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 33:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:212
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:209
 		{
-			yyVAL.Expr = &HighLowSelectExpr{yyDollar[1].Expr, yyDollar[3].Expr, true, true}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 34:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:216
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:213
 		{
-			yyVAL.Expr = &HighLowSelectExpr{yyDollar[1].Expr, yyDollar[3].Expr, false, true}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 35:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:222
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:217
 		{
-			fmt.Printf("解析骰点表达式: %v d %v\n", yyDollar[1].Expr, yyDollar[3].Expr)
-			yyVAL.Expr = &DiceExpr{Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: nil, process: "", rolls: nil}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 36:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:227
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:221
 		{
-			fmt.Printf("解析连续骰点表达式: %v d %v\n", yyDollar[1].Expr, yyDollar[3].Expr)
-			yyVAL.Expr = &DiceExpr{Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: nil, process: "", rolls: nil}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 37:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:232
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:225
 		{
-			yyVAL.Expr = &DiceExpr{Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: yyDollar[5].Expr, Keep: nil, process: "", rolls: nil}
+			yyVAL.Expr = yyDollar[1].Expr
 		}
 	case 38:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:236
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:229
 		{
-			yyVAL.Expr = &DiceExpr{Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: yyDollar[5].Expr, process: "", rolls: nil}
+			yyVAL.Expr = &HighLowSelectExpr{Node: Node{yyDollar[2].Pos}, Expr: yyDollar[1].Expr, Count: yyDollar[3].Expr, KeepHigh: true, KeepLeft: true}
 		}
 	case 39:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:240
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:233
 		{
-			yyVAL.Expr = &DiceExpr{Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: nil, process: "", rolls: nil}
+			yyVAL.Expr = &HighLowSelectExpr{Node: Node{yyDollar[2].Pos}, Expr: yyDollar[1].Expr, Count: yyDollar[3].Expr, KeepHigh: false, KeepLeft: true}
 		}
 	case 40:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:244
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:239
 		{
-			yyVAL.Expr = &PenaltyBonusDiceExpr{IsBonus: false, Count: yyDollar[5].Expr}
+			yyVAL.Expr = &DiceExpr{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: nil}
 		}
 	case 41:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:248
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:243
 		{
-			yyVAL.Expr = &PenaltyBonusDiceExpr{IsBonus: true, Count: yyDollar[5].Expr}
+			// 省略个数时默认掷一个，例如 d20
+			yyVAL.Expr = &DiceExpr{Node: Node{yyDollar[1].Pos}, Count: &NumberExpr{Value: 1}, Sides: yyDollar[2].Expr, Drop: nil, Keep: nil}
 		}
 	case 42:
-		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.y:254
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:248
 		{
-			yyVAL.Expr = &FateDiceExpr{Count: yyDollar[1].Expr, process: "", rolls: nil}
+			yyVAL.Expr = &DiceExpr{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: nil}
 		}
 	case 43:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.y:252
+		{
+			yyVAL.Expr = &DiceExpr{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: yyDollar[5].Expr, Keep: nil}
+		}
+	case 44:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.y:256
+		{
+			yyVAL.Expr = &DiceExpr{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: yyDollar[5].Expr}
+		}
+	case 45:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.y:260
+		{
+			yyVAL.Expr = &DiceExpr{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr, Sides: yyDollar[3].Expr, Drop: nil, Keep: nil}
+		}
+	case 46:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.y:264
+		{
+			yyVAL.Expr = &PenaltyBonusDiceExpr{Node: Node{yyDollar[4].Pos}, IsBonus: false, Count: yyDollar[5].Expr}
+		}
+	case 47:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.y:268
+		{
+			yyVAL.Expr = &PenaltyBonusDiceExpr{Node: Node{yyDollar[4].Pos}, IsBonus: true, Count: yyDollar[5].Expr}
+		}
+	case 48:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:272
+		{
+			yyVAL.Expr = withExplode(yylex, yyDollar[1].Expr, ExplodeNormal, nil)
+		}
+	case 49:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:276
+		{
+			yyVAL.Expr = withExplode(yylex, yyDollar[1].Expr, ExplodeNormal, yyDollar[3].Point)
+		}
+	case 50:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:280
+		{
+			yyVAL.Expr = withExplode(yylex, yyDollar[1].Expr, ExplodeCompound, nil)
+		}
+	case 51:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:284
+		{
+			yyVAL.Expr = withExplode(yylex, yyDollar[1].Expr, ExplodeCompound, yyDollar[3].Point)
+		}
+	case 52:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:288
+		{
+			yyVAL.Expr = withExplode(yylex, yyDollar[1].Expr, ExplodePenetrate, nil)
+		}
+	case 53:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:292
+		{
+			yyVAL.Expr = withExplode(yylex, yyDollar[1].Expr, ExplodePenetrate, yyDollar[3].Point)
+		}
+	case 54:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:296
+		{
+			yyVAL.Expr = withReroll(yylex, yyDollar[1].Expr, false, yyDollar[3].Point)
+		}
+	case 55:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:300
+		{
+			yyVAL.Expr = withReroll(yylex, yyDollar[1].Expr, true, yyDollar[3].Point)
+		}
+	case 56:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:304
+		{
+			// 紧跟在骰子后的比较表示成功计数，例如 5d10>7；需要比较总和时请加括号 (5d10)>7
+			yyVAL.Expr = withSuccess(yylex, yyDollar[1].Expr, &DiceCompare{Op: GT, Target: yyDollar[3].Expr})
+		}
+	case 57:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:309
+		{
+			yyVAL.Expr = withSuccess(yylex, yyDollar[1].Expr, &DiceCompare{Op: GE, Target: yyDollar[3].Expr})
+		}
+	case 58:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:313
+		{
+			yyVAL.Expr = withSuccess(yylex, yyDollar[1].Expr, &DiceCompare{Op: LT, Target: yyDollar[3].Expr})
+		}
+	case 59:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:317
+		{
+			yyVAL.Expr = withSuccess(yylex, yyDollar[1].Expr, &DiceCompare{Op: LE, Target: yyDollar[3].Expr})
+		}
+	case 60:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:321
+		{
+			yyVAL.Expr = withSuccess(yylex, yyDollar[1].Expr, &DiceCompare{Op: EQ, Target: yyDollar[3].Expr})
+		}
+	case 61:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:325
+		{
+			yyVAL.Expr = withFailure(yylex, yyDollar[1].Expr, yyDollar[3].Point)
+		}
+	case 62:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:331
+		{
+			yyVAL.Point = &DiceCompare{Op: EQ, Target: yyDollar[1].Expr}
+		}
+	case 63:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:335
+		{
+			yyVAL.Point = &DiceCompare{Op: GT, Target: yyDollar[2].Expr}
+		}
+	case 64:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:339
+		{
+			yyVAL.Point = &DiceCompare{Op: GE, Target: yyDollar[2].Expr}
+		}
+	case 65:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.y:258
+//line parser.y:343
+		{
+			yyVAL.Point = &DiceCompare{Op: LT, Target: yyDollar[2].Expr}
+		}
+	case 66:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:347
+		{
+			yyVAL.Point = &DiceCompare{Op: LE, Target: yyDollar[2].Expr}
+		}
+	case 67:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:353
+		{
+			yyVAL.Expr = &FateDiceExpr{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr}
+		}
+	case 68:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:357
 		{
 			// 处理 df 操作符
 			if yyDollar[2].Str == "df" {
-				yyVAL.Expr = &FateDiceExpr{Count: yyDollar[1].Expr, process: "", rolls: nil}
+				yyVAL.Expr = &FateDiceExpr{Node: Node{yyDollar[2].Pos}, Count: yyDollar[1].Expr}
 			} else {
 				yylex.Error("非预期的标识符: " + yyDollar[2].Str)
 			}
 		}
-	case 44:
+	case 69:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:269
+//line parser.y:368
 		{
-			yyVAL.Expr = &PenaltyBonusDiceExpr{IsBonus: false, Count: yyDollar[3].Expr}
+			yyVAL.Expr = &PenaltyBonusDiceExpr{Node: Node{yyDollar[2].Pos}, IsBonus: false, Count: yyDollar[3].Expr}
 		}
-	case 45:
+	case 70:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:273
+//line parser.y:372
 		{
-			yyVAL.Expr = &PenaltyBonusDiceExpr{IsBonus: true, Count: yyDollar[3].Expr}
+			yyVAL.Expr = &PenaltyBonusDiceExpr{Node: Node{yyDollar[2].Pos}, IsBonus: true, Count: yyDollar[3].Expr}
 		}
-	case 46:
+	case 71:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:279
+//line parser.y:378
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        &NumberExpr{Value: 8}, // 默认成功线为8
@@ -873,11 +1053,12 @@ yydefault:
 				Sides:              &NumberExpr{Value: 10}, // 默认面数为10
 			}
 		}
-	case 47:
+	case 72:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:289
+//line parser.y:389
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        yyDollar[5].Expr,
@@ -885,11 +1066,12 @@ yydefault:
 				Sides:              &NumberExpr{Value: 10},
 			}
 		}
-	case 48:
+	case 73:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line parser.y:299
+//line parser.y:400
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        yyDollar[5].Expr,
@@ -897,11 +1079,12 @@ yydefault:
 				Sides:              yyDollar[7].Expr,
 			}
 		}
-	case 49:
+	case 74:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:309
+//line parser.y:411
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        &NumberExpr{Value: 8},
@@ -909,11 +1092,12 @@ yydefault:
 				Sides:              &NumberExpr{Value: 10},
 			}
 		}
-	case 50:
+	case 75:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line parser.y:319
+//line parser.y:422
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        &NumberExpr{Value: 8},
@@ -921,11 +1105,12 @@ yydefault:
 				Sides:              yyDollar[7].Expr,
 			}
 		}
-	case 51:
+	case 76:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line parser.y:329
+//line parser.y:433
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        yyDollar[5].Expr,
@@ -933,11 +1118,12 @@ yydefault:
 				Sides:              &NumberExpr{Value: 10},
 			}
 		}
-	case 52:
+	case 77:
 		yyDollar = yyS[yypt-9 : yypt+1]
-//line parser.y:339
+//line parser.y:444
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        yyDollar[5].Expr,
@@ -945,11 +1131,12 @@ yydefault:
 				Sides:              yyDollar[9].Expr,
 			}
 		}
-	case 53:
+	case 78:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:349
+//line parser.y:455
 		{
 			yyVAL.Expr = &InfinitePoolDiceExpr{
+				Node:               Node{yyDollar[2].Pos},
 				Initial:            yyDollar[1].Expr,
 				AddLine:            yyDollar[3].Expr,
 				SuccessLine:        &NumberExpr{Value: 8},
@@ -957,108 +1144,112 @@ yydefault:
 				Sides:              yyDollar[5].Expr,
 			}
 		}
-	case 54:
+	case 79:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:361
+//line parser.y:468
 		{
 			yyVAL.Expr = &DoubleCrossDiceExpr{
+				Node:    Node{yyDollar[2].Pos},
 				Initial: yyDollar[1].Expr,
 				AddLine: yyDollar[3].Expr,
 				Sides:   &NumberExpr{Value: 10}, // 默认面数为10
 			}
 		}
-	case 55:
+	case 80:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:369
+//line parser.y:477
 		{
 			yyVAL.Expr = &DoubleCrossDiceExpr{
+				Node:    Node{yyDollar[2].Pos},
 				Initial: yyDollar[1].Expr,
 				AddLine: yyDollar[3].Expr,
 				Sides:   yyDollar[5].Expr,
 			}
 		}
-	case 56:
+	case 81:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:379
+//line parser.y:488
 		{
 			yyVAL.Expr = &HighLowSelectExpr{
+				Node:     Node{yyDollar[2].Pos},
 				Expr:     yyDollar[1].Expr,
 				Count:    yyDollar[3].Expr,
 				KeepHigh: true,
 				KeepLeft: true,
 			}
 		}
-	case 57:
+	case 82:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:388
+//line parser.y:498
 		{
 			yyVAL.Expr = &HighLowSelectExpr{
+				Node:     Node{yyDollar[2].Pos},
 				Expr:     yyDollar[1].Expr,
 				Count:    yyDollar[3].Expr,
 				KeepHigh: false,
 				KeepLeft: true,
 			}
 		}
-	case 58:
+	case 83:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:399
+//line parser.y:510
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
-	case 59:
+	case 84:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:405
+//line parser.y:516
 		{
-			yyVAL.Expr = &NumberExpr{yyDollar[1].Num}
+			yyVAL.Expr = &NumberExpr{Value: yyDollar[1].Num}
 		}
-	case 60:
+	case 85:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:409
+//line parser.y:520
 		{
-			yyVAL.Expr = &IdentExpr{yyDollar[1].Str}
+			yyVAL.Expr = &IdentExpr{Node: Node{yyDollar[1].Pos}, Name: yyDollar[1].Str}
 		}
-	case 61:
+	case 86:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:413
+//line parser.y:524
 		{
 			yyVAL.Expr = yyDollar[2].Expr
 		}
-	case 62:
+	case 87:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:417
+//line parser.y:528
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
-	case 63:
+	case 88:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:423
+//line parser.y:534
 		{
 			if arr, ok := yyDollar[2].Expr.(*ArrayExpr); ok {
 				yyVAL.Expr = arr
 			} else {
-				yyVAL.Expr = &ArrayExpr{[]Expr{yyDollar[2].Expr}}
+				yyVAL.Expr = &ArrayExpr{Elements: []Expr{yyDollar[2].Expr}}
 			}
 		}
-	case 64:
+	case 89:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:433
+//line parser.y:544
 		{
-			yyVAL.Expr = &ArrayExpr{[]Expr{yyDollar[1].Expr}}
+			yyVAL.Expr = &ArrayExpr{Elements: []Expr{yyDollar[1].Expr}}
 		}
-	case 65:
+	case 90:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:437
+//line parser.y:548
 		{
 			if arr, ok := yyDollar[1].Expr.(*ArrayExpr); ok {
 				arr.Elements = append(arr.Elements, yyDollar[3].Expr)
 				yyVAL.Expr = arr
 			} else {
-				yyVAL.Expr = &ArrayExpr{[]Expr{yyDollar[1].Expr, yyDollar[3].Expr}}
+				yyVAL.Expr = &ArrayExpr{Elements: []Expr{yyDollar[1].Expr, yyDollar[3].Expr}}
 			}
 		}
-	case 66:
+	case 91:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:448
+//line parser.y:559
 		{
 			yyVAL.Expr = yyDollar[1].Expr
 		}
@@ -18,6 +18,9 @@ var _ = fmt.Println
 // 特殊操作符
 %token MAX MIN
 
+// 骰子修饰符: ! 爆炸、!! 累加爆炸、!p 穿透爆炸、r 重骰、ro 重骰一次
+%token EXPLODE COMPOUND PENETRATE REROLL REROLL_ONCE
+
 // 基本操作符
 %token ADD SUB MUL DIV MOD RPAREN LBRACKET RBRACKET BITAND BITOR
 %token COMMA GT LT GE LE EQ NEQ QUESTION COLON SEMICOLON HASH LBRACE RBRACE CIRCUMFLEX ASSIGN
@@ -25,6 +28,8 @@ var _ = fmt.Println
 // 组合操作符 kh, kl
 %token KL KH
 
+// 骰子后紧跟比较运算符时优先作为修饰符（成功计数、爆炸条件）
+%nonassoc DICE_MODIFIER
 %left GT LT GE LE EQ NEQ
 %left BITAND BITOR
 %left ADD SUB
@@ -38,6 +43,7 @@ var _ = fmt.Println
 %type <StmtList> program stmtlist
 %type <Stmt> stmt
 %type <Expr> expr term factor dice_expr fate_expr bonus_expr infinite_pool_expr double_cross_expr array_expr array_item array_items high_low_expr
+%type <Point> dice_point
 %type <Expr> bitwise_expr compare_expr condition_expr additive_expr mult_expr power_expr special_expr unary_expr
 
 %start program
@@ -46,20 +52,10 @@ var _ = fmt.Println
 
 program: stmtlist
     {
-        var result interface{}
-        var process string = ""
-        for _, stmt := range $1 {
-            if stmt != nil {
-                // 获取表达式结果
-                result = stmt.Evaluate()
-                
-                // 获取投掷过程
-                if exprStmt, ok := stmt.(*ExprStmt); ok {
-                    process = exprStmt.GetProcess()
-                }
-            }
+        // 只构建语法树，求值由 Program.Evaluate 在独立的上下文中完成
+        if receiver, ok := yylex.(programReceiver); ok {
+            receiver.setProgram($1)
         }
-        SetResult(result, process)  // 保存计算结果和过程
         $$ = $1
     }
 ;
@@ -76,7 +72,12 @@ stmtlist: stmt
 
 stmt: expr
     {
-        $$ = &ExprStmt{$1}
+        $$ = &ExprStmt{Expr: $1}
+    }
+    | factor HASH expr
+    {
+        // 重复掷骰，例如 6#3d6
+        $$ = &RepeatBlockStmt{Node: Node{$<Pos>2}, Count: $1, Block: []Stmt{&ExprStmt{Expr: $3}}}
     }
 ;
 
@@ -102,11 +103,11 @@ bitwise_expr: compare_expr
     }
     | bitwise_expr BITAND compare_expr
     {
-        $$ = &BitwiseExpr{$1, $3, true}
+        $$ = &BitwiseExpr{Node: Node{$<Pos>2}, Left: $1, Right: $3, IsAnd: true}
     }
     | bitwise_expr BITOR compare_expr
     {
-        $$ = &BitwiseExpr{$1, $3, false}
+        $$ = &BitwiseExpr{Node: Node{$<Pos>2}, Left: $1, Right: $3, IsAnd: false}
     }
 ;
 
@@ -116,11 +117,27 @@ compare_expr: additive_expr
     }
     | compare_expr GT additive_expr
     {
-        $$ = &CompareExpr{$1, $3, true}
+        $$ = &CompareExpr{Node: Node{$<Pos>2}, Left: $1, Right: $3, IsGreater: true}
     }
     | compare_expr LT additive_expr
     {
-        $$ = &CompareExpr{$1, $3, false}
+        $$ = &CompareExpr{Node: Node{$<Pos>2}, Left: $1, Right: $3, IsGreater: false}
+    }
+    | compare_expr GE additive_expr
+    {
+        $$ = &ComparisonExpr{Node: Node{$<Pos>2}, Left: $1, Op: GE, Right: $3}
+    }
+    | compare_expr LE additive_expr
+    {
+        $$ = &ComparisonExpr{Node: Node{$<Pos>2}, Left: $1, Op: LE, Right: $3}
+    }
+    | compare_expr EQ additive_expr
+    {
+        $$ = &ComparisonExpr{Node: Node{$<Pos>2}, Left: $1, Op: EQ, Right: $3}
+    }
+    | compare_expr NEQ additive_expr
+    {
+        $$ = &ComparisonExpr{Node: Node{$<Pos>2}, Left: $1, Op: NEQ, Right: $3}
     }
 ;
 
@@ -130,11 +147,11 @@ additive_expr: mult_expr
     }
     | additive_expr ADD mult_expr
     {
-        $$ = &BinaryExpr{$1, ADD, $3}
+        $$ = &BinaryExpr{Node: Node{$<Pos>2}, Left: $1, Op: ADD, Right: $3}
     }
     | additive_expr SUB mult_expr
     {
-        $$ = &BinaryExpr{$1, SUB, $3}
+        $$ = &BinaryExpr{Node: Node{$<Pos>2}, Left: $1, Op: SUB, Right: $3}
     }
 ;
 
@@ -144,15 +161,15 @@ mult_expr: power_expr
     }
     | mult_expr MUL power_expr
     {
-        $$ = &BinaryExpr{$1, MUL, $3}
+        $$ = &BinaryExpr{Node: Node{$<Pos>2}, Left: $1, Op: MUL, Right: $3}
     }
     | mult_expr DIV power_expr
     {
-        $$ = &BinaryExpr{$1, DIV, $3}
+        $$ = &BinaryExpr{Node: Node{$<Pos>2}, Left: $1, Op: DIV, Right: $3}
     }
     | mult_expr MOD power_expr
     {
-        $$ = &BinaryExpr{$1, MOD, $3}
+        $$ = &BinaryExpr{Node: Node{$<Pos>2}, Left: $1, Op: MOD, Right: $3}
     }
 ;
 
@@ -162,7 +179,7 @@ power_expr: special_expr
     }
     | power_expr CIRCUMFLEX special_expr
     {
-        $$ = &BinaryExpr{$1, CIRCUMFLEX, $3}
+        $$ = &BinaryExpr{Node: Node{$<Pos>2}, Left: $1, Op: CIRCUMFLEX, Right: $3}
     }
 ;
 
@@ -172,15 +189,15 @@ special_expr: term
     }
     | special_expr MAX term
     {
-        $$ = &MaxMinExpr{$1, $3, true}
+        $$ = &MaxMinExpr{Node: Node{$<Pos>2}, Expr: $1, Limit: $3, IsMax: true}
     }
     | special_expr MIN term
     {
-        $$ = &MaxMinExpr{$1, $3, false}
+        $$ = &MaxMinExpr{Node: Node{$<Pos>2}, Expr: $1, Limit: $3, IsMax: false}
     }
 ;
 
-term: dice_expr 
+term: dice_expr %prec DICE_MODIFIER
     { 
         $$ = $1
     }
@@ -210,55 +227,137 @@ term: dice_expr
     }
     | term KH factor
     {
-        $$ = &HighLowSelectExpr{$1, $3, true, true}
+        $$ = &HighLowSelectExpr{Node: Node{$<Pos>2}, Expr: $1, Count: $3, KeepHigh: true, KeepLeft: true}
     }
     | term KL factor
     {
-        $$ = &HighLowSelectExpr{$1, $3, false, true}
+        $$ = &HighLowSelectExpr{Node: Node{$<Pos>2}, Expr: $1, Count: $3, KeepHigh: false, KeepLeft: true}
     }
 ;
 
 dice_expr: factor D factor
     {
-        fmt.Printf("解析骰点表达式: %v d %v\n", $1, $3)
-        $$ = &DiceExpr{Count: $1, Sides: $3, Drop: nil, Keep: nil, process: "", rolls: nil}
+        $$ = &DiceExpr{Node: Node{$<Pos>2}, Count: $1, Sides: $3, Drop: nil, Keep: nil}
+    }
+    | D factor
+    {
+        // 省略个数时默认掷一个，例如 d20
+        $$ = &DiceExpr{Node: Node{$<Pos>1}, Count: &NumberExpr{Value: 1}, Sides: $2, Drop: nil, Keep: nil}
     }
     | dice_expr D factor
     {
-        fmt.Printf("解析连续骰点表达式: %v d %v\n", $1, $3)
-        $$ = &DiceExpr{Count: $1, Sides: $3, Drop: nil, Keep: nil, process: "", rolls: nil}
+        $$ = &DiceExpr{Node: Node{$<Pos>2}, Count: $1, Sides: $3, Drop: nil, Keep: nil}
     }
     | factor D factor A factor
     {
-        $$ = &DiceExpr{Count: $1, Sides: $3, Drop: $5, Keep: nil, process: "", rolls: nil}
+        $$ = &DiceExpr{Node: Node{$<Pos>2}, Count: $1, Sides: $3, Drop: $5, Keep: nil}
     }
     | factor D factor K factor
     {
-        $$ = &DiceExpr{Count: $1, Sides: $3, Drop: nil, Keep: $5, process: "", rolls: nil}
+        $$ = &DiceExpr{Node: Node{$<Pos>2}, Count: $1, Sides: $3, Drop: nil, Keep: $5}
     }
     | factor D factor Q factor
     {
-        $$ = &DiceExpr{Count: $1, Sides: $3, Drop: nil, Keep: nil, process: "", rolls: nil}
+        $$ = &DiceExpr{Node: Node{$<Pos>2}, Count: $1, Sides: $3, Drop: nil, Keep: nil}
     }
     | factor D factor P factor
     {
-        $$ = &PenaltyBonusDiceExpr{IsBonus: false, Count: $5}
+        $$ = &PenaltyBonusDiceExpr{Node: Node{$<Pos>4}, IsBonus: false, Count: $5}
     }
     | factor D factor B factor
     {
-        $$ = &PenaltyBonusDiceExpr{IsBonus: true, Count: $5}
+        $$ = &PenaltyBonusDiceExpr{Node: Node{$<Pos>4}, IsBonus: true, Count: $5}
+    }
+    | dice_expr EXPLODE %prec DICE_MODIFIER
+    {
+        $$ = withExplode(yylex, $1, ExplodeNormal, nil)
+    }
+    | dice_expr EXPLODE dice_point
+    {
+        $$ = withExplode(yylex, $1, ExplodeNormal, $3)
+    }
+    | dice_expr COMPOUND %prec DICE_MODIFIER
+    {
+        $$ = withExplode(yylex, $1, ExplodeCompound, nil)
+    }
+    | dice_expr COMPOUND dice_point
+    {
+        $$ = withExplode(yylex, $1, ExplodeCompound, $3)
+    }
+    | dice_expr PENETRATE %prec DICE_MODIFIER
+    {
+        $$ = withExplode(yylex, $1, ExplodePenetrate, nil)
+    }
+    | dice_expr PENETRATE dice_point
+    {
+        $$ = withExplode(yylex, $1, ExplodePenetrate, $3)
+    }
+    | dice_expr REROLL dice_point
+    {
+        $$ = withReroll(yylex, $1, false, $3)
+    }
+    | dice_expr REROLL_ONCE dice_point
+    {
+        $$ = withReroll(yylex, $1, true, $3)
+    }
+    | dice_expr GT factor
+    {
+        // 紧跟在骰子后的比较表示成功计数，例如 5d10>7；需要比较总和时请加括号 (5d10)>7
+        $$ = withSuccess(yylex, $1, &DiceCompare{Op: GT, Target: $3})
+    }
+    | dice_expr GE factor
+    {
+        $$ = withSuccess(yylex, $1, &DiceCompare{Op: GE, Target: $3})
+    }
+    | dice_expr LT factor
+    {
+        $$ = withSuccess(yylex, $1, &DiceCompare{Op: LT, Target: $3})
+    }
+    | dice_expr LE factor
+    {
+        $$ = withSuccess(yylex, $1, &DiceCompare{Op: LE, Target: $3})
+    }
+    | dice_expr EQ factor
+    {
+        $$ = withSuccess(yylex, $1, &DiceCompare{Op: EQ, Target: $3})
+    }
+    | dice_expr F dice_point
+    {
+        $$ = withFailure(yylex, $1, $3)
+    }
+;
+
+dice_point: factor
+    {
+        $$ = &DiceCompare{Op: EQ, Target: $1}
+    }
+    | GT factor
+    {
+        $$ = &DiceCompare{Op: GT, Target: $2}
+    }
+    | GE factor
+    {
+        $$ = &DiceCompare{Op: GE, Target: $2}
+    }
+    | LT factor
+    {
+        $$ = &DiceCompare{Op: LT, Target: $2}
+    }
+    | LE factor
+    {
+        $$ = &DiceCompare{Op: LE, Target: $2}
     }
 ;
 
 fate_expr: factor F
     {
-        $$ = &FateDiceExpr{Count: $1, process: "", rolls: nil}
+        $$ = &FateDiceExpr{Node: Node{$<Pos>2}, Count: $1}
     }
     | factor IDENT
     {
         // 处理 df 操作符
         if $2 == "df" {
-            $$ = &FateDiceExpr{Count: $1, process: "", rolls: nil}
+            $$ = &FateDiceExpr{Node: Node{$<Pos>2}, Count: $1}
         } else {
             yylex.Error("非预期的标识符: " + $2)
         }
@@ -267,17 +366,18 @@ fate_expr: factor F
 
 bonus_expr: factor P factor
     {
-        $$ = &PenaltyBonusDiceExpr{IsBonus: false, Count: $3}
+        $$ = &PenaltyBonusDiceExpr{Node: Node{$<Pos>2}, IsBonus: false, Count: $3}
     }
     | factor B factor
     {
-        $$ = &PenaltyBonusDiceExpr{IsBonus: true, Count: $3}
+        $$ = &PenaltyBonusDiceExpr{Node: Node{$<Pos>2}, IsBonus: true, Count: $3}
     }
 ;
 
 infinite_pool_expr: factor A factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        &NumberExpr{Value: 8}, // 默认成功线为8
@@ -288,6 +388,7 @@ infinite_pool_expr: factor A factor
     | factor A factor K factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        $5,
@@ -298,6 +399,7 @@ infinite_pool_expr: factor A factor
     | factor A factor K factor M factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        $5,
@@ -308,6 +410,7 @@ infinite_pool_expr: factor A factor
     | factor A factor Q factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        &NumberExpr{Value: 8},
@@ -318,6 +421,7 @@ infinite_pool_expr: factor A factor
     | factor A factor Q factor M factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        &NumberExpr{Value: 8},
@@ -328,6 +432,7 @@ infinite_pool_expr: factor A factor
     | factor A factor K factor Q factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        $5,
@@ -338,6 +443,7 @@ infinite_pool_expr: factor A factor
     | factor A factor K factor Q factor M factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        $5,
@@ -348,6 +454,7 @@ infinite_pool_expr: factor A factor
     | factor A factor M factor
     {
         $$ = &InfinitePoolDiceExpr{
+            Node:               Node{$<Pos>2},
             Initial:            $1,
             AddLine:            $3,
             SuccessLine:        &NumberExpr{Value: 8},
@@ -360,6 +467,7 @@ infinite_pool_expr: factor A factor
 double_cross_expr: factor C factor
     {
         $$ = &DoubleCrossDiceExpr{
+            Node:    Node{$<Pos>2},
             Initial: $1,
             AddLine: $3,
             Sides:   &NumberExpr{Value: 10}, // 默认面数为10
@@ -368,6 +476,7 @@ double_cross_expr: factor C factor
     | factor C factor M factor
     {
         $$ = &DoubleCrossDiceExpr{
+            Node:    Node{$<Pos>2},
             Initial: $1,
             AddLine: $3,
             Sides:   $5,
@@ -378,6 +487,7 @@ double_cross_expr: factor C factor
 high_low_expr: factor KH factor
     {
         $$ = &HighLowSelectExpr{
+            Node:     Node{$<Pos>2},
             Expr:     $1,
             Count:    $3,
             KeepHigh: true,
@@ -387,6 +497,7 @@ high_low_expr: factor KH factor
     | factor KL factor
     {
         $$ = &HighLowSelectExpr{
+            Node:     Node{$<Pos>2},
             Expr:     $1,
             Count:    $3,
             KeepHigh: false,
@@ -403,11 +514,11 @@ unary_expr: factor
 
 factor: NUMBER
     {
-        $$ = &NumberExpr{$1}
+        $$ = &NumberExpr{Value: $1}
     }
     | IDENT
     {
-        $$ = &IdentExpr{$1}
+        $$ = &IdentExpr{Node: Node{$<Pos>1}, Name: $1}
     }
     | LPAREN expr RPAREN
     {
@@ -424,14 +535,14 @@ array_expr: LBRACKET array_items RBRACKET
         if arr, ok := $2.(*ArrayExpr); ok {
             $$ = arr
         } else {
-            $$ = &ArrayExpr{[]Expr{$2}}
+            $$ = &ArrayExpr{Elements: []Expr{$2}}
         }
     }
 ;
 
 array_items: array_item
     {
-        $$ = &ArrayExpr{[]Expr{$1}}
+        $$ = &ArrayExpr{Elements: []Expr{$1}}
     }
     | array_items COMMA array_item
     {
@@ -439,7 +550,7 @@ array_items: array_item
             arr.Elements = append(arr.Elements, $3)
             $$ = arr
         } else {
-            $$ = &ArrayExpr{[]Expr{$1, $3}}
+            $$ = &ArrayExpr{Elements: []Expr{$1, $3}}
         }
     }
 ;
@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"island/rng"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentEval 多个群同时掷骰时，结果和变量不能互相串扰
+func TestConcurrentEval(t *testing.T) {
+	const workers = 32
+	const rounds = 200
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			ctx := NewContext()
+			ctx.Variables["x"] = w
+			expr := fmt.Sprintf("%dd1+x", w+1)
+			wantProcess := fmt.Sprintf("%dd1 = ", w+1)
+
+			for i := 0; i < rounds; i++ {
+				res, err := ctx.Eval(expr)
+				if err != nil {
+					errs <- fmt.Errorf("%s: %v", expr, err)
+					return
+				}
+				if res.Value != 2*w+1 {
+					errs <- fmt.Errorf("%s = %v, want %d", expr, res.Value, 2*w+1)
+					return
+				}
+				if !strings.HasPrefix(res.Process, wantProcess) {
+					errs <- fmt.Errorf("%s process = %q, want prefix %q", expr, res.Process, wantProcess)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestSharedProgram 同一棵语法树可以在多个上下文中并发求值
+func TestSharedProgram(t *testing.T) {
+	program, err := ParseProgram("4d6kh3+2d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*Result, 64)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := program.Evaluate(NewContext())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		v, ok := res.Value.(int)
+		if !ok || v < 5 || v > 20 {
+			t.Errorf("4d6kh3+2d1 = %v, want 5..20", res.Value)
+		}
+		if strings.Count(res.Process, ";") != 1 {
+			t.Errorf("process = %q, want exactly two parts", res.Process)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	if _, err := ParseProgram("3d6+"); err == nil || !strings.Contains(err.Error(), "第 5 个字符") {
+		t.Errorf("ParseProgram(3d6+) error = %v, want position 5", err)
+	}
+}
+
+// TestEvalErrors 求值错误应带有类型和出错位置，而不是 panic 或返回 0
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  error
+		msg   string
+	}{
+		{"10d6/0", ErrDivisionByZero, "第 5 个字符: 除数为零"},
+		{"7%(1-1)", ErrDivisionByZero, "第 2 个字符: 除数为零"},
+		{"2d0", ErrInvalidSides, "第 2 个字符: 骰子面数无效: 0"},
+		{"1d6+hp", ErrUndefinedVariable, "第 5 个字符: 未定义的变量: hp"},
+		{"2000000000d6", ErrTooManyDice, "第 11 个字符: 骰子数量过多"},
+		{"3d2000000000", ErrTooManySides, "第 2 个字符: 骰子面数过多"},
+		{"1a1m1", ErrIterationLimit, "第 2 个字符: 迭代次数超过上限"},
+		{"(0-3)d6", ErrInvalidCount, "第 6 个字符: 骰子数量不能为负数: -3"},
+		{"(0-1)df", ErrInvalidCount, "第 6 个字符: 骰子数量不能为负数: -1"},
+		{"1d100b(0-1)", ErrInvalidCount, "第 6 个字符: 骰子数量不能为负数: -1"},
+		{"1d100p11", ErrTooManyDice, "第 6 个字符: 骰子数量过多: 奖励骰和惩罚骰的上限为 10"},
+	}
+
+	for _, tt := range tests {
+		_, err := Eval(tt.input)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Eval(%q) error = %v, want %v", tt.input, err, tt.want)
+			continue
+		}
+		var evalErr *EvalError
+		if !errors.As(err, &evalErr) || !strings.HasPrefix(err.Error(), tt.msg) {
+			t.Errorf("Eval(%q) error = %q, want prefix %q", tt.input, err, tt.msg)
+		}
+	}
+}
+
+// TestRepeat N#表达式 独立求值 N 次，并分别给出结果和过程
+func TestRepeat(t *testing.T) {
+	res, err := NewContextWithSource(rng.NewReplayValues(0, 1, 2, 3, 4, 5)).Eval("3#2d6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2d6 = [1 2] = 3", "2d6 = [3 4] = 7", "2d6 = [5 6] = 11"}
+	if len(res.Repeats) != len(want) {
+		t.Fatalf("got %d repeats, want %d", len(res.Repeats), len(want))
+	}
+	for i, r := range res.Repeats {
+		if r.Process != want[i] {
+			t.Errorf("repeat %d process = %q, want %q", i+1, r.Process, want[i])
+		}
+	}
+	if got := FormatValue(res.Value); got != "[3, 7, 11]" {
+		t.Errorf("value = %s, want [3, 7, 11]", got)
+	}
+
+	if _, err := Eval(fmt.Sprintf("%d#1d6", MAX_ITERATIONS+1)); !errors.Is(err, ErrIterationLimit) {
+		t.Errorf("repeat over the limit: error = %v", err)
+	}
+	if _, err := Eval("0#1d6"); !errors.Is(err, ErrInvalidRepeat) {
+		t.Errorf("repeat zero times: error = %v", err)
+	}
+}
+
+// TestFormatArrayValue 格式化数组时使用已经算好的值，不会再次掷骰
+func TestFormatArrayValue(t *testing.T) {
+	if got := FormatValue(&ArrayExpr{Elements: intSliceToExprSlice([]int{3, 7, 11})}); got != "[3 7 11]" {
+		t.Errorf("array value = %s, want [3 7 11]", got)
+	}
+	program, err := ParseProgram("[1d6,2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	array := program.Stmts[0].(*ExprStmt).Expr
+	if got := FormatValue(array); got != "[1d6,2]" {
+		t.Errorf("unevaluated array = %s, want [1d6,2]", got)
+	}
+}
@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Die 单个骰子的结果
+type Die struct {
+	Sides    int  `json:"sides"`              // 面数，FATE 骰为 3（取值 -1/0/1）
+	Value    int  `json:"value"`              // 点数
+	Dropped  bool `json:"dropped,omitempty"`  // 是否被舍弃（kh/kl、奖惩骰、重骰等）
+	Exploded bool `json:"exploded,omitempty"` // 是否触发了爆炸
+	Rerolled bool `json:"rerolled,omitempty"` // 是否因重骰被替换
+	Success  bool `json:"success,omitempty"`  // 成功计数中算作成功
+	Failure  bool `json:"failure,omitempty"`  // 成功计数中算作失败
+}
+
+// TraceNode 表达式求值过程中的一个节点，组成与语法树对应的求值树
+type TraceNode struct {
+	Kind     string       `json:"kind"`               // 节点类型，例如 dice、arithmetic
+	Expr     string       `json:"expr"`               // 节点对应的表达式文本
+	Pos      int          `json:"pos,omitempty"`      // 节点在源表达式中的字符位置
+	Value    interface{}  `json:"value"`              // 节点的计算结果
+	Dice     []Die        `json:"dice,omitempty"`     // 本节点掷出的骰子
+	Detail   string       `json:"detail,omitempty"`   // 投掷过程文本
+	Warnings []string     `json:"warnings,omitempty"` // 求值时的警告
+	Children []*TraceNode `json:"children,omitempty"` // 子表达式
+}
+
+// Details 按求值顺序收集所有节点的投掷过程文本
+func (n *TraceNode) Details() []string {
+	if n == nil {
+		return nil
+	}
+
+	var details []string
+	if n.Detail != "" {
+		details = append(details, n.Detail)
+	}
+	for _, child := range n.Children {
+		details = append(details, child.Details()...)
+	}
+	return details
+}
+
+// traceValue 将计算结果转换为便于序列化的值
+func traceValue(value interface{}) interface{} {
+	if arr, ok := value.(*ArrayExpr); ok {
+		if values, ok := arr.values(); ok {
+			return values
+		}
+		return ExprString(arr)
+	}
+	return value
+}
+
+// exprKind 返回表达式在求值树中的节点类型
+func exprKind(expr Expr) string {
+	switch e := expr.(type) {
+	case *NumberExpr:
+		return "number"
+	case *IdentExpr:
+		return "variable"
+	case *BinaryExpr, *UnaryExpr:
+		return "arithmetic"
+	case *DiceExpr, *HighestDiceExpr, *LowestDiceExpr:
+		return "dice"
+	case *FateDiceExpr:
+		return "fate"
+	case *PenaltyBonusDiceExpr:
+		if e.IsBonus {
+			return "bonus"
+		}
+		return "penalty"
+	case *InfinitePoolDiceExpr:
+		return "pool"
+	case *DoubleCrossDiceExpr:
+		return "double_cross"
+	case *HighLowSelectExpr:
+		return "select"
+	case *MaxMinExpr:
+		return "limit"
+	case *CompareExpr, *ComparisonExpr:
+		return "compare"
+	case *BitwiseExpr:
+		return "bitwise"
+	case *TernaryExpr:
+		return "ternary"
+	case *ArrayExpr, *SliceExpr, *ProjectionExpr:
+		return "array"
+	case *RepeatBlockStmt:
+		return "repeat"
+	}
+	return "expr"
+}
+
+// ExprString 将语法树还原为表达式文本
+func ExprString(expr Expr) string {
+	switch e := expr.(type) {
+	case nil:
+		return ""
+	case *NumberExpr:
+		return strconv.Itoa(e.Value)
+	case *IdentExpr:
+		return e.Name
+	case *BinaryExpr:
+		return wrapOperand(e.Left, e) + opString(e.Op) + wrapOperand(e.Right, e)
+	case *UnaryExpr:
+		return "-" + wrapOperand(e.Expr, e)
+	case *DiceExpr:
+		return wrapOperand(e.Count, e) + "d" + wrapOperand(e.Sides, e) + e.modifierString()
+	case *HighestDiceExpr:
+		return wrapOperand(e.Count, e) + "d" + wrapOperand(e.Sides, e) + "h" + wrapOperand(e.Keep, e)
+	case *LowestDiceExpr:
+		return wrapOperand(e.Count, e) + "d" + wrapOperand(e.Sides, e) + "l" + wrapOperand(e.Keep, e)
+	case *FateDiceExpr:
+		return wrapOperand(e.Count, e) + "df"
+	case *PenaltyBonusDiceExpr:
+		op := "p"
+		if e.IsBonus {
+			op = "b"
+		}
+		return "1" + op + wrapOperand(e.Count, e)
+	case *InfinitePoolDiceExpr:
+		s := wrapOperand(e.Initial, e) + "a" + wrapOperand(e.AddLine, e)
+		if e.SuccessLine != nil {
+			s += "k" + wrapOperand(e.SuccessLine, e)
+		}
+		if e.ReverseSuccessLine != nil {
+			s += "q" + wrapOperand(e.ReverseSuccessLine, e)
+		}
+		if e.Sides != nil {
+			s += "m" + wrapOperand(e.Sides, e)
+		}
+		return s
+	case *DoubleCrossDiceExpr:
+		s := wrapOperand(e.Initial, e) + "c" + wrapOperand(e.AddLine, e)
+		if e.Sides != nil {
+			s += "m" + wrapOperand(e.Sides, e)
+		}
+		return s
+	case *HighLowSelectExpr:
+		op := "kl"
+		if e.KeepHigh {
+			op = "kh"
+		}
+		return wrapOperand(e.Expr, e) + op + wrapOperand(e.Count, e)
+	case *MaxMinExpr:
+		op := "min"
+		if e.IsMax {
+			op = "max"
+		}
+		return wrapOperand(e.Expr, e) + op + wrapOperand(e.Limit, e)
+	case *CompareExpr:
+		op := "<"
+		if e.IsGreater {
+			op = ">"
+		}
+		return wrapOperand(e.Left, e) + op + wrapOperand(e.Right, e)
+	case *ComparisonExpr:
+		return wrapOperand(e.Left, e) + opString(e.Op) + wrapOperand(e.Right, e)
+	case *BitwiseExpr:
+		op := "|"
+		if e.IsAnd {
+			op = "&"
+		}
+		return wrapOperand(e.Left, e) + op + wrapOperand(e.Right, e)
+	case *TernaryExpr:
+		return ExprString(e.Condition) + "?" + ExprString(e.TrueExpr) + ":" + ExprString(e.FalseExpr)
+	case *ArrayExpr:
+		elems := make([]string, len(e.Elements))
+		for i, elem := range e.Elements {
+			elems[i] = ExprString(elem)
+		}
+		return "[" + strings.Join(elems, ",") + "]"
+	case *SliceExpr:
+		return wrapOperand(e.Array, e) + "sp" + wrapOperand(e.SliceSpec, e)
+	case *ProjectionExpr:
+		return wrapOperand(e.Expr, e) + "tp"
+	case *RepeatBlockStmt:
+		return wrapOperand(e.Count, e) + "#" + blockString(e.Block)
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+// wrapOperand 当子表达式的优先级低于父表达式时为其加上括号
+func wrapOperand(child, parent Expr) string {
+	s := ExprString(child)
+	if precedence(child) < precedence(parent) {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// precedence 返回表达式的结合优先级，数值越大结合越紧密
+func precedence(expr Expr) int {
+	switch e := expr.(type) {
+	case *TernaryExpr:
+		return 1
+	case *BitwiseExpr:
+		return 2
+	case *CompareExpr, *ComparisonExpr:
+		return 3
+	case *BinaryExpr:
+		switch e.Op {
+		case ADD, SUB:
+			return 4
+		case MUL, DIV, MOD:
+			return 5
+		case CIRCUMFLEX:
+			return 6
+		}
+	case *MaxMinExpr, *HighLowSelectExpr:
+		return 7
+	case *DiceExpr, *HighestDiceExpr, *LowestDiceExpr, *FateDiceExpr, *PenaltyBonusDiceExpr,
+		*InfinitePoolDiceExpr, *DoubleCrossDiceExpr:
+		return 8
+	case *UnaryExpr:
+		return 9
+	}
+	return 10
+}
+
+// opString 返回运算符记号对应的文本
+func opString(op int) string {
+	switch op {
+	case ADD:
+		return "+"
+	case SUB:
+		return "-"
+	case MUL:
+		return "*"
+	case DIV:
+		return "/"
+	case MOD:
+		return "%"
+	case CIRCUMFLEX:
+		return "^"
+	case EQ:
+		return "=="
+	case NEQ:
+		return "!="
+	case GT:
+		return ">"
+	case LT:
+		return "<"
+	case GE:
+		return ">="
+	case LE:
+		return "<="
+	}
+	return "?"
+}
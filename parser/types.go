@@ -3,29 +3,21 @@ package parser
 // YySymType represents the semantic value for the parser
 type YySymType struct {
 	yys      int
+	Pos      int // 记号的字符位置，由 Lexer 设置
 	Num      int
 	Str      string
 	StmtList []Stmt
 	Stmt     Stmt
 	Expr     Expr
+	Point    *DiceCompare
 }
 
 type yySymType = YySymType
 
 // 辅助函数，将表达式的值转为整数
-func EvaluateToInt(expr Expr) int {
+func EvaluateToInt(ctx *Context, expr Expr) int {
 	if expr == nil {
 		return 0
 	}
-
-	result := expr.Evaluate()
-
-	switch v := result.(type) {
-	case int:
-		return v
-	case float64:
-		return int(v)
-	default:
-		return 0
-	}
+	return ctx.evalInt(expr)
 }
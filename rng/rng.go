@@ -0,0 +1,154 @@
+// Package rng 提供骰子引擎和表达式解析器使用的随机数来源
+package rng
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	mrand "math/rand"
+	"sync"
+)
+
+// Source 随机数来源，所有实现都可以被多个 goroutine 同时使用
+type Source interface {
+	// Intn 返回 [0, n) 范围内的随机整数，n 必须大于 0
+	Intn(n int) int
+}
+
+// Draw 一次随机数抽取的记录
+type Draw struct {
+	N     int `json:"n"`     // 抽取范围 [0, N)
+	Value int `json:"value"` // 抽取结果
+}
+
+// Crypto 使用 crypto/rand 的密码学安全随机数来源
+type Crypto struct{}
+
+// NewCrypto 创建密码学安全的随机数来源
+func NewCrypto() *Crypto {
+	return &Crypto{}
+}
+
+// Intn 实现 Source 接口
+func (c *Crypto) Intn(n int) int {
+	if n <= 0 {
+		panic(fmt.Sprintf("rng: 无效的范围 %d", n))
+	}
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(fmt.Sprintf("rng: 读取系统随机数失败: %v", err))
+	}
+	return int(v.Int64())
+}
+
+// Seeded 使用固定种子的伪随机数来源，相同种子得到相同序列，用于测试
+type Seeded struct {
+	mu   sync.Mutex
+	rand *mrand.Rand
+}
+
+// NewSeeded 使用给定种子创建伪随机数来源
+func NewSeeded(seed int64) *Seeded {
+	return &Seeded{rand: mrand.New(mrand.NewSource(seed))}
+}
+
+// Intn 实现 Source 接口
+func (s *Seeded) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Intn(n)
+}
+
+// Replay 按顺序返回事先记录的抽取结果，用于复现有争议的掷骰
+type Replay struct {
+	mu    sync.Mutex
+	draws []Draw
+	next  int
+	err   error
+}
+
+// NewReplay 使用记录的抽取序列创建回放来源
+func NewReplay(draws []Draw) *Replay {
+	return &Replay{draws: draws}
+}
+
+// NewReplayValues 只按数值回放，不检查抽取范围，方便编写测试
+func NewReplayValues(values ...int) *Replay {
+	draws := make([]Draw, len(values))
+	for i, v := range values {
+		draws[i] = Draw{Value: v}
+	}
+	return NewReplay(draws)
+}
+
+// Intn 实现 Source 接口
+// 记录用尽或抽取范围与记录不一致时返回 0，并通过 Err 报告第一个错误
+func (r *Replay) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.draws) {
+		r.setErr(fmt.Errorf("回放记录已用尽，共 %d 次抽取", len(r.draws)))
+		return 0
+	}
+	d := r.draws[r.next]
+	r.next++
+
+	if d.N != 0 && d.N != n {
+		r.setErr(fmt.Errorf("第 %d 次抽取的范围为 %d，记录为 %d", r.next, n, d.N))
+		return 0
+	}
+	if d.Value < 0 || d.Value >= n {
+		r.setErr(fmt.Errorf("第 %d 次抽取的记录值 %d 超出范围 %d", r.next, d.Value, n))
+		return 0
+	}
+	return d.Value
+}
+
+func (r *Replay) setErr(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Err 返回回放过程中的第一个错误
+func (r *Replay) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Remaining 返回尚未使用的记录数
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.draws) - r.next
+}
+
+// Recorder 包装另一个来源并记录每一次抽取，记录结果可交给 Replay 回放
+type Recorder struct {
+	mu     sync.Mutex
+	source Source
+	draws  []Draw
+}
+
+// NewRecorder 创建记录抽取过程的来源
+func NewRecorder(source Source) *Recorder {
+	return &Recorder{source: source}
+}
+
+// Intn 实现 Source 接口
+func (r *Recorder) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := r.source.Intn(n)
+	r.draws = append(r.draws, Draw{N: n, Value: v})
+	return v
+}
+
+// Draws 返回到目前为止记录的抽取序列
+func (r *Recorder) Draws() []Draw {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Draw(nil), r.draws...)
+}
@@ -0,0 +1,46 @@
+package rng
+
+import "testing"
+
+func TestSeededIsDeterministic(t *testing.T) {
+	a, b := NewSeeded(42), NewSeeded(42)
+	for i := 0; i < 100; i++ {
+		if x, y := a.Intn(100), b.Intn(100); x != y {
+			t.Fatalf("draw %d: %d != %d", i, x, y)
+		}
+	}
+}
+
+// TestRecordAndReplay 记录的抽取序列回放后得到相同的结果
+func TestRecordAndReplay(t *testing.T) {
+	rec := NewRecorder(NewCrypto())
+	var want []int
+	for _, n := range []int{6, 6, 20, 100} {
+		want = append(want, rec.Intn(n))
+	}
+
+	replay := NewReplay(rec.Draws())
+	for i, n := range []int{6, 6, 20, 100} {
+		if got := replay.Intn(n); got != want[i] {
+			t.Errorf("draw %d = %d, want %d", i, got, want[i])
+		}
+	}
+	if err := replay.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	replay := NewReplay([]Draw{{N: 6, Value: 3}})
+	replay.Intn(20)
+	if replay.Err() == nil {
+		t.Error("expected an error when the range differs from the record")
+	}
+
+	replay = NewReplayValues(1)
+	replay.Intn(6)
+	replay.Intn(6)
+	if replay.Err() == nil {
+		t.Error("expected an error when the record is exhausted")
+	}
+}
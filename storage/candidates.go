@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// loadCandidates 加载玩家最近生成的候选属性
+func (s *Storage) loadCandidates() error {
+	data, err := os.ReadFile(s.candidatesPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.candidates)
+}
+
+// saveCandidates 保存玩家最近生成的候选属性
+func (s *Storage) saveCandidates() error {
+	data, err := json.MarshalIndent(s.candidates, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.candidatesPath, data, 0644)
+}
+
+// Candidates 返回玩家在群中最近生成的候选属性，每一组为属性名到数值的映射
+func (s *Storage) Candidates(playerID, groupID int64) ([]map[string]int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates, ok := s.candidates[activeKey(playerID, groupID)]
+	return candidates, ok
+}
+
+// SetCandidates 记录玩家在群中生成的候选属性，替换之前的记录
+func (s *Storage) SetCandidates(playerID, groupID int64, candidates []map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.candidates[activeKey(playerID, groupID)] = candidates
+	return s.saveCandidates()
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// NewCardID 为玩家的新人物卡生成编号
+func NewCardID(playerID int64) string {
+	return fmt.Sprintf("%d-%d", playerID, time.Now().UnixNano())
+}
+
+// SanitySession 一个场次（游戏日）内的理智损失，用于判定不定性疯狂
+type SanitySession struct {
+	StartSan int `json:"start_san"` // 本场次第一次损失前的理智值
+	Lost     int `json:"lost"`      // 本场次累计损失的理智
+}
+
+// HitPoints 生命值上限、临时生命值和生命值归零后的状态，当前生命值保存在属性 生命值 中
+type HitPoints struct {
+	Max        int  `json:"max,omitempty"`         // 生命值上限，为 0 时 CoC7 人物卡按 (体质+体型)/10 计算
+	Temp       int  `json:"temp,omitempty"`        // DnD5E 临时生命值，受到伤害时先扣除
+	Successes  int  `json:"successes,omitempty"`   // DnD5E 死亡豁免成功次数
+	Failures   int  `json:"failures,omitempty"`    // DnD5E 死亡豁免失败次数
+	Stable     bool `json:"stable,omitempty"`      // 生命值为 0 但情况稳定
+	MajorWound bool `json:"major_wound,omitempty"` // CoC7 重伤
+	Dying      bool `json:"dying,omitempty"`       // CoC7 濒死
+	Dead       bool `json:"dead,omitempty"`
+}
+
+// Clone 复制人物卡，修改副本不会影响已保存的数据
+func (c *CharacterCard) Clone() *CharacterCard {
+	clone := *c
+	clone.Attrs = make(map[string]interface{}, len(c.Attrs))
+	for k, v := range c.Attrs {
+		clone.Attrs[k] = v
+	}
+	if c.Sanity != nil {
+		sanity := *c.Sanity
+		clone.Sanity = &sanity
+	}
+	if c.DnD != nil {
+		clone.DnD = c.DnD.Clone()
+	}
+	if c.HP != nil {
+		hp := *c.HP
+		clone.HP = &hp
+	}
+	return &clone
+}
+
+// Int 读取整数属性，从文件加载的数值为 float64
+func (c *CharacterCard) Int(name string) (int, bool) {
+	switch v := c.Attrs[name].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(math.Round(v)), true
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	}
+	return 0, false
+}
+
+// SetInt 设置整数属性
+func (c *CharacterCard) SetInt(name string, value int) {
+	if c.Attrs == nil {
+		c.Attrs = make(map[string]interface{})
+	}
+	c.Attrs[name] = value
+}
+
+// activeKey 当前人物卡按玩家和群区分，私聊的群号为 0
+func activeKey(playerID, groupID int64) string {
+	return fmt.Sprintf("%d:%d", playerID, groupID)
+}
+
+// loadActiveCards 加载玩家当前使用的人物卡
+func (s *Storage) loadActiveCards() error {
+	data, err := os.ReadFile(s.activePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.active)
+}
+
+// saveActiveCards 保存玩家当前使用的人物卡
+func (s *Storage) saveActiveCards() error {
+	data, err := json.MarshalIndent(s.active, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.activePath, data, 0644)
+}
+
+// ActiveCard 返回玩家在群中当前使用的人物卡副本，修改后需调用 SaveCard 保存
+func (s *Storage) ActiveCard(playerID, groupID int64) (*CharacterCard, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	card, ok := s.cards[s.active[activeKey(playerID, groupID)]]
+	if !ok {
+		return nil, false
+	}
+	return card.Clone(), true
+}
+
+// UpdateActiveCard 在同一次加锁中读取、修改并保存玩家在群中当前使用的人物卡，
+// 同时处理的多条指令不会互相覆盖修改。没有人物卡时使用 newCard 创建的新卡并设为当前人物卡，
+// update 返回错误时不保存
+func (s *Storage) UpdateActiveCard(playerID, groupID int64, newCard func() *CharacterCard, update func(card *CharacterCard) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := activeKey(playerID, groupID)
+	card, ok := s.cards[s.active[key]]
+	if ok {
+		card = card.Clone()
+	} else {
+		card = newCard()
+	}
+	if err := update(card); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	card.Updated = now
+	if card.Created == 0 {
+		card.Created = now
+	}
+	s.cards[card.ID] = card.Clone()
+	if err := s.saveCards(); err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	s.active[key] = card.ID
+	return s.saveActiveCards()
+}
+
+// SetActiveCard 设置玩家在群中当前使用的人物卡
+func (s *Storage) SetActiveCard(playerID, groupID int64, cardID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.cards[cardID]; !ok {
+		return fmt.Errorf("人物卡不存在: %s", cardID)
+	}
+	s.active[activeKey(playerID, groupID)] = cardID
+	return s.saveActiveCards()
+}
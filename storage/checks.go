@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// LastCheck 玩家在群中最近一次技能检定，供孤注一掷和消耗幸运使用
+type LastCheck struct {
+	Label      string `json:"label"`
+	Skill      int    `json:"skill"`
+	Difficulty int    `json:"difficulty"`
+	Bonus      int    `json:"bonus,omitempty"` // 奖励骰数量，惩罚骰为负数
+	Roll       int    `json:"roll"`
+	Level      int    `json:"level"`
+	Pushed     bool   `json:"pushed,omitempty"`     // 是否已经孤注一掷
+	LuckSpent  int    `json:"luck_spent,omitempty"` // 已经消耗的幸运
+	Time       int64  `json:"time"`
+}
+
+// loadChecks 加载玩家最近的检定
+func (s *Storage) loadChecks() error {
+	data, err := os.ReadFile(s.checksPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.checks)
+}
+
+// saveChecks 保存玩家最近的检定
+func (s *Storage) saveChecks() error {
+	data, err := json.MarshalIndent(s.checks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.checksPath, data, 0644)
+}
+
+// LastCheck 返回玩家在群中最近一次技能检定
+func (s *Storage) LastCheck(playerID, groupID int64) (LastCheck, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	check, ok := s.checks[activeKey(playerID, groupID)]
+	if !ok {
+		return LastCheck{}, false
+	}
+	return *check, true
+}
+
+// SetLastCheck 记录玩家在群中最近一次技能检定
+func (s *Storage) SetLastCheck(playerID, groupID int64, check LastCheck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if check.Time == 0 {
+		check.Time = time.Now().Unix()
+	}
+	s.checks[activeKey(playerID, groupID)] = &check
+	return s.saveChecks()
+}
@@ -0,0 +1,45 @@
+package storage
+
+// DnD5EStats DnD5E 人物卡的属性、等级、熟练项和武器
+type DnD5EStats struct {
+	Abilities   map[string]int    `json:"abilities"`             // 六项属性值，键为 str、dex、con、int、wis、cha
+	Level       int               `json:"level"`                 // 角色等级
+	Proficiency int               `json:"proficiency,omitempty"` // 熟练加值，为 0 时按等级计算
+	Skills      []string          `json:"skills,omitempty"`      // 熟练的技能
+	Expertise   []string          `json:"expertise,omitempty"`   // 专精的技能，熟练加值翻倍
+	Saves       []string          `json:"saves,omitempty"`       // 熟练的豁免，值为属性键
+	Weapons     map[string]Weapon `json:"weapons,omitempty"`
+	Resistances []string          `json:"resistances,omitempty"` // 有抗性的伤害类型，伤害减半
+	Vulnerable  []string          `json:"vulnerable,omitempty"`  // 易伤的伤害类型，伤害加倍
+	Immunities  []string          `json:"immunities,omitempty"`  // 免疫的伤害类型
+}
+
+// Weapon 人物卡中的武器，默认角色熟练该武器
+type Weapon struct {
+	Ability string `json:"ability"`          // 攻击使用的属性键，finesse 表示取力量和敏捷中较高者
+	Damage  string `json:"damage,omitempty"` // 伤害表达式，例如 1d8
+	Bonus   int    `json:"bonus,omitempty"`  // 魔法武器等额外的命中和伤害加值
+	Type    string `json:"type,omitempty"`   // 伤害类型，例如 挥砍
+}
+
+// Clone 复制 DnD5E 数据
+func (d *DnD5EStats) Clone() *DnD5EStats {
+	clone := *d
+	clone.Abilities = make(map[string]int, len(d.Abilities))
+	for k, v := range d.Abilities {
+		clone.Abilities[k] = v
+	}
+	clone.Skills = append([]string(nil), d.Skills...)
+	clone.Expertise = append([]string(nil), d.Expertise...)
+	clone.Saves = append([]string(nil), d.Saves...)
+	clone.Resistances = append([]string(nil), d.Resistances...)
+	clone.Vulnerable = append([]string(nil), d.Vulnerable...)
+	clone.Immunities = append([]string(nil), d.Immunities...)
+	if d.Weapons != nil {
+		clone.Weapons = make(map[string]Weapon, len(d.Weapons))
+		for k, v := range d.Weapons {
+			clone.Weapons[k] = v
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// GroupSettings 群设置，零值表示使用默认规则
+type GroupSettings struct {
+	CoC7Critical  int `json:"coc7_critical,omitempty"`   // 掷出不大于此值为大成功
+	CoC7Fumble    int `json:"coc7_fumble,omitempty"`     // 目标值不小于 50 时，掷出不小于此值为大失败
+	CoC7FumbleLow int `json:"coc7_fumble_low,omitempty"` // 目标值小于 50 时，掷出不小于此值为大失败
+}
+
+// loadGroups 加载群设置
+func (s *Storage) loadGroups() error {
+	data, err := os.ReadFile(s.groupsPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.groups)
+}
+
+// saveGroups 保存群设置
+func (s *Storage) saveGroups() error {
+	data, err := json.MarshalIndent(s.groups, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.groupsPath, data, 0644)
+}
+
+// GroupSettings 返回群设置的副本，没有设置过时返回零值
+func (s *Storage) GroupSettings(groupID int64) GroupSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if settings, ok := s.groups[strconv.FormatInt(groupID, 10)]; ok {
+		return *settings
+	}
+	return GroupSettings{}
+}
+
+// UpdateGroupSettings 修改并保存群设置
+func (s *Storage) UpdateGroupSettings(groupID int64, update func(settings *GroupSettings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strconv.FormatInt(groupID, 10)
+	settings, ok := s.groups[key]
+	if !ok {
+		settings = &GroupSettings{}
+		s.groups[key] = settings
+	}
+	update(settings)
+	return s.saveGroups()
+}
+
+// ReadGroupFile 读取群自定义的数据文件，依次查找 groups/<群号>/<name> 和数据目录下的 <name>
+// 两处都没有时返回的错误满足 os.IsNotExist；校验重放时只读取掷骰时记录的内容
+func (s *Storage) ReadGroupFile(groupID int64, name string) ([]byte, error) {
+	if s.groupFiles != nil {
+		data, ok := s.groupFiles[name]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "groups", strconv.FormatInt(groupID, 10), name))
+	if !os.IsNotExist(err) {
+		return data, err
+	}
+	return os.ReadFile(filepath.Join(s.dataDir, name))
+}
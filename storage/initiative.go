@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+)
+
+// Combatant 先攻列表中的一名参与者
+type Combatant struct {
+	Name       string      `json:"name"`
+	PlayerID   int64       `json:"player_id,omitempty"`  // 玩家角色的 QQ 号，NPC 为 0
+	Score      int         `json:"score"`                // 先攻值
+	Modifier   int         `json:"modifier"`             // 先攻加值，先攻值相同时加值高者在前
+	Conditions []Condition `json:"conditions,omitempty"` // 身上的状态
+}
+
+// Condition 参与者身上的状态，例如 中毒
+type Condition struct {
+	Name   string `json:"name"`
+	Rounds int    `json:"rounds,omitempty"` // 剩余轮数，在参与者的回合开始时减少，0 表示持续到移除
+}
+
+// Initiative 群内进行中的战斗，参与者按先攻值从高到低排列
+type Initiative struct {
+	Combatants []Combatant `json:"combatants"`
+	Turn       int         `json:"turn"`  // 当前行动者的下标
+	Round      int         `json:"round"` // 当前轮次，0 表示战斗尚未开始
+}
+
+// Clone 复制先攻列表
+func (i *Initiative) Clone() *Initiative {
+	clone := *i
+	clone.Combatants = append([]Combatant(nil), i.Combatants...)
+	for j := range clone.Combatants {
+		clone.Combatants[j].Conditions = append([]Condition(nil), i.Combatants[j].Conditions...)
+	}
+	return &clone
+}
+
+// loadInitiatives 加载各群的先攻列表
+func (s *Storage) loadInitiatives() error {
+	data, err := os.ReadFile(s.initiativePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.initiatives)
+}
+
+// saveInitiatives 保存各群的先攻列表
+func (s *Storage) saveInitiatives() error {
+	data, err := json.MarshalIndent(s.initiatives, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.initiativePath, data, 0644)
+}
+
+// Initiative 返回群内先攻列表的副本
+func (s *Storage) Initiative(groupID int64) (*Initiative, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	initiative, ok := s.initiatives[strconv.FormatInt(groupID, 10)]
+	if !ok {
+		return nil, false
+	}
+	return initiative.Clone(), true
+}
+
+// SetInitiative 保存群内的先攻列表，为 nil 时删除
+func (s *Storage) SetInitiative(groupID int64, initiative *Initiative) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strconv.FormatInt(groupID, 10)
+	if initiative == nil {
+		delete(s.initiatives, key)
+	} else {
+		s.initiatives[key] = initiative.Clone()
+	}
+	return s.saveInitiatives()
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"time"
+)
+
+// loadLastRollID 读取掷骰记录中最大的编号，新记录从其后继续编号
+func (s *Storage) loadLastRollID() error {
+	return s.scanRolls(func(h *RollHistory) bool {
+		if h.ID > s.lastRollID {
+			s.lastRollID = h.ID
+		}
+		return true
+	})
+}
+
+// scanRolls 按写入顺序遍历掷骰记录，fn 返回 false 时停止
+func (s *Storage) scanRolls(fn func(h *RollHistory) bool) error {
+	f, err := os.Open(s.rollsPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var h RollHistory
+		if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+			return fmt.Errorf("掷骰记录第 %d 行无效: %w", line, err)
+		}
+		if !fn(&h) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// AppendRoll 将一次掷骰追加到只增不改的掷骰记录中，并分配记录编号
+// 记录同时加入掷骰历史，历史中不保存随机数抽取序列和指令执行前的数据
+func (s *Storage) AppendRoll(h *RollHistory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h.ID = s.lastRollID + 1
+	h.Time = time.Now().Unix()
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.rollsPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.lastRollID = h.ID
+
+	entry := *h
+	entry.Draws = nil
+	entry.State = nil
+	s.history = append(s.history, entry)
+	return s.saveHistory()
+}
+
+// GetRoll 按编号查找掷骰记录
+func (s *Storage) GetRoll(id int64) (*RollHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *RollHistory
+	err := s.scanRolls(func(h *RollHistory) bool {
+		if h.ID == id {
+			found = h
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("掷骰记录不存在: #%d", id)
+	}
+	return found, nil
+}
+
+// LastRoll 返回玩家在群组中最近的一条掷骰记录
+func (s *Storage) LastRoll(playerID, groupID int64) (*RollHistory, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.history) - 1; i >= 0; i-- {
+		h := s.history[i]
+		if h.PlayerID == playerID && h.GroupID == groupID && h.ID != 0 {
+			return &h, true
+		}
+	}
+	return nil, false
+}
+
+// RollState 指令执行前保存的数据，随掷骰记录保存，校验时在这份数据上重放，
+// 之后修改人物卡、最近的检定、群设置、先攻列表或群数据文件不会使记录校验不通过
+type RollState struct {
+	Cards      map[string]*CharacterCard `json:"cards,omitempty"`      // 发送者和 @ 的玩家在群中使用的人物卡，键为 QQ 号
+	LastCheck  *LastCheck                `json:"last_check,omitempty"` // 发送者最近一次技能检定
+	Candidates []map[string]int          `json:"candidates,omitempty"` // 发送者最近生成的候选属性
+	Settings   *GroupSettings            `json:"settings,omitempty"`   // 群设置
+	Initiative *Initiative               `json:"initiative,omitempty"` // 群内的先攻列表
+	Files      map[string]string         `json:"files,omitempty"`      // 群自定义的数据文件内容，键为文件名，没有的文件不记录
+}
+
+// Snapshot 复制指令可能读取的数据，mentioned 为指令中 @ 的玩家，files 为指令可能读取的群数据文件
+func (s *Storage) Snapshot(playerID, groupID int64, mentioned []int64, files []string) *RollState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := &RollState{}
+	for _, id := range append([]int64{playerID}, mentioned...) {
+		card, ok := s.cards[s.active[activeKey(id, groupID)]]
+		if !ok {
+			continue
+		}
+		if state.Cards == nil {
+			state.Cards = make(map[string]*CharacterCard)
+		}
+		state.Cards[strconv.FormatInt(id, 10)] = card.Clone()
+	}
+	if check, ok := s.checks[activeKey(playerID, groupID)]; ok {
+		c := *check
+		state.LastCheck = &c
+	}
+	state.Candidates = cloneCandidates(s.candidates[activeKey(playerID, groupID)])
+	key := strconv.FormatInt(groupID, 10)
+	if settings, ok := s.groups[key]; ok {
+		c := *settings
+		state.Settings = &c
+	}
+	if initiative, ok := s.initiatives[key]; ok {
+		state.Initiative = initiative.Clone()
+	}
+	for _, name := range files {
+		data, err := s.ReadGroupFile(groupID, name)
+		if err != nil {
+			continue
+		}
+		if state.Files == nil {
+			state.Files = make(map[string]string)
+		}
+		state.Files[name] = string(data)
+	}
+	return state
+}
+
+// cloneCandidates 复制候选属性，避免快照与存储共用同一份数据
+func cloneCandidates(candidates []map[string]int) []map[string]int {
+	if candidates == nil {
+		return nil
+	}
+	result := make([]map[string]int, len(candidates))
+	for i, c := range candidates {
+		result[i] = maps.Clone(c)
+	}
+	return result
+}
+
+// Restore 创建只在内存中保存 state 的存储管理器，用于校验重放
+// 群数据文件也只读取 state 中记录的内容，写入数据时返回错误
+func (s *Storage) Restore(playerID, groupID int64, state *RollState) *Storage {
+	restored := &Storage{
+		dataDir:     s.dataDir,
+		cards:       make(map[string]*CharacterCard),
+		active:      make(map[string]string),
+		groups:      make(map[string]*GroupSettings),
+		checks:      make(map[string]*LastCheck),
+		candidates:  make(map[string][]map[string]int),
+		initiatives: make(map[string]*Initiative),
+		groupFiles:  make(map[string][]byte),
+	}
+	for id, card := range state.Cards {
+		player, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		restored.cards[card.ID] = card.Clone()
+		restored.active[activeKey(player, groupID)] = card.ID
+	}
+	if state.LastCheck != nil {
+		c := *state.LastCheck
+		restored.checks[activeKey(playerID, groupID)] = &c
+	}
+	if state.Candidates != nil {
+		restored.candidates[activeKey(playerID, groupID)] = cloneCandidates(state.Candidates)
+	}
+	for name, data := range state.Files {
+		restored.groupFiles[name] = []byte(data)
+	}
+	key := strconv.FormatInt(groupID, 10)
+	if state.Settings != nil {
+		c := *state.Settings
+		restored.groups[key] = &c
+	}
+	if state.Initiative != nil {
+		restored.initiatives[key] = state.Initiative.Clone()
+	}
+	return restored
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"island/rng"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,41 +12,65 @@ import (
 )
 
 const (
-	dataDirName    = "data"
-	cardsFileName  = "cards.json"
-	historyFileName = "history.json"
+	dataDirName        = "data"
+	cardsFileName      = "cards.json"
+	historyFileName    = "history.json"
+	rollsFileName      = "rolls.jsonl"
+	activeFileName     = "active_cards.json"
+	groupsFileName     = "groups.json"
+	checksFileName     = "last_checks.json"
+	candidatesFileName = "candidates.json"
+	initiativeFileName = "initiative.json"
 )
 
 // CharacterCard 人物卡结构
 type CharacterCard struct {
-	ID        string                 `json:"id"`
-	Name      string                 `json:"name"`
-	System    string                 `json:"system"` // "coc7" or "dnd5e"
-	PlayerID  int64                  `json:"player_id"`
-	GroupID   int64                  `json:"group_id,omitempty"`
-	Attrs     map[string]interface{} `json:"attrs"`
-	Created   int64                  `json:"created"`
-	Updated   int64                  `json:"updated"`
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	System   string                 `json:"system"` // "coc7" or "dnd5e"
+	PlayerID int64                  `json:"player_id"`
+	GroupID  int64                  `json:"group_id,omitempty"`
+	Attrs    map[string]interface{} `json:"attrs"`
+	Sanity   *SanitySession         `json:"sanity,omitempty"` // 本场次的理智损失
+	DnD      *DnD5EStats            `json:"dnd5e,omitempty"`  // DnD5E 人物卡数据
+	HP       *HitPoints             `json:"hp,omitempty"`     // 生命值上限和状态
+	Created  int64                  `json:"created"`
+	Updated  int64                  `json:"updated"`
 }
 
 // RollHistory 掷骰历史
 type RollHistory struct {
-	ID         int64  `json:"id"`
-	PlayerID   int64  `json:"player_id"`
-	GroupID    int64  `json:"group_id,omitempty"`
-	Expression string `json:"expression"`
-	Result     string `json:"result"`
-	Time       int64  `json:"time"`
+	ID         int64      `json:"id"`
+	PlayerID   int64      `json:"player_id"`
+	GroupID    int64      `json:"group_id,omitempty"`
+	Expression string     `json:"expression"`
+	Result     string     `json:"result"`
+	Time       int64      `json:"time"`
+	Draws      []rng.Draw `json:"draws,omitempty"` // 随机数抽取序列，用于校验
+	State      *RollState `json:"state,omitempty"` // 指令执行前的数据，校验时在其上重放
 }
 
 // Storage 数据存储管理器
 type Storage struct {
-	dataDir     string
-	cardsPath   string
-	historyPath string
-	mu          sync.RWMutex
-	cards       map[string]*CharacterCard
-	history     []RollHistory
+	dataDir        string
+	cardsPath      string
+	historyPath    string
+	rollsPath      string
+	activePath     string
+	groupsPath     string
+	checksPath     string
+	candidatesPath string
+	initiativePath string
+	lastRollID     int64
+	mu             sync.RWMutex
+	cards          map[string]*CharacterCard
+	active         map[string]string // 玩家在各群当前使用的人物卡编号
+	groups         map[string]*GroupSettings
+	checks         map[string]*LastCheck       // 玩家在各群最近的技能检定
+	candidates     map[string][]map[string]int // 玩家在各群最近用 .coc7 生成的候选属性
+	initiatives    map[string]*Initiative      // 各群进行中的战斗
+	groupFiles     map[string][]byte           // 校验重放时使用的群数据文件，为 nil 时从数据目录读取
+	history        []RollHistory
 }
 
 // New 创建新的存储管理器
@@ -56,29 +81,63 @@ func New() (*Storage, error) {
 		wd = "."
 	}
 
-	dataDir := filepath.Join(wd, dataDirName)
+	return NewAt(filepath.Join(wd, dataDirName))
+}
+
+// NewAt 使用指定的数据目录创建存储管理器
+func NewAt(dataDir string) (*Storage, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("创建数据目录失败: %w", err)
 	}
 
 	cardsPath := filepath.Join(dataDir, cardsFileName)
 	historyPath := filepath.Join(dataDir, historyFileName)
+	rollsPath := filepath.Join(dataDir, rollsFileName)
 
 	s := &Storage{
-		dataDir:     dataDir,
-		cardsPath:   cardsPath,
-		historyPath: historyPath,
-		cards:       make(map[string]*CharacterCard),
-		history:     make([]RollHistory, 0),
+		dataDir:        dataDir,
+		cardsPath:      cardsPath,
+		historyPath:    historyPath,
+		rollsPath:      rollsPath,
+		activePath:     filepath.Join(dataDir, activeFileName),
+		groupsPath:     filepath.Join(dataDir, groupsFileName),
+		checksPath:     filepath.Join(dataDir, checksFileName),
+		candidatesPath: filepath.Join(dataDir, candidatesFileName),
+		initiativePath: filepath.Join(dataDir, initiativeFileName),
+		cards:          make(map[string]*CharacterCard),
+		active:         make(map[string]string),
+		groups:         make(map[string]*GroupSettings),
+		checks:         make(map[string]*LastCheck),
+		candidates:     make(map[string][]map[string]int),
+		initiatives:    make(map[string]*Initiative),
+		history:        make([]RollHistory, 0),
 	}
 
 	// 加载现有数据
 	if err := s.loadCards(); err != nil {
 		log.Printf("加载人物卡失败: %v", err)
 	}
+	if err := s.loadActiveCards(); err != nil {
+		log.Printf("加载当前人物卡失败: %v", err)
+	}
+	if err := s.loadGroups(); err != nil {
+		log.Printf("加载群设置失败: %v", err)
+	}
+	if err := s.loadChecks(); err != nil {
+		log.Printf("加载最近检定失败: %v", err)
+	}
+	if err := s.loadCandidates(); err != nil {
+		log.Printf("加载候选属性失败: %v", err)
+	}
+	if err := s.loadInitiatives(); err != nil {
+		log.Printf("加载先攻列表失败: %v", err)
+	}
 	if err := s.loadHistory(); err != nil {
 		log.Printf("加载历史记录失败: %v", err)
 	}
+	if err := s.loadLastRollID(); err != nil {
+		log.Printf("读取掷骰记录失败: %v", err)
+	}
 
 	return s, nil
 }
@@ -167,7 +226,7 @@ func (s *Storage) SaveCard(card *CharacterCard) error {
 		card.Created = now
 	}
 
-	s.cards[card.ID] = card
+	s.cards[card.ID] = card.Clone()
 	return s.saveCards()
 }
 
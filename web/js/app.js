@@ -735,6 +735,7 @@ async function runSandboxCommand() {
                     <div class="message-content">
                         <span class="message-sender">FateWeaver Bot</span>
                         <p class="message-text">${escapeHtml(data.response || '无响应')}</p>
+                        ${data.trace ? renderTraceTree(data.trace) : ''}
                     </div>
                 </div>
             `;
@@ -781,6 +782,45 @@ async function runSandboxCommand() {
     if (input) input.value = '';
 }
 
+/**
+ * 将掷骰求值树渲染为嵌套列表
+ * @param {Object} node - 求值树节点
+ * @returns {string} HTML 字符串
+ */
+function renderTraceTree(node) {
+    return `<ul class="trace-tree">${renderTraceNode(node)}</ul>`;
+}
+
+/**
+ * 渲染单个求值树节点及其子节点
+ * @param {Object} node - 求值树节点
+ * @returns {string} HTML 字符串
+ */
+function renderTraceNode(node) {
+    const value = Array.isArray(node.value) ? `[${node.value.join(', ')}]` : node.value;
+    const dice = (node.dice || []).map(die => {
+        const cls = ['trace-die', 'dropped', 'exploded', 'success', 'failure']
+            .filter((flag, i) => i === 0 || die[flag])
+            .join(' ');
+        const title = die.rerolled ? `d${die.sides} 已重骰` : `d${die.sides}`;
+        return `<span class="${cls}" title="${title}">${die.value}</span>`;
+    }).join('');
+    const warnings = (node.warnings || []).map(w =>
+        `<div class="trace-warning"><i class="fas fa-exclamation-triangle"></i> ${escapeHtml(w)}</div>`
+    ).join('');
+    const children = (node.children || []).map(renderTraceNode).join('');
+
+    return `
+        <li>
+            <span class="trace-kind">${escapeHtml(node.kind)}</span>
+            <code>${escapeHtml(node.expr)}</code> = <strong>${escapeHtml(String(value))}</strong>
+            ${dice ? `<div class="trace-dice">${dice}</div>` : ''}
+            ${warnings}
+            ${children ? `<ul>${children}</ul>` : ''}
+        </li>
+    `;
+}
+
 // ============================================
 // 统计与活动
 // ============================================
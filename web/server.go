@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"island/config"
 	"island/handlers"
+	"island/parser"
 	"log"
 	"net/http"
 	"sync"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -65,7 +67,8 @@ type CommandRequest struct {
 }
 
 type CommandResponse struct {
-	Response string `json:"response"`
+	Response string            `json:"response"`
+	Trace    *parser.TraceNode `json:"trace,omitempty"` // 掷骰求值树
 }
 
 // CustomSettings 自定义设置结构体
@@ -122,6 +125,8 @@ func StartHTTPServer(appConfig *config.Config, handler *handlers.MessageHandler)
 	http.HandleFunc("/command", handleCommand)
 	http.HandleFunc("/api/settings", handleSettings)
 	http.HandleFunc("/api/custom-settings", handleCustomSettings)
+	http.HandleFunc("/api/verify", handleVerify)
+	http.HandleFunc("/api/dist", handleDist)
 	
 	// 绑定到127.0.0.1而不是所有接口，提高安全性和性能
 	addr := "127.0.0.1:" + appConfig.HTTPPort
@@ -158,8 +163,37 @@ func handleCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := msgHandler.ProcessCommand(req.Command)
-	json.NewEncoder(w).Encode(CommandResponse{Response: response})
+	response, trace := msgHandler.ProcessCommandWithTrace(req.Command)
+	json.NewEncoder(w).Encode(CommandResponse{Response: response, Trace: trace})
+}
+
+// handleVerify 重放并校验掷骰记录，例如 GET /api/verify?id=12
+func handleVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, `{"error": "记录编号无效"}`, http.StatusBadRequest)
+		return
+	}
+
+	if msgHandler == nil {
+		http.Error(w, `{"error": "消息处理器未初始化"}`, http.StatusInternalServerError)
+		return
+	}
+
+	result, err := msgHandler.VerifyRoll(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
 }
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -498,3 +532,44 @@ func BroadcastToWeb(message string) {
 		}()
 	}
 }
+
+// DistResponse 分布接口的返回结果
+type DistResponse struct {
+	Expr   string             `json:"expr"`
+	Mean   float64            `json:"mean"`
+	StdDev float64            `json:"stddev"`
+	Min    int                `json:"min"`
+	Max    int                `json:"max"`
+	Points []parser.DistPoint `json:"points"` // 每个取值的概率 (PMF) 和累积概率 (CDF)
+}
+
+// handleDist 计算表达式的精确分布，例如 GET /api/dist?expr=4d6kh3
+func handleDist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	expr := strings.TrimSpace(r.URL.Query().Get("expr"))
+	if expr == "" {
+		http.Error(w, `{"error": "缺少表达式"}`, http.StatusBadRequest)
+		return
+	}
+
+	dist, err := parser.AnalyzeDistribution(expr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(DistResponse{
+		Expr:   expr,
+		Mean:   dist.Mean(),
+		StdDev: dist.StdDev(),
+		Min:    dist.Min,
+		Max:    dist.Max(),
+		Points: dist.Points(),
+	})
+}